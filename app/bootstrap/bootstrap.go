@@ -0,0 +1,233 @@
+package bootstrap
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"msim/app/system"
+	"msim/app/user"
+	"msim/config"
+	"msim/db"
+)
+
+type App struct {
+	Config        *config.Config
+	DB            *gorm.DB
+	UserService   *user.UserService
+	SystemService *system.SystemService
+	closeDB       func()
+}
+
+// Boot application from configuration file at path, see config.Load.
+func Boot(path string) (*App, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return BootConfig(cfg)
+}
+
+// Boot application with default configuration for environment.
+func BootEnvironment(env config.Environment) (*App, error) {
+	cfg := config.Default()
+	cfg.Environment = env
+
+	return BootConfig(cfg)
+}
+
+// Open configured database, run migrations and wire services.
+func BootConfig(cfg *config.Config) (*App, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	DB, closeDB, err := OpenDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(cfg, DB); err != nil {
+		closeDB()
+		return nil, err
+	}
+
+	authRepository := (&user.AuthRepository{}).New(DB, user.AuthOptions{
+		Lifetime:        cfg.Auth.TokenLifetime.Duration,
+		Sliding:         cfg.Auth.SlidingExpiration,
+		RefreshLifetime: cfg.Auth.RefreshLifetime.Duration,
+	})
+
+	tokenStrategy, err := TokenStrategy(cfg, DB, authRepository)
+	if err != nil {
+		closeDB()
+		return nil, err
+	}
+
+	passwordPolicy, err := PasswordPolicy(cfg)
+	if err != nil {
+		closeDB()
+		return nil, err
+	}
+
+	userService := (&user.UserService{}).New(
+		(&user.UserRepository{}).New(DB),
+		authRepository,
+		cfg.Auth.BcryptCost,
+		tokenStrategy,
+		passwordPolicy,
+	)
+	keyring, err := Keyring(cfg)
+	if err != nil {
+		closeDB()
+		return nil, err
+	}
+
+	systemService := (&system.SystemService{}).New(
+		(&system.SystemRepository{}).New(DB),
+		(&system.Cache{}).New(cfg.System.CacheTTL.Duration),
+		keyring,
+	)
+
+	return &App{
+		Config:        cfg,
+		DB:            DB,
+		UserService:   userService,
+		SystemService: systemService,
+		closeDB:       closeDB,
+	}, nil
+}
+
+// Get schema migrations of every module.
+func Migrations() []db.Migration {
+	var migrations []db.Migration
+	migrations = append(migrations, user.Migrations...)
+	migrations = append(migrations, system.Migrations...)
+
+	return migrations
+}
+
+// Get migrator of every module for database.
+func Migrator(database *gorm.DB) *db.Migrator {
+	return (&db.Migrator{}).New(database, Migrations())
+}
+
+// Get configured access code strategy, JWT keys are loaded
+// and revoked codes of the deny list are restored. Strict JWT
+// checks read the user and missed revocations from database.
+func TokenStrategy(cfg *config.Config, database *gorm.DB, authRepository *user.AuthRepository) (user.TokenStrategy, error) {
+	if cfg.Auth.Strategy != config.JWTStrategy {
+		return (&user.CodeStrategy{}).New(authRepository), nil
+	}
+
+	keys, err := user.LoadKeySet(cfg.Auth.JWT.KeysDir, cfg.Auth.JWT.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+
+	lifetime := cfg.Auth.TokenLifetime.Duration
+	denyList := (&user.DenyList{}).New(database, lifetime)
+	if err := denyList.Load(); err != nil {
+		return nil, err
+	}
+
+	var userRepository *user.UserRepository
+	if cfg.Auth.JWT.Strict {
+		userRepository = (&user.UserRepository{}).New(database)
+	}
+
+	return (&user.JWTStrategy{}).New(keys, denyList, authRepository, userRepository, lifetime), nil
+}
+
+// Get configured password policy, loading its common passwords list.
+func PasswordPolicy(cfg *config.Config) (*user.PasswordPolicy, error) {
+	policy := &user.PasswordPolicy{
+		MinLength:  cfg.Auth.Password.MinLength,
+		MaxLength:  cfg.Auth.Password.MaxLength,
+		RejectName: cfg.Auth.Password.RejectName,
+	}
+
+	for _, class := range cfg.Auth.Password.Require {
+		policy.Require = append(policy.Require, user.CharacterClass(class))
+	}
+
+	if cfg.Auth.Password.CommonList != "" {
+		if err := policy.LoadCommon(cfg.Auth.Password.CommonList); err != nil {
+			return nil, err
+		}
+	}
+
+	return policy, nil
+}
+
+// Get configured master keys of secret variables, nil when not configured.
+func Keyring(cfg *config.Config) (*system.Keyring, error) {
+	if cfg.System.Secrets.MasterKey == "" {
+		return nil, nil
+	}
+
+	return system.LoadKeyring(cfg.System.Secrets.KeysDir, cfg.System.Secrets.MasterKey)
+}
+
+// Open database for configured environment, with a func closing it that
+// also drops test databases.
+func OpenDB(cfg *config.Config) (*gorm.DB, func(), error) {
+	switch cfg.Environment {
+	case config.Test:
+		return db.TestDB()
+	case config.Local:
+		if err := db.LocalDBSetup(cfg.Storage.Folder, cfg.Storage.Filename); err != nil {
+			return nil, nil, err
+		}
+		return closable(db.LocalDB(cfg.Storage.Folder, cfg.Storage.Filename))
+	case config.Server:
+		if cfg.Database.URL == "" {
+			return nil, nil, fmt.Errorf("database.url must be set in %s environment", cfg.Environment)
+		}
+		return closable(db.ServerDB(cfg.Database.URL))
+	}
+
+	return nil, nil, fmt.Errorf("unknown environment %q", cfg.Environment)
+}
+
+// Close database of app, dropping it on test environment.
+func (app *App) Close() {
+	app.closeDB()
+}
+
+// PRIVATE:
+
+// Get opened database with a func closing it.
+func closable(database *gorm.DB, err error) (*gorm.DB, func(), error) {
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return database, func() {
+		if sqlDB, err := database.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}, nil
+}
+
+// Apply pending migrations on local and test databases,
+// server databases must be upgraded explicitly with "msim migrate up".
+func migrate(cfg *config.Config, database *gorm.DB) error {
+	migrator := Migrator(database)
+
+	if cfg.Environment != config.Server {
+		_, err := migrator.Up(false)
+		return err
+	}
+
+	pending, err := migrator.Pending()
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("database has %d pending migrations, run \"msim migrate up\"", len(pending))
+	}
+
+	return nil
+}
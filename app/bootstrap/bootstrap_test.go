@@ -0,0 +1,219 @@
+package bootstrap
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"msim/app/system"
+	"msim/app/user"
+	"msim/config"
+	"msim/db"
+)
+
+// Schema created by AutoMigrate before migrations, as found in existing
+// storage/db.sqlite files.
+var autoMigratedSchema = []string{
+	"CREATE TABLE `systems` (`id` uuid,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`key` text UNIQUE,`value` text,`type` text,PRIMARY KEY (`id`))",
+	"CREATE INDEX `idx_systems_deleted_at` ON `systems`(`deleted_at`)",
+	"CREATE TABLE `users` (`id` uuid,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`name` text UNIQUE,`password` text,PRIMARY KEY (`id`))",
+	"CREATE INDEX `idx_users_deleted_at` ON `users`(`deleted_at`)",
+	"CREATE TABLE `auths` (`id` uuid,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`code` text,`user_id` uuid,PRIMARY KEY (`id`),CONSTRAINT `fk_auths_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`))",
+	"CREATE INDEX `idx_auths_deleted_at` ON `auths`(`deleted_at`)",
+}
+
+// Test BootEnvironment.
+func TestBootEnvironment(t *testing.T) {
+	t.Run("Should boot wired services on test environment", func(t *testing.T) {
+		app, err := BootEnvironment(config.Test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer app.Close()
+
+		registered, ex := app.UserService.Register(&user.UserAuthDTO{Name: "test", Password: "passwd"})
+		if ex != nil {
+			t.Fatal(ex)
+		}
+
+		if _, ex := app.SystemService.GetAll(registered); ex != nil {
+			t.Fatal(ex)
+		}
+	})
+
+	t.Run("Should not boot server environment with pending migrations", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Environment = config.Server
+		cfg.Database.URL = t.TempDir() + "/server.sqlite"
+
+		if _, err := BootConfig(cfg); err == nil {
+			t.Fatal("Should throw error")
+		}
+	})
+
+	t.Run("Should boot server environment once migrated", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Environment = config.Server
+		cfg.Database.URL = t.TempDir() + "/server.sqlite"
+
+		DB, closeDB, err := OpenDB(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer closeDB()
+
+		if _, err := Migrator(DB).Up(false); err != nil {
+			t.Fatal(err)
+		}
+
+		app, err := BootConfig(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer app.Close()
+
+		if !app.DB.Migrator().HasTable(&user.User{}) {
+			t.Fatal("Should open the migrated server database")
+		}
+	})
+
+	t.Run("Should boot with jwt access codes", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Environment = config.Test
+		cfg.Auth.Strategy = config.JWTStrategy
+		cfg.Auth.JWT = config.JWTConfig{KeysDir: t.TempDir(), SigningKey: "current"}
+
+		if _, err := user.GenerateKey(cfg.Auth.JWT.KeysDir, "current", user.EdDSA); err != nil {
+			t.Fatal(err)
+		}
+
+		app, err := BootConfig(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer app.Close()
+
+		dto := &user.UserAuthDTO{Name: "test", Password: "passwd"}
+		app.UserService.Register(dto)
+		pair, ex := app.UserService.Login(dto)
+		if ex != nil {
+			t.Fatal(ex)
+		}
+
+		if strings.Count(pair.Code, ".") != 2 {
+			t.Fatal("Should issue a JWT access code")
+		}
+
+		if _, ex := app.UserService.GetAuthUser(&user.AuthDTO{Code: pair.Code}); ex != nil {
+			t.Fatal(ex)
+		}
+	})
+
+	t.Run("Should not boot server environment without database", func(t *testing.T) {
+		if _, err := BootEnvironment(config.Server); err == nil {
+			t.Fatal("Should throw error")
+		}
+	})
+}
+
+// Test upgrades of databases created by AutoMigrate.
+func TestAutoMigratedUpgrade(t *testing.T) {
+	t.Run("Should upgrade a local database keeping its rows", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Environment = config.Local
+		cfg.Storage = config.StorageConfig{Folder: t.TempDir(), Filename: "db.sqlite"}
+
+		legacy, err := db.SqliteDB(filepath.Join(cfg.Storage.Folder, cfg.Storage.Filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, statement := range autoMigratedSchema {
+			if err := legacy.Exec(statement).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		hash, _ := bcrypt.GenerateFromPassword([]byte("passwd"), bcrypt.MinCost)
+		bob := uuid.New()
+		legacy.Exec("INSERT INTO users (id, created_at, name, password) VALUES (?, CURRENT_TIMESTAMP, 'bob', ?)", bob, string(hash))
+		legacy.Exec("INSERT INTO auths (id, created_at, code, user_id) VALUES (?, CURRENT_TIMESTAMP, ?, ?)", uuid.New(), uuid.NewString(), bob)
+		legacy.Exec("INSERT INTO systems (id, created_at, key, value, type) VALUES (?, CURRENT_TIMESTAMP, 'rate', '2', 'Integer')", uuid.New())
+		if sqlDB, err := legacy.DB(); err == nil {
+			sqlDB.Close()
+		}
+
+		app, err := BootConfig(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer app.Close()
+
+		if pending, err := Migrator(app.DB).Pending(); err != nil || len(pending) != 0 {
+			t.Fatalf("Expected every migration applied, %d pending: %v", len(pending), err)
+		}
+
+		dto := &user.UserAuthDTO{Name: "bob", Password: "passwd"}
+		if _, ex := app.UserService.Login(dto); ex != nil {
+			t.Fatal("Should log existing users in", ex)
+		}
+
+		reader := &user.UserEntity{ID: bob, Name: "bob", Role: user.ReaderRole}
+		rate, ex := app.SystemService.GetByKey(reader, &system.SystemKeyDTO{Key: "rate"})
+		if ex != nil {
+			t.Fatal(ex)
+		}
+
+		if rate.Value != "2" || rate.Type != "int" {
+			t.Fatalf("Expected rate 2 of type int, got %s of type %s", rate.Value, rate.Type)
+		}
+
+		admin := &user.UserEntity{ID: uuid.New(), Name: "admin", Role: user.AdminRole}
+		if _, ex := app.SystemService.Delete(admin, &system.SystemAuditDTO{Key: "rate"}); ex != nil {
+			t.Fatal(ex)
+		}
+
+		if _, ex := app.SystemService.Create(admin, &system.SystemEnvDTO{Key: "rate", Value: "3", Type: "int"}); ex != nil {
+			t.Fatal("Should create the key of a deleted variable again", ex)
+		}
+	})
+}
+
+// Test Boot.
+func TestBoot(t *testing.T) {
+	t.Run("Should not boot an unknown environment", func(t *testing.T) {
+		t.Setenv(config.EnvironmentVariable, "production")
+
+		if _, err := Boot(""); err == nil {
+			t.Fatal("Should throw error")
+		}
+	})
+}
+
+// Test PasswordPolicy.
+func TestPasswordPolicy(t *testing.T) {
+	t.Run("Should build the configured policy", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Auth.Password.Require = []string{"digit"}
+
+		policy, err := PasswordPolicy(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(policy.Check("alice", "secret")) != 1 {
+			t.Fatal("Should require a digit")
+		}
+	})
+
+	t.Run("Should fail on a missing common passwords list", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Auth.Password.CommonList = "missing.txt"
+
+		if _, err := PasswordPolicy(cfg); err == nil {
+			t.Fatal("Should throw error")
+		}
+	})
+}
@@ -0,0 +1,12 @@
+package server
+
+import (
+	"net/http"
+
+	"msim/app/shared"
+)
+
+// Error tags of the server module.
+var (
+	TOO_LARGE_EX = shared.MustRegisterTag("TOO_LARGE", "request body is too large", http.StatusRequestEntityTooLarge)
+)
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"msim/app/system"
+)
+
+// GET /flags: evaluate every flag readable by the authenticated user.
+func (server *Server) handleFlags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	result, ex := server.systemService.Flags(actor)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GET /flags/{key}: evaluate a flag for the authenticated user.
+func (server *Server) handleFlag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/flags/")
+	result, ex := server.systemService.Evaluate(actor, &system.SystemKeyDTO{Key: key})
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
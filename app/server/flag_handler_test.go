@@ -0,0 +1,39 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"msim/app/system"
+	"msim/app/user"
+)
+
+// Test GET /flags and GET /flags/{key}.
+func TestFlagHandler(t *testing.T) {
+	t.Run("Should evaluate flags for the authenticated user", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "operator", user.OperatorRole)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "beta", Value: `{"enabled": true}`, Type: "flag"}, code)
+
+		var flags []*system.FlagEvaluation
+		json.NewDecoder(Request(server, http.MethodGet, "/flags", nil, code).Body).Decode(&flags)
+		if len(flags) != 1 || !flags[0].Enabled {
+			t.Fatalf("Expected beta enabled, got %+v", flags)
+		}
+
+		response := Request(server, http.MethodGet, "/flags/beta", nil, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+	})
+
+	t.Run("Should not evaluate flags without a code", func(t *testing.T) {
+		server, _ := CreateServer(t)
+
+		response := Request(server, http.MethodGet, "/flags", nil, "")
+		if response.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, response.Code)
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"msim/app/shared"
+	"msim/app/system"
+	"msim/app/user"
+	"msim/db"
+)
+
+// Largest import file accepted by default, in bytes.
+const DefaultImportLimit = 10 << 20
+
+type Server struct {
+	userService   *user.UserService
+	systemService *system.SystemService
+	importLimit   int64
+	mux           *http.ServeMux
+}
+
+// Create a Server instance with all routes registered, import files
+// are limited to importLimit bytes.
+func (server *Server) New(userService *user.UserService, systemService *system.SystemService, importLimit int64) *Server {
+	if importLimit <= 0 {
+		importLimit = DefaultImportLimit
+	}
+
+	s := &Server{
+		userService:   userService,
+		systemService: systemService,
+		importLimit:   importLimit,
+		mux:           http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/users", s.handleUsers)
+	s.mux.HandleFunc("/users/", s.handleUser)
+	s.mux.HandleFunc("/login", s.handleLogin)
+	s.mux.HandleFunc("/refresh", s.handleRefresh)
+	s.mux.HandleFunc("/me", s.handleMe)
+	s.mux.HandleFunc("/me/password", s.handleMePassword)
+	s.mux.HandleFunc("/me/name", s.handleMeName)
+	s.mux.HandleFunc("/logout", s.handleLogout)
+	s.mux.HandleFunc("/logout/all", s.handleLogoutAll)
+	s.mux.HandleFunc("/system", s.handleSystem)
+	s.mux.HandleFunc("/system/", s.handleSystemKey)
+	s.mux.HandleFunc("/watch", s.handleWatch)
+	s.mux.HandleFunc("/export", s.handleExport)
+	s.mux.HandleFunc("/import", s.handleImport)
+	s.mux.HandleFunc("/flags", s.handleFlags)
+	s.mux.HandleFunc("/flags/", s.handleFlag)
+
+	return s
+}
+
+// Dispatch request to the registered routes.
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mux.ServeHTTP(w, r)
+}
+
+// Start listening on address.
+func (server *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, server)
+}
+
+// PRIVATE:
+
+// Write value as JSON response body.
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// Write error as JSON error envelope with its mapped status code,
+// errors that aren't exceptions are reported as internal errors.
+func writeError(w http.ResponseWriter, err error) {
+	var ex *shared.Exception
+	if !errors.As(err, &ex) {
+		ex = shared.InternalErrorException().Wrap(err)
+	}
+
+	writeJSON(w, ex.StatusCode(), ex.Envelope())
+}
+
+// Decode JSON request body into value, write an error response on failure.
+func readJSON(w http.ResponseWriter, r *http.Request, value any) bool {
+	if err := json.NewDecoder(r.Body).Decode(value); err != nil {
+		ex := shared.DefaultException(shared.APPLICATION_EX, "invalid JSON body")
+		writeError(w, ex.Wrap(err))
+		return false
+	}
+
+	return true
+}
+
+// Write method not allowed response.
+func methodNotAllowed(w http.ResponseWriter) {
+	ex := shared.DefaultException(shared.APPLICATION_EX, "method not allowed")
+	writeJSON(w, http.StatusMethodNotAllowed, ex.Envelope())
+}
+
+// Decode optional JSON request body into value, an empty body leaves it untouched.
+func readOptionalJSON(w http.ResponseWriter, r *http.Request, value any) bool {
+	err := json.NewDecoder(r.Body).Decode(value)
+	if err != nil && !errors.Is(err, io.EOF) {
+		ex := shared.DefaultException(shared.APPLICATION_EX, "invalid JSON body")
+		writeError(w, ex.Wrap(err))
+		return false
+	}
+
+	return true
+}
+
+// Read "limit", "cursor", "sort", "order" and "total" query parameters,
+// write an error response on a malformed one.
+func queryPage(w http.ResponseWriter, r *http.Request) (db.PageQuery, bool) {
+	query := r.URL.Query()
+	page := db.PageQuery{Cursor: query.Get("cursor"), Sort: query.Get("sort"), Order: query.Get("order")}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil {
+			writeError(w, shared.FormException(shared.APPLICATION_EX, "limit").Wrap(err))
+			return page, false
+		}
+		page.Limit = value
+	}
+
+	if total := query.Get("total"); total != "" {
+		value, err := strconv.ParseBool(total)
+		if err != nil {
+			writeError(w, shared.FormException(shared.APPLICATION_EX, "total").Wrap(err))
+			return page, false
+		}
+		page.Total = value
+	}
+
+	return page, true
+}
+
+// Read RFC 3339 time query parameter name, zero when missing,
+// write an error response when malformed.
+func queryTime(w http.ResponseWriter, r *http.Request, name string) (time.Time, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, true
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		writeError(w, shared.FormException(shared.APPLICATION_EX, name).Wrap(err))
+		return parsed, false
+	}
+
+	return parsed, true
+}
+
+// Set "X-Next-Cursor" and "X-Total-Count" headers of a page, before writing its items.
+func writePageHeaders(w http.ResponseWriter, next string, total *int64) {
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+
+	if total != nil {
+		w.Header().Set("X-Total-Count", strconv.FormatInt(*total, 10))
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gorm.io/gorm"
+	"msim/app/bootstrap"
+	"msim/app/user"
+	"msim/config"
+)
+
+// Test request decoding and routing errors.
+func TestServer(t *testing.T) {
+	t.Run("Should reject unsupported methods", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		response := Request(server, http.MethodDelete, "/users", nil, "")
+
+		if response.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("Expected status %d, got %d", http.StatusMethodNotAllowed, response.Code)
+		}
+	})
+
+	t.Run("Should reject malformed JSON bodies", func(t *testing.T) {
+		server, _ := CreateServer(t)
+
+		request := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBufferString("{"))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		if response.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, response.Code)
+		}
+	})
+}
+
+// Create server and test database.
+func CreateServer(t *testing.T) (*Server, *gorm.DB) {
+	app, err := bootstrap.BootEnvironment(config.Test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(app.Close)
+
+	return (&Server{}).New(app.UserService, app.SystemService, 0), app.DB
+}
+
+// Send request with optional JSON body and bearer code.
+func Request(server *Server, method, path string, body any, code string) *httptest.ResponseRecorder {
+	var buffer bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buffer).Encode(body)
+	}
+
+	request := httptest.NewRequest(method, path, &buffer)
+	if code != "" {
+		request.Header.Set("Authorization", "Bearer "+code)
+	}
+
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	return response
+}
+
+// Register user name with role and return its authentication code.
+func Login(server *Server, name string, role user.Role) string {
+	dto := &user.UserAuthDTO{Name: name, Password: "passwd"}
+	server.userService.Register(dto)
+	server.userService.AssignRole(&user.UserRoleDTO{Name: name, Role: role})
+
+	pair, ex := server.userService.Login(dto)
+	if ex != nil {
+		panic(ex)
+	}
+
+	return pair.Code
+}
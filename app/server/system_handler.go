@@ -0,0 +1,616 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"msim/app/shared"
+	"msim/app/system"
+)
+
+type systemResponse struct {
+	Key         string        `json:"key"`
+	Value       string        `json:"value"`
+	Type        string        `json:"type"`
+	ReadPolicy  system.Policy `json:"read_policy,omitempty"`
+	WritePolicy system.Policy `json:"write_policy,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+type systemValueRequest struct {
+	Value  string `json:"value"`
+	Type   string `json:"type,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type systemReasonRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+type systemRollbackRequest struct {
+	Version int    `json:"version"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Interval of keep-alive comments on idle watch streams.
+const watchHeartbeat = 15 * time.Second
+
+type systemSecretResponse struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type systemMoveRequest struct {
+	To     string `json:"to"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type systemPolicyRequest struct {
+	ReadPolicy  system.Policy `json:"read_policy"`
+	WritePolicy system.Policy `json:"write_policy"`
+}
+
+// GET /system?prefix={namespace}&nested={bool}: list system variables
+// readable by the caller, optionally of a namespace only or nested by key
+// segment. Lists that aren't nested are paged and filtered with
+// type={type}&created_after={time}&created_before={time}, see queryPage.
+// POST /system: create a system variable.
+func (server *Server) handleSystem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.optionalAuthenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		dto := &system.SystemNamespaceDTO{Namespace: query.Get("prefix")}
+
+		if query.Get("nested") == "true" {
+			tree, ex := server.systemService.GetTree(actor, dto)
+			if ex != nil {
+				writeError(w, ex)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, tree)
+			return
+		}
+
+		page, ok := queryPage(w, r)
+		if !ok {
+			return
+		}
+
+		after, ok := queryTime(w, r, "created_after")
+		if !ok {
+			return
+		}
+
+		before, ok := queryTime(w, r, "created_before")
+		if !ok {
+			return
+		}
+
+		result, ex := server.systemService.List(actor, &system.SystemListDTO{
+			SystemFilter: system.SystemFilter{
+				Namespace:     dto.Namespace,
+				Type:          system.ValueType(query.Get("type")),
+				CreatedAfter:  after,
+				CreatedBefore: before,
+			},
+			Page: page,
+		})
+		if ex != nil {
+			writeError(w, ex)
+			return
+		}
+
+		response := []*systemResponse{}
+		for _, entity := range result.Items {
+			response = append(response, toSystemResponse(entity))
+		}
+
+		writePageHeaders(w, result.NextCursor, result.Total)
+		writeJSON(w, http.StatusOK, response)
+	case http.MethodPost:
+		var dto system.SystemEnvDTO
+		if !readJSON(w, r, &dto) {
+			return
+		}
+
+		result, ex := server.systemService.Create(actor, &dto)
+		if ex != nil {
+			writeError(w, ex)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, toSystemResponse(result))
+	}
+}
+
+// GET /system/{key}: get a system variable.
+// PUT /system/{key}: update a system variable value and optionally its type.
+// DELETE /system/{key}: soft delete a system variable.
+// PUT /system/{key}/policy: set the access policies of a system variable.
+// GET /system/{key}/history: list the changes of a system variable.
+// POST /system/{key}/rollback: set a system variable back to a version.
+// POST /system/{key}/restore: restore a deleted system variable.
+// POST /system/{key}/purge: permanently delete a system variable.
+// POST /system/{namespace}/move: move every variable of a namespace.
+// POST /system/{key}/reveal: decrypt the value of a secret variable.
+func (server *Server) handleSystemKey(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/system/")
+	if key, ok := strings.CutSuffix(key, "/policy"); ok {
+		server.handleSystemPolicy(w, r, key)
+		return
+	}
+
+	if key, ok := strings.CutSuffix(key, "/history"); ok {
+		server.handleSystemHistory(w, r, key)
+		return
+	}
+
+	if key, ok := strings.CutSuffix(key, "/rollback"); ok {
+		server.handleSystemRollback(w, r, key)
+		return
+	}
+
+	if key, ok := strings.CutSuffix(key, "/restore"); ok {
+		server.handleSystemRestore(w, r, key)
+		return
+	}
+
+	if key, ok := strings.CutSuffix(key, "/purge"); ok {
+		server.handleSystemPurge(w, r, key)
+		return
+	}
+
+	if namespace, ok := strings.CutSuffix(key, "/move"); ok {
+		server.handleSystemMove(w, r, namespace)
+		return
+	}
+
+	if key, ok := strings.CutSuffix(key, "/reveal"); ok {
+		server.handleSystemReveal(w, r, key)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		methodNotAllowed(w)
+		return
+	}
+
+	if key == "" {
+		ex := shared.FormException(shared.MIN_LENGTH_EX, "key")
+		writeError(w, ex)
+		return
+	}
+
+	// Only reads are open to anonymous callers.
+	authenticate := server.authenticate
+	if r.Method == http.MethodGet {
+		authenticate = server.optionalAuthenticate
+	}
+
+	actor, ex := authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		result, ex := server.systemService.GetByKey(actor, &system.SystemKeyDTO{Key: key})
+		if ex != nil {
+			writeError(w, ex)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toSystemResponse(result))
+	case http.MethodPut:
+		var body systemValueRequest
+		if !readJSON(w, r, &body) {
+			return
+		}
+
+		dto := &system.SystemUpdateDTO{Key: key, Value: body.Value, Type: body.Type, Reason: body.Reason}
+		result, ex := server.systemService.UpdateByKey(actor, dto)
+		if ex != nil {
+			writeError(w, ex)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toSystemResponse(result))
+	case http.MethodDelete:
+		var body systemReasonRequest
+		if !readOptionalJSON(w, r, &body) {
+			return
+		}
+
+		if _, ex := server.systemService.Delete(actor, &system.SystemAuditDTO{Key: key, Reason: body.Reason}); ex != nil {
+			writeError(w, ex)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// PUT /system/{key}/policy: set the access policies of a system variable.
+func (server *Server) handleSystemPolicy(w http.ResponseWriter, r *http.Request, key string) {
+	if r.Method != http.MethodPut {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	var body systemPolicyRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	dto := &system.SystemPolicyDTO{Key: key, ReadPolicy: body.ReadPolicy, WritePolicy: body.WritePolicy}
+	result, ex := server.systemService.UpdatePoliciesByKey(actor, dto)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toSystemResponse(result))
+}
+
+// GET /system/{key}/history: list the changes of a system variable.
+func (server *Server) handleSystemHistory(w http.ResponseWriter, r *http.Request, key string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.optionalAuthenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	result, ex := server.systemService.History(actor, &system.SystemKeyDTO{Key: key})
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// POST /system/{key}/rollback: set a system variable back to a version.
+func (server *Server) handleSystemRollback(w http.ResponseWriter, r *http.Request, key string) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	var body systemRollbackRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	dto := &system.SystemRollbackDTO{Key: key, Version: body.Version, Reason: body.Reason}
+	result, ex := server.systemService.Rollback(actor, dto)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toSystemResponse(result))
+}
+
+// POST /system/{key}/restore: restore a deleted system variable.
+func (server *Server) handleSystemRestore(w http.ResponseWriter, r *http.Request, key string) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	var body systemReasonRequest
+	if !readOptionalJSON(w, r, &body) {
+		return
+	}
+
+	result, ex := server.systemService.Restore(actor, &system.SystemAuditDTO{Key: key, Reason: body.Reason})
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toSystemResponse(result))
+}
+
+// POST /system/{key}/purge: permanently delete a system variable.
+func (server *Server) handleSystemPurge(w http.ResponseWriter, r *http.Request, key string) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	var body systemReasonRequest
+	if !readOptionalJSON(w, r, &body) {
+		return
+	}
+
+	if _, ex := server.systemService.Purge(actor, &system.SystemAuditDTO{Key: key, Reason: body.Reason}); ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /system/{namespace}/move: move every variable of a namespace.
+func (server *Server) handleSystemMove(w http.ResponseWriter, r *http.Request, namespace string) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	var body systemMoveRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	result, ex := server.systemService.Move(actor, &system.SystemMoveDTO{From: namespace, To: body.To, Reason: body.Reason})
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	response := []*systemResponse{}
+	for _, entity := range result {
+		response = append(response, toSystemResponse(entity))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// POST /system/{key}/reveal: decrypt the value of a secret variable.
+func (server *Server) handleSystemReveal(w http.ResponseWriter, r *http.Request, key string) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	var body systemReasonRequest
+	if !readOptionalJSON(w, r, &body) {
+		return
+	}
+
+	value, ex := server.systemService.RevealSecret(actor, &system.SystemAuditDTO{Key: key, Reason: body.Reason})
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, &systemSecretResponse{Key: key, Value: value})
+}
+
+// GET /export?format={json|yaml|env}: download the system variables readable
+// by the caller.
+func (server *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.optionalAuthenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	format, ok := queryFormat(w, r)
+	if !ok {
+		return
+	}
+
+	data, ex := server.systemService.Export(actor, format)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="system.%s"`, format))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// POST /import?format={json|yaml|env}&mode={create|upsert|replace}&dry_run={bool}&reason={reason}:
+// load system variables from the request body, reporting the changes.
+func (server *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	format, ok := queryFormat(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	dryRun, err := strconv.ParseBool(query.Get("dry_run"))
+	if err != nil && query.Get("dry_run") != "" {
+		writeError(w, shared.FormException(shared.APPLICATION_EX, "dry_run").Wrap(err))
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, server.importLimit))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, shared.FormException(TOO_LARGE_EX, "file").Wrap(err))
+		return
+	}
+
+	if err != nil {
+		writeError(w, shared.FormException(shared.APPLICATION_EX, "file").Wrap(err))
+		return
+	}
+
+	dto := &system.SystemImportDTO{
+		Format: format,
+		Mode:   system.ImportMode(query.Get("mode")),
+		DryRun: dryRun,
+		Reason: query.Get("reason"),
+		Data:   data,
+	}
+	if dto.Mode == "" {
+		dto.Mode = system.UpsertMode
+	}
+
+	report, ex := server.systemService.Import(actor, dto)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// GET /watch?key={key}: stream changes of system variables readable by the
+// caller as Server-Sent Events, every variable when no key is given.
+func (server *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.optionalAuthenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, shared.DefaultException(shared.INTERNAL_EX, "streaming unsupported"))
+		return
+	}
+
+	events := server.systemService.Watch(r.Context(), actor, r.URL.Query()["key"]...)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, open := <-events:
+			if !open {
+				return
+			}
+
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Action, data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+
+		flusher.Flush()
+	}
+}
+
+// PRIVATE:
+
+// Content types of import and export formats.
+var formatContentTypes = map[system.Format]string{
+	system.JSONFormat:   "application/json",
+	system.YAMLFormat:   "application/yaml",
+	system.DotenvFormat: "text/plain; charset=utf-8",
+}
+
+// Get format query parameter, JSON by default, write an error response when unsupported.
+func queryFormat(w http.ResponseWriter, r *http.Request) (system.Format, bool) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		return system.JSONFormat, true
+	}
+
+	format, err := system.ParseFormat(name)
+	if err != nil {
+		ex := shared.FormException(shared.APPLICATION_EX, "format")
+		ex.Reason = err.Error()
+		writeError(w, ex)
+		return "", false
+	}
+
+	return format, true
+}
+
+// Map system entity to response body.
+func toSystemResponse(entity *system.SystemEntity) *systemResponse {
+	return &systemResponse{
+		Key:         entity.Key,
+		Value:       entity.Value,
+		Type:        entity.Type,
+		ReadPolicy:  entity.ReadPolicy,
+		WritePolicy: entity.WritePolicy,
+		CreatedAt:   entity.CreatedAt,
+	}
+}
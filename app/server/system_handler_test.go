@@ -0,0 +1,504 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"msim/app/bootstrap"
+	"msim/app/system"
+	"msim/app/user"
+	"msim/config"
+)
+
+// Test POST /system and GET /system.
+func TestSystemHandler(t *testing.T) {
+	t.Run("Should create and list system variables", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "operator", user.OperatorRole)
+
+		dto := &system.SystemEnvDTO{Key: "key1", Value: "10", Type: "int"}
+		response := Request(server, http.MethodPost, "/system", dto, code)
+		if response.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d", http.StatusCreated, response.Code)
+		}
+
+		response = Request(server, http.MethodGet, "/system", nil, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		var result []systemResponse
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if len(result) != 1 || result[0].Key != dto.Key || result[0].Value != dto.Value {
+			t.Fatal("Should list the created system variable")
+		}
+	})
+
+	t.Run("Should list only world-readable variables without authentication", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "admin", user.AdminRole)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "public", ReadPolicy: system.Everyone}, code)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "private"}, code)
+
+		response := Request(server, http.MethodGet, "/system", nil, "")
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		var result []systemResponse
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if len(result) != 1 || result[0].Key != "public" {
+			t.Fatal("Should list the world-readable variable only")
+		}
+
+		response = Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "key1"}, "")
+		if response.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, response.Code)
+		}
+	})
+
+	t.Run("Should answer unreadable variables like missing ones", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		admin := Login(server, "admin", user.AdminRole)
+		reader := Login(server, "reader", user.ReaderRole)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "private", ReadPolicy: "role:admin"}, admin)
+
+		for _, key := range []string{"private", "missing"} {
+			response := Request(server, http.MethodGet, "/system/"+key, nil, reader)
+			if response.Code != http.StatusNotFound {
+				t.Fatalf("%s expected status %d, got %d", key, http.StatusNotFound, response.Code)
+			}
+		}
+	})
+
+	t.Run("Should not create a system variable as reader", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "reader", user.ReaderRole)
+
+		dto := &system.SystemEnvDTO{Key: "key1", Value: "10", Type: "int"}
+		response := Request(server, http.MethodPost, "/system", dto, code)
+		if response.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, response.Code)
+		}
+
+		response = Request(server, http.MethodGet, "/system", nil, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+	})
+
+	t.Run("Should not create a system variable twice", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "operator", user.OperatorRole)
+
+		dto := &system.SystemEnvDTO{Key: "key1", Value: "10", Type: "int"}
+		Request(server, http.MethodPost, "/system", dto, code)
+		response := Request(server, http.MethodPost, "/system", dto, code)
+
+		if response.Code != http.StatusConflict {
+			t.Fatalf("Expected status %d, got %d", http.StatusConflict, response.Code)
+		}
+	})
+}
+
+// Test GET /system?limit=&cursor=&sort=&type=.
+func TestSystemListHandler(t *testing.T) {
+	t.Run("Should list system variables a page at a time", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "operator", user.OperatorRole)
+		for _, key := range []string{"a", "b", "c"} {
+			Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: key, Value: "1", Type: "int"}, code)
+		}
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "d", Value: "x"}, code)
+
+		response := Request(server, http.MethodGet, "/system?type=int&sort=key&order=desc&limit=2&total=true", nil, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		var result []systemResponse
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if len(result) != 2 || result[0].Key != "c" || response.Header().Get("X-Total-Count") != "3" {
+			t.Fatal("Should return c, b and a total of 3")
+		}
+
+		cursor := response.Header().Get("X-Next-Cursor")
+		response = Request(server, http.MethodGet, "/system?type=int&sort=key&order=desc&limit=2&cursor="+cursor, nil, code)
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if len(result) != 1 || result[0].Key != "a" || response.Header().Get("X-Next-Cursor") != "" {
+			t.Fatal("Should return a on the last page")
+		}
+	})
+
+	t.Run("Should not list on a malformed page query", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "operator", user.OperatorRole)
+
+		for _, query := range []string{"limit=ten", "limit=100000", "sort=value", "cursor=x"} {
+			response := Request(server, http.MethodGet, "/system?"+query, nil, code)
+			if response.Code != http.StatusBadRequest {
+				t.Fatalf("%s expected status %d, got %d", query, http.StatusBadRequest, response.Code)
+			}
+		}
+	})
+}
+
+// Test GET /system/{key} and PUT /system/{key}.
+func TestSystemKeyHandler(t *testing.T) {
+	t.Run("Should update and get a system variable", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "operator", user.OperatorRole)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "key1", Value: "10", Type: "int"}, code)
+
+		response := Request(server, http.MethodPut, "/system/key1", &systemValueRequest{Value: "20"}, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		response = Request(server, http.MethodGet, "/system/key1", nil, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		var result systemResponse
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if result.Value != "20" {
+			t.Fatalf("Expected value to be 20, got %s", result.Value)
+		}
+	})
+
+	t.Run("Should not get a system variable when it doesn't exist", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "operator", user.OperatorRole)
+		response := Request(server, http.MethodGet, "/system/missing", nil, code)
+
+		if response.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d, got %d", http.StatusNotFound, response.Code)
+		}
+	})
+}
+
+// Test PUT /system/{key}/policy.
+func TestSystemPolicyHandler(t *testing.T) {
+	t.Run("Should restrict writes to the policy principals", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		admin := Login(server, "admin", user.AdminRole)
+		operator := Login(server, "operator", user.OperatorRole)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "rate", Value: "1"}, admin)
+
+		policy := &systemPolicyRequest{WritePolicy: "role:admin"}
+		response := Request(server, http.MethodPut, "/system/rate/policy", policy, admin)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		response = Request(server, http.MethodPut, "/system/rate", &systemValueRequest{Value: "2"}, operator)
+		if response.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, response.Code)
+		}
+	})
+
+	t.Run("Should not let anonymous callers write world-writable variables", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		admin := Login(server, "admin", user.AdminRole)
+		reader := Login(server, "reader", user.ReaderRole)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "rate", Value: "1", WritePolicy: system.Everyone}, admin)
+
+		for _, method := range []string{http.MethodPut, http.MethodDelete} {
+			response := Request(server, method, "/system/rate", &systemValueRequest{Value: "2"}, "")
+			if response.Code != http.StatusUnauthorized {
+				t.Fatalf("%s expected status %d, got %d", method, http.StatusUnauthorized, response.Code)
+			}
+		}
+
+		response := Request(server, http.MethodPut, "/system/rate", &systemValueRequest{Value: "2"}, reader)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+	})
+
+	t.Run("Should not let operators set policies", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		operator := Login(server, "operator", user.OperatorRole)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "rate", Value: "1"}, operator)
+
+		policy := &systemPolicyRequest{ReadPolicy: system.Everyone}
+		response := Request(server, http.MethodPut, "/system/rate/policy", policy, operator)
+		if response.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, response.Code)
+		}
+	})
+}
+
+// Test GET /system/{key}/history and POST /system/{key}/rollback.
+func TestSystemHistoryHandler(t *testing.T) {
+	t.Run("Should list history and roll back", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "operator", user.OperatorRole)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "rate", Value: "1", Type: "int"}, code)
+		Request(server, http.MethodPut, "/system/rate", &systemValueRequest{Value: "2", Reason: "promo"}, code)
+
+		response := Request(server, http.MethodPost, "/system/rate/rollback", &systemRollbackRequest{Version: 1}, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		response = Request(server, http.MethodGet, "/system/rate/history", nil, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		var result []system.HistoryEntry
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if len(result) != 3 || result[1].Reason != "promo" || result[2].NewValue != "1" {
+			t.Fatal("Should list the update and the rollback")
+		}
+	})
+}
+
+// Test GET /watch.
+func TestWatchHandler(t *testing.T) {
+	t.Run("Should stream changes of watched keys", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "operator", user.OperatorRole)
+
+		listener := httptest.NewServer(server)
+		defer listener.Close()
+
+		request, _ := http.NewRequest(http.MethodGet, listener.URL+"/watch?key=rate", nil)
+		request.Header.Set("Authorization", "Bearer "+code)
+
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+
+		if response.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("Expected an event stream, got %s", response.Header.Get("Content-Type"))
+		}
+
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "other", Value: "x", Type: "string"}, code)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "rate", Value: "1", Type: "int"}, code)
+
+		lines := make(chan string)
+		go func() {
+			scanner := bufio.NewScanner(response.Body)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			close(lines)
+		}()
+
+		expected := []string{"event: create", `data: {"key":"rate","action":"create","value":"1","type":"int"`}
+		for _, prefix := range expected {
+			select {
+			case line := <-lines:
+				if !strings.HasPrefix(line, prefix) {
+					t.Fatalf("Expected line %s, got %s", prefix, line)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Expected the change within a second")
+			}
+		}
+	})
+}
+
+// Test DELETE /system/{key}, POST /system/{key}/restore and POST /system/{key}/purge.
+func TestSystemDeleteHandler(t *testing.T) {
+	t.Run("Should delete, restore and purge system variables", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "admin", user.AdminRole)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "rate", Value: "1", Type: "int"}, code)
+
+		steps := []struct {
+			method string
+			path   string
+			body   any
+			status int
+		}{
+			{http.MethodDelete, "/system/rate", &systemReasonRequest{Reason: "unused"}, http.StatusNoContent},
+			{http.MethodGet, "/system/rate", nil, http.StatusNotFound},
+			{http.MethodPost, "/system/rate/restore", nil, http.StatusOK},
+			{http.MethodPost, "/system/rate/purge", nil, http.StatusNoContent},
+			{http.MethodPost, "/system/rate/restore", nil, http.StatusNotFound},
+		}
+
+		for _, step := range steps {
+			response := Request(server, step.method, step.path, step.body, code)
+			if response.Code != step.status {
+				t.Fatalf("%s %s expected status %d, got %d", step.method, step.path, step.status, response.Code)
+			}
+		}
+	})
+
+	t.Run("Should change the type along the value", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "operator", user.OperatorRole)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "timeout", Value: "30", Type: "int"}, code)
+
+		response := Request(server, http.MethodPut, "/system/timeout", &systemValueRequest{Value: "30s", Type: "duration"}, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		var result systemResponse
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if result.Type != "duration" {
+			t.Fatalf("Expected type duration, got %s", result.Type)
+		}
+	})
+}
+
+// Test GET /export and POST /import.
+func TestTransferHandler(t *testing.T) {
+	t.Run("Should export and import system variables", func(t *testing.T) {
+		staging, _ := CreateServer(t)
+		code := Login(staging, "operator", user.OperatorRole)
+		Request(staging, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "rate", Value: "1", Type: "int"}, code)
+
+		response := Request(staging, http.MethodGet, "/export?format=env", nil, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		production, _ := CreateServer(t)
+		code = Login(production, "operator", user.OperatorRole)
+
+		request := httptest.NewRequest(http.MethodPost, "/import?format=env&mode=replace&dry_run=true", response.Body)
+		request.Header.Set("Authorization", "Bearer "+code)
+		response = httptest.NewRecorder()
+		production.ServeHTTP(response, request)
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		var report system.ImportReport
+		json.NewDecoder(response.Body).Decode(&report)
+
+		if !report.DryRun || report.Count(system.CreateAction) != 1 {
+			t.Fatalf("Expected a dry run creating rate, got %+v", report)
+		}
+	})
+
+	t.Run("Should reject unsupported formats", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		response := Request(server, http.MethodGet, "/export?format=xml", nil, "")
+
+		if response.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, response.Code)
+		}
+	})
+
+	t.Run("Should reject import files over the limit", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		server.importLimit = 8
+		code := Login(server, "operator", user.OperatorRole)
+
+		request := httptest.NewRequest(http.MethodPost, "/import?format=env", strings.NewReader("rate=1\nbanner=hi\n"))
+		request.Header.Set("Authorization", "Bearer "+code)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		if response.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, response.Code)
+		}
+
+		if Request(server, http.MethodGet, "/system/rate", nil, code).Code != http.StatusNotFound {
+			t.Fatal("Should not import a truncated file")
+		}
+	})
+}
+
+// Test GET /system?prefix= and POST /system/{namespace}/move.
+func TestSystemNamespaceHandler(t *testing.T) {
+	t.Run("Should list, nest and move a namespace", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "operator", user.OperatorRole)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "billing.eu.rate", Value: "2", Type: "int"}, code)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "banner", Value: "hi", Type: "string"}, code)
+
+		var list []*systemResponse
+		json.NewDecoder(Request(server, http.MethodGet, "/system?prefix=billing", nil, code).Body).Decode(&list)
+		if len(list) != 1 || list[0].Key != "billing.eu.rate" {
+			t.Fatal("Should list the variables of the namespace")
+		}
+
+		var tree map[string]any
+		json.NewDecoder(Request(server, http.MethodGet, "/system?prefix=billing&nested=true", nil, code).Body).Decode(&tree)
+		if eu, ok := tree["eu"].(map[string]any); !ok || eu["rate"] != float64(2) {
+			t.Fatalf("Should nest the variables of the namespace, got %v", tree)
+		}
+
+		response := Request(server, http.MethodPost, "/system/billing/move", &systemMoveRequest{To: "invoicing"}, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		response = Request(server, http.MethodGet, "/system/invoicing.eu.rate", nil, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+	})
+
+	t.Run("Should reject malformed prefixes", func(t *testing.T) {
+		server, _ := CreateServer(t)
+
+		response := Request(server, http.MethodGet, "/system?prefix=billing..eu", nil, "")
+		if response.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnprocessableEntity, response.Code)
+		}
+	})
+}
+
+// Test POST /system/{key}/reveal.
+func TestSystemRevealHandler(t *testing.T) {
+	t.Run("Should reveal secrets masked otherwise", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Environment = config.Test
+		cfg.System.Secrets = config.SecretsConfig{KeysDir: t.TempDir(), MasterKey: "current"}
+		if _, err := system.GenerateMasterKey(cfg.System.Secrets.KeysDir, "current"); err != nil {
+			t.Fatal(err)
+		}
+
+		app, err := bootstrap.BootConfig(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer app.Close()
+
+		server := (&Server{}).New(app.UserService, app.SystemService, 0)
+		code := Login(server, "operator", user.OperatorRole)
+		Request(server, http.MethodPost, "/system", &system.SystemEnvDTO{Key: "api_key", Value: "s3cr3t", Type: "secret"}, code)
+
+		var masked systemResponse
+		json.NewDecoder(Request(server, http.MethodGet, "/system/api_key", nil, code).Body).Decode(&masked)
+		if masked.Value != system.SecretMask {
+			t.Fatalf("Expected masked value, got %s", masked.Value)
+		}
+
+		response := Request(server, http.MethodPost, "/system/api_key/reveal", &systemReasonRequest{Reason: "debug"}, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		var result systemSecretResponse
+		json.NewDecoder(response.Body).Decode(&result)
+		if result.Value != "s3cr3t" || response.Header().Get("Cache-Control") != "no-store" {
+			t.Fatal("Should return the secret uncached")
+		}
+	})
+}
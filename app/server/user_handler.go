@@ -0,0 +1,415 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"msim/app/shared"
+	"msim/app/user"
+)
+
+type userResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Role      user.Role `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type userRoleRequest struct {
+	Role user.Role `json:"role"`
+}
+
+// GET /users?prefix={name}&created_after={time}&created_before={time}: list
+// users a page at a time, see queryPage.
+// POST /users: register an user.
+func (server *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		server.handleUserList(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	var dto user.UserAuthDTO
+	if !readJSON(w, r, &dto) {
+		return
+	}
+
+	result, ex := server.userService.Register(&dto)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toUserResponse(result))
+}
+
+// List a page of users.
+func (server *Server) handleUserList(w http.ResponseWriter, r *http.Request) {
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	page, ok := queryPage(w, r)
+	if !ok {
+		return
+	}
+
+	after, ok := queryTime(w, r, "created_after")
+	if !ok {
+		return
+	}
+
+	before, ok := queryTime(w, r, "created_before")
+	if !ok {
+		return
+	}
+
+	result, ex := server.userService.List(actor, &user.UserListDTO{
+		UserFilter: user.UserFilter{
+			NamePrefix:    r.URL.Query().Get("prefix"),
+			CreatedAfter:  after,
+			CreatedBefore: before,
+		},
+		Page: page,
+	})
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	response := []*userResponse{}
+	for _, entity := range result.Items {
+		response = append(response, toUserResponse(entity))
+	}
+
+	writePageHeaders(w, result.NextCursor, result.Total)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// POST /login: login an user and return the authentication code and refresh token.
+func (server *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	var dto user.UserAuthDTO
+	if !readJSON(w, r, &dto) {
+		return
+	}
+
+	pair, ex := server.userService.Login(&dto)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, pair)
+}
+
+// POST /refresh: exchange a refresh token for a new code and refresh token.
+func (server *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	var dto user.RefreshDTO
+	if !readJSON(w, r, &dto) {
+		return
+	}
+
+	pair, ex := server.userService.Refresh(&dto)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, pair)
+}
+
+// GET /me: return the user authenticated by the bearer code.
+// DELETE /me: permanently delete the account of the authenticated user.
+func (server *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		methodNotAllowed(w)
+		return
+	}
+
+	result, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, toUserResponse(result))
+		return
+	}
+
+	var dto user.UserConfirmDTO
+	if !readJSON(w, r, &dto) {
+		return
+	}
+
+	if ex := server.userService.DeleteAccount(result, &dto); ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /me/password: change the password of the authenticated user.
+func (server *Server) handleMePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	var dto user.UserPasswordDTO
+	if !readJSON(w, r, &dto) {
+		return
+	}
+
+	if ex := server.userService.ChangePassword(actor, &dto); ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /me/name: rename the authenticated user.
+func (server *Server) handleMeName(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	var dto user.UserNameDTO
+	if !readJSON(w, r, &dto) {
+		return
+	}
+
+	result, ex := server.userService.Rename(actor, &dto)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toUserResponse(result))
+}
+
+// POST /logout: revoke the bearer code.
+func (server *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	auth, ex := bearer(r)
+	if ex == nil {
+		ex = server.userService.Logout(auth)
+	}
+
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /logout/all: revoke every code of the authenticated user.
+func (server *Server) handleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	auth, ex := bearer(r)
+	if ex == nil {
+		ex = server.userService.LogoutAll(auth)
+	}
+
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /users/{name}: soft delete an user.
+// PUT /users/{name}/role: set the role of an user.
+// POST /users/{name}/restore: restore a deleted user.
+// POST /users/{name}/purge: permanently delete an user.
+func (server *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/users/"), "/")
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "":
+		server.handleUserDelete(w, r, name)
+	case "role":
+		server.handleUserRole(w, r, name)
+	case "restore":
+		server.handleUserRestore(w, r, name)
+	case "purge":
+		server.handleUserPurge(w, r, name)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// DELETE /users/{name}: soft delete an user.
+func (server *Server) handleUserDelete(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	if _, ex := server.userService.Delete(actor, &user.UserNameDTO{Name: name}); ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /users/{name}/restore: restore a deleted user.
+func (server *Server) handleUserRestore(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	result, ex := server.userService.Restore(actor, &user.UserNameDTO{Name: name})
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toUserResponse(result))
+}
+
+// POST /users/{name}/purge: permanently delete an user.
+func (server *Server) handleUserPurge(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	if ex := server.userService.Purge(actor, &user.UserNameDTO{Name: name}); ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /users/{name}/role: set the role of an user.
+func (server *Server) handleUserRole(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPut {
+		methodNotAllowed(w)
+		return
+	}
+
+	actor, ex := server.authenticate(r)
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	var body userRoleRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	result, ex := server.userService.SetRole(actor, &user.UserRoleDTO{Name: name, Role: body.Role})
+	if ex != nil {
+		writeError(w, ex)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toUserResponse(result))
+}
+
+// PRIVATE:
+
+// Map user entity to response body.
+func toUserResponse(entity *user.UserEntity) *userResponse {
+	return &userResponse{ID: entity.ID, Name: entity.Name, Role: entity.Role, CreatedAt: entity.CreatedAt}
+}
+
+// Get authenticated user from "Authorization: Bearer <code>" header.
+func (server *Server) authenticate(r *http.Request) (*user.UserEntity, *shared.Exception) {
+	auth, ex := bearer(r)
+	if ex != nil {
+		return nil, ex
+	}
+
+	return server.userService.GetAuthUser(auth)
+}
+
+// Get authenticated user, nil without an "Authorization" header.
+func (server *Server) optionalAuthenticate(r *http.Request) (*user.UserEntity, *shared.Exception) {
+	if r.Header.Get("Authorization") == "" {
+		return nil, nil
+	}
+
+	return server.authenticate(r)
+}
+
+// Get code from "Authorization: Bearer <code>" header.
+func bearer(r *http.Request) (*user.AuthDTO, *shared.Exception) {
+	header := r.Header.Get("Authorization")
+	code, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || code == "" {
+		return nil, shared.DefaultException(shared.UNAUTHORIZED_EX, "missing or malformed token")
+	}
+
+	return &user.AuthDTO{Code: code}, nil
+}
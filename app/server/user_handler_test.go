@@ -0,0 +1,307 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"msim/app/shared"
+	"msim/app/user"
+)
+
+// Test POST /users.
+func TestRegisterHandler(t *testing.T) {
+	t.Run("Should register an user", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		response := Request(server, http.MethodPost, "/users", &user.UserAuthDTO{Name: "test", Password: "passwd"}, "")
+
+		if response.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d", http.StatusCreated, response.Code)
+		}
+
+		var result userResponse
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if result.Name != "test" || result.ID == uuid.Nil {
+			t.Fatal("Should return the created user")
+		}
+	})
+
+	t.Run("Should not register an invalid user", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		response := Request(server, http.MethodPost, "/users", &user.UserAuthDTO{Name: "test", Password: "p"}, "")
+
+		if response.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnprocessableEntity, response.Code)
+		}
+
+		var result shared.ErrorEnvelope
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if result.Tag != shared.MIN_LENGTH_EX || result.Field != "password" || len(result.Errors) != 1 {
+			t.Fatal("Should return the password error envelope listing its only error")
+		}
+	})
+}
+
+// Test POST /login and GET /me.
+func TestLoginHandler(t *testing.T) {
+	t.Run("Should login and get the authenticated user", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		dto := &user.UserAuthDTO{Name: "test", Password: "passwd"}
+		Request(server, http.MethodPost, "/users", dto, "")
+
+		response := Request(server, http.MethodPost, "/login", dto, "")
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		var login user.TokenPair
+		json.NewDecoder(response.Body).Decode(&login)
+
+		response = Request(server, http.MethodGet, "/me", nil, login.Code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		var result userResponse
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if result.Name != dto.Name {
+			t.Fatal("Should return the authenticated user")
+		}
+	})
+
+	t.Run("Should not get the authenticated user without a code", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		response := Request(server, http.MethodGet, "/me", nil, "")
+
+		if response.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, response.Code)
+		}
+	})
+}
+
+// Test POST /logout and POST /logout/all.
+func TestLogoutHandler(t *testing.T) {
+	for _, path := range []string{"/logout", "/logout/all"} {
+		t.Run("Should revoke the bearer code on "+path, func(t *testing.T) {
+			server, _ := CreateServer(t)
+			dto := &user.UserAuthDTO{Name: "test", Password: "passwd"}
+			Request(server, http.MethodPost, "/users", dto, "")
+
+			var login user.TokenPair
+			json.NewDecoder(Request(server, http.MethodPost, "/login", dto, "").Body).Decode(&login)
+
+			response := Request(server, http.MethodPost, path, nil, login.Code)
+			if response.Code != http.StatusNoContent {
+				t.Fatalf("Expected status %d, got %d", http.StatusNoContent, response.Code)
+			}
+
+			response = Request(server, http.MethodGet, "/me", nil, login.Code)
+			if response.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, response.Code)
+			}
+		})
+	}
+}
+
+// Test POST /refresh.
+func TestRefreshHandler(t *testing.T) {
+	t.Run("Should rotate the refresh token and reject its reuse", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		dto := &user.UserAuthDTO{Name: "test", Password: "passwd"}
+		Request(server, http.MethodPost, "/users", dto, "")
+
+		var login user.TokenPair
+		json.NewDecoder(Request(server, http.MethodPost, "/login", dto, "").Body).Decode(&login)
+
+		body := &user.RefreshDTO{RefreshToken: login.RefreshToken}
+		response := Request(server, http.MethodPost, "/refresh", body, "")
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		response = Request(server, http.MethodPost, "/refresh", body, "")
+		if response.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, response.Code)
+		}
+
+		var result shared.ErrorEnvelope
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if result.Tag != user.TOKEN_REUSED_EX {
+			t.Fatalf("Expected tag %s, got %s", user.TOKEN_REUSED_EX, result.Tag)
+		}
+	})
+}
+
+// Test PUT /users/{name}/role.
+func TestUserRoleHandler(t *testing.T) {
+	t.Run("Should let admins set roles", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "admin", user.AdminRole)
+		Login(server, "test", user.ReaderRole)
+
+		response := Request(server, http.MethodPut, "/users/test/role", &userRoleRequest{Role: user.OperatorRole}, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		var result userResponse
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if result.Name != "test" || result.Role != user.OperatorRole {
+			t.Fatal("Should return the user with its new role")
+		}
+	})
+
+	t.Run("Should not let operators set roles", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "operator", user.OperatorRole)
+
+		response := Request(server, http.MethodPut, "/users/operator/role", &userRoleRequest{Role: user.AdminRole}, code)
+		if response.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, response.Code)
+		}
+	})
+}
+
+// Test DELETE /users/{name}, POST /users/{name}/restore and POST /users/{name}/purge.
+func TestUserDeleteHandler(t *testing.T) {
+	t.Run("Should delete, restore and purge users", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "admin", user.AdminRole)
+		Login(server, "test", user.ReaderRole)
+
+		steps := []struct {
+			method string
+			path   string
+			status int
+		}{
+			{http.MethodDelete, "/users/test", http.StatusNoContent},
+			{http.MethodPost, "/users/test/restore", http.StatusOK},
+			{http.MethodPost, "/users/test/purge", http.StatusNoContent},
+			{http.MethodPost, "/users/test/restore", http.StatusNotFound},
+		}
+
+		for _, step := range steps {
+			response := Request(server, step.method, step.path, nil, code)
+			if response.Code != step.status {
+				t.Fatalf("%s %s expected status %d, got %d", step.method, step.path, step.status, response.Code)
+			}
+		}
+	})
+
+	t.Run("Should not route unknown user actions", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "admin", user.AdminRole)
+
+		response := Request(server, http.MethodPost, "/users/admin/unknown", nil, code)
+		if response.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d, got %d", http.StatusNotFound, response.Code)
+		}
+	})
+}
+
+// Test GET /users.
+func TestUserListHandler(t *testing.T) {
+	t.Run("Should list users a page at a time", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "admin", user.AdminRole)
+		Login(server, "alice", user.ReaderRole)
+		Login(server, "albert", user.ReaderRole)
+
+		response := Request(server, http.MethodGet, "/users?prefix=al&sort=name&limit=1&total=true", nil, code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		var result []userResponse
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if len(result) != 1 || result[0].Name != "albert" || response.Header().Get("X-Total-Count") != "2" {
+			t.Fatal("Should return albert and a total of 2")
+		}
+
+		cursor := response.Header().Get("X-Next-Cursor")
+		response = Request(server, http.MethodGet, "/users?prefix=al&sort=name&limit=1&cursor="+cursor, nil, code)
+		json.NewDecoder(response.Body).Decode(&result)
+
+		if len(result) != 1 || result[0].Name != "alice" || response.Header().Get("X-Next-Cursor") != "" {
+			t.Fatal("Should return alice on the last page")
+		}
+	})
+
+	t.Run("Should not list users on a malformed date", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "admin", user.AdminRole)
+
+		response := Request(server, http.MethodGet, "/users?created_after=yesterday", nil, code)
+		if response.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, response.Code)
+		}
+	})
+
+	t.Run("Should not let readers list users", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "reader", user.ReaderRole)
+
+		response := Request(server, http.MethodGet, "/users", nil, code)
+		if response.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, response.Code)
+		}
+	})
+}
+
+// Test PUT /me/password, PUT /me/name and DELETE /me.
+func TestAccountHandler(t *testing.T) {
+	t.Run("Should change password, rename and delete the account", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "test", user.ReaderRole)
+
+		response := Request(server, http.MethodPut, "/me/password", &user.UserPasswordDTO{Password: "passwd", NewPassword: "secret"}, code)
+		if response.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", http.StatusNoContent, response.Code)
+		}
+
+		response = Request(server, http.MethodPost, "/login", &user.UserAuthDTO{Name: "test", Password: "secret"}, "")
+		var login user.TokenPair
+		json.NewDecoder(response.Body).Decode(&login)
+
+		response = Request(server, http.MethodPut, "/me/name", &user.UserNameDTO{Name: "renamed"}, login.Code)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		var result userResponse
+		json.NewDecoder(response.Body).Decode(&result)
+		if result.Name != "renamed" {
+			t.Fatal("Should return the renamed user")
+		}
+
+		response = Request(server, http.MethodPost, "/login", &user.UserAuthDTO{Name: "renamed", Password: "secret"}, "")
+		json.NewDecoder(response.Body).Decode(&login)
+
+		response = Request(server, http.MethodDelete, "/me", &user.UserConfirmDTO{Password: "secret"}, login.Code)
+		if response.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", http.StatusNoContent, response.Code)
+		}
+
+		response = Request(server, http.MethodGet, "/me", nil, login.Code)
+		if response.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, response.Code)
+		}
+	})
+
+	t.Run("Should not change the password with a wrong one", func(t *testing.T) {
+		server, _ := CreateServer(t)
+		code := Login(server, "test", user.ReaderRole)
+
+		response := Request(server, http.MethodPut, "/me/password", &user.UserPasswordDTO{Password: "wrong", NewPassword: "secret"}, code)
+		if response.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, response.Code)
+		}
+	})
+}
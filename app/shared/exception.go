@@ -1,11 +1,13 @@
 package shared
 
+import "net/http"
+
 type ErrorTag string
 
 const (
 	MIN_LENGTH_EX      ErrorTag = "MIN_LENGTH"
-	MAX_LENGTH_EX      ErrorTag = "MIN_LENGTH"
-	ALREADY_CREATED_EX ErrorTag = "MIN_LENGTH"
+	MAX_LENGTH_EX      ErrorTag = "MAX_LENGTH"
+	ALREADY_CREATED_EX ErrorTag = "ALREADY_CREATED"
 	INTERNAL_EX        ErrorTag = "INTERNAL"
 	DEPENDENCY_EX      ErrorTag = "DEPENDENCY"
 	UNKNOWN_EX         ErrorTag = "UNKNOWN"
@@ -14,10 +16,38 @@ const (
 	NOT_FOUND_EX       ErrorTag = "NOT_FOUND_EX"
 )
 
+// Sentinel exceptions, errors.Is matches any exception with the same tag.
+var (
+	ErrMinLength      = &Exception{Tag: MIN_LENGTH_EX}
+	ErrMaxLength      = &Exception{Tag: MAX_LENGTH_EX}
+	ErrAlreadyCreated = &Exception{Tag: ALREADY_CREATED_EX}
+	ErrInternal       = &Exception{Tag: INTERNAL_EX}
+	ErrDependency     = &Exception{Tag: DEPENDENCY_EX}
+	ErrUnknown        = &Exception{Tag: UNKNOWN_EX}
+	ErrApplication    = &Exception{Tag: APPLICATION_EX}
+	ErrUnauthorized   = &Exception{Tag: UNAUTHORIZED_EX}
+	ErrNotFound       = &Exception{Tag: NOT_FOUND_EX}
+)
+
 type Exception struct {
 	Tag    ErrorTag
 	Field  string
 	Reason string
+	Cause  error
+	// Every exception joined by JoinExceptions, this one first.
+	Errors []*Exception
+}
+
+// Wire format of an exception, shared by every transport:
+//
+//	{"tag": "NOT_FOUND_EX", "field": "user", "reason": ""}
+//
+// Joined exceptions list every one of them under "errors".
+type ErrorEnvelope struct {
+	Tag    ErrorTag         `json:"tag"`
+	Field  string           `json:"field"`
+	Reason string           `json:"reason"`
+	Errors []*ErrorEnvelope `json:"errors,omitempty"`
 }
 
 // Create generic exception.
@@ -34,3 +64,73 @@ func FormException(tag ErrorTag, field string) *Exception {
 func InternalErrorException() *Exception {
 	return &Exception{Tag: INTERNAL_EX}
 }
+
+// Join exceptions reported at once, like every invalid field of a form.
+// Returns nil without exceptions, otherwise a copy of the first one
+// listing all of them in Errors.
+func JoinExceptions(exceptions ...*Exception) *Exception {
+	if len(exceptions) == 0 {
+		return nil
+	}
+
+	joined := *exceptions[0]
+	joined.Errors = exceptions
+	return &joined
+}
+
+// Set the underlying cause of exception.
+func (e *Exception) Wrap(cause error) *Exception {
+	e.Cause = cause
+	return e
+}
+
+// Describe exception and its cause.
+func (e *Exception) Error() string {
+	message := string(e.Tag)
+	if e.Field != "" {
+		message += " " + e.Field
+	}
+	if e.Reason != "" {
+		message += ": " + e.Reason
+	}
+	if e.Cause != nil {
+		message += ": " + e.Cause.Error()
+	}
+
+	return message
+}
+
+// Return the underlying cause.
+func (e *Exception) Unwrap() error {
+	return e.Cause
+}
+
+// Report whether target is an exception with the same tag.
+func (e *Exception) Is(target error) bool {
+	ex, ok := target.(*Exception)
+	return ok && ex.Tag == e.Tag
+}
+
+// Get HTTP status code for tag, unknown tags are internal errors.
+func StatusCode(tag ErrorTag) int {
+	if info, ok := LookupTag(tag); ok {
+		return info.Status
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Get HTTP status code for exception.
+func (e *Exception) StatusCode() int {
+	return StatusCode(e.Tag)
+}
+
+// Get exception wire format.
+func (e *Exception) Envelope() *ErrorEnvelope {
+	envelope := &ErrorEnvelope{Tag: e.Tag, Field: e.Field, Reason: e.Reason}
+	for _, ex := range e.Errors {
+		envelope.Errors = append(envelope.Errors, ex.Envelope())
+	}
+
+	return envelope
+}
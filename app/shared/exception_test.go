@@ -0,0 +1,145 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// Test StatusCode.
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		tag    ErrorTag
+		status int
+	}{
+		{MIN_LENGTH_EX, http.StatusUnprocessableEntity},
+		{MAX_LENGTH_EX, http.StatusUnprocessableEntity},
+		{ALREADY_CREATED_EX, http.StatusConflict},
+		{INTERNAL_EX, http.StatusInternalServerError},
+		{DEPENDENCY_EX, http.StatusBadGateway},
+		{UNKNOWN_EX, http.StatusInternalServerError},
+		{APPLICATION_EX, http.StatusBadRequest},
+		{UNAUTHORIZED_EX, http.StatusUnauthorized},
+		{NOT_FOUND_EX, http.StatusNotFound},
+		{ErrorTag("NOT_REGISTERED"), http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.tag), func(t *testing.T) {
+			if result := StatusCode(test.tag); result != test.status {
+				t.Fatalf("StatusCode(%s) returns %d, expects %d", test.tag, result, test.status)
+			}
+
+			ex := DefaultException(test.tag, "reason")
+			if result := ex.StatusCode(); result != test.status {
+				t.Fatalf("Exception.StatusCode() returns %d, expects %d", result, test.status)
+			}
+		})
+	}
+}
+
+// Test Envelope.
+func TestEnvelope(t *testing.T) {
+	tests := []struct {
+		name     string
+		ex       *Exception
+		expected string
+	}{
+		{"form", FormException(MIN_LENGTH_EX, "name"), `{"tag":"MIN_LENGTH","field":"name","reason":""}`},
+		{"default", DefaultException(NOT_FOUND_EX, "env"), `{"tag":"NOT_FOUND_EX","field":"","reason":"env"}`},
+		{"internal", InternalErrorException(), `{"tag":"INTERNAL","field":"","reason":""}`},
+		{
+			"joined",
+			JoinExceptions(FormException(MIN_LENGTH_EX, "password"), FormException(MIN_LENGTH_EX, "name")),
+			`{"tag":"MIN_LENGTH","field":"password","reason":"","errors":[` +
+				`{"tag":"MIN_LENGTH","field":"password","reason":""},{"tag":"MIN_LENGTH","field":"name","reason":""}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, _ := json.Marshal(test.ex.Envelope())
+
+			if string(result) != test.expected {
+				t.Fatalf("Envelope() encodes to %s, expects %s", result, test.expected)
+			}
+		})
+	}
+}
+
+// Test errors.Is and errors.As support.
+func TestExceptionError(t *testing.T) {
+	tests := []struct {
+		ex       *Exception
+		sentinel *Exception
+	}{
+		{FormException(MIN_LENGTH_EX, "name"), ErrMinLength},
+		{FormException(MAX_LENGTH_EX, "name"), ErrMaxLength},
+		{DefaultException(ALREADY_CREATED_EX, "user"), ErrAlreadyCreated},
+		{InternalErrorException(), ErrInternal},
+		{DefaultException(DEPENDENCY_EX, "db"), ErrDependency},
+		{DefaultException(UNKNOWN_EX, "hash"), ErrUnknown},
+		{DefaultException(APPLICATION_EX, "body"), ErrApplication},
+		{FormException(UNAUTHORIZED_EX, "password"), ErrUnauthorized},
+		{FormException(NOT_FOUND_EX, "user"), ErrNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.ex.Tag), func(t *testing.T) {
+			var err error = fmt.Errorf("handler: %w", test.ex)
+
+			if !errors.Is(err, test.sentinel) {
+				t.Fatalf("errors.Is(%s, sentinel) expects true", test.ex.Tag)
+			}
+
+			for _, other := range tests {
+				if other.sentinel != test.sentinel && errors.Is(err, other.sentinel) {
+					t.Fatalf("errors.Is(%s, %s) expects false", test.ex.Tag, other.sentinel.Tag)
+				}
+			}
+
+			var ex *Exception
+			if !errors.As(err, &ex) || ex != test.ex {
+				t.Fatal("errors.As should find the exception")
+			}
+		})
+	}
+
+	t.Run("Should unwrap the cause", func(t *testing.T) {
+		cause := errors.New("record not found")
+		ex := FormException(NOT_FOUND_EX, "user").Wrap(cause)
+
+		if !errors.Is(ex, cause) || !errors.Is(ex, ErrNotFound) {
+			t.Fatal("Should match both the cause and the sentinel")
+		}
+
+		expected := "NOT_FOUND_EX user: record not found"
+		if ex.Error() != expected {
+			t.Fatalf("Error() returns %q, expects %q", ex.Error(), expected)
+		}
+	})
+}
+
+// Test JoinExceptions.
+func TestJoinExceptions(t *testing.T) {
+	t.Run("Should return nil without exceptions", func(t *testing.T) {
+		if JoinExceptions() != nil {
+			t.Fatal("JoinExceptions() expects nil")
+		}
+	})
+
+	t.Run("Should match the first exception and keep every one", func(t *testing.T) {
+		first := FormException(MIN_LENGTH_EX, "password")
+		joined := JoinExceptions(first, FormException(MAX_LENGTH_EX, "name"))
+
+		if !errors.Is(joined, ErrMinLength) || joined.Field != "password" || len(joined.Errors) != 2 {
+			t.Fatalf("JoinExceptions() returns %v, expects the first exception with 2 errors", joined)
+		}
+
+		if first.Errors != nil {
+			t.Fatal("JoinExceptions() must not change the first exception")
+		}
+	})
+}
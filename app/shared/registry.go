@@ -0,0 +1,82 @@
+package shared
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+type TagInfo struct {
+	Tag         ErrorTag
+	Description string
+	Status      int
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = map[ErrorTag]TagInfo{}
+)
+
+func init() {
+	MustRegisterTag(MIN_LENGTH_EX, "value is shorter than the minimum length", http.StatusUnprocessableEntity)
+	MustRegisterTag(MAX_LENGTH_EX, "value is longer than the maximum length", http.StatusUnprocessableEntity)
+	MustRegisterTag(ALREADY_CREATED_EX, "resource already exists", http.StatusConflict)
+	MustRegisterTag(INTERNAL_EX, "internal error", http.StatusInternalServerError)
+	MustRegisterTag(DEPENDENCY_EX, "external dependency failed", http.StatusBadGateway)
+	MustRegisterTag(UNKNOWN_EX, "unknown error", http.StatusInternalServerError)
+	MustRegisterTag(APPLICATION_EX, "malformed request", http.StatusBadRequest)
+	MustRegisterTag(UNAUTHORIZED_EX, "missing or invalid credentials", http.StatusUnauthorized)
+	MustRegisterTag(NOT_FOUND_EX, "resource not found", http.StatusNotFound)
+}
+
+// Register tag with a description and its default HTTP status,
+// fails when the tag wire value is already registered.
+func RegisterTag(tag ErrorTag, description string, status int) error {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if tag == "" {
+		return fmt.Errorf("error tag must not be empty")
+	}
+
+	if info, ok := registry[tag]; ok {
+		return fmt.Errorf("error tag %q already registered as %q", tag, info.Description)
+	}
+
+	registry[tag] = TagInfo{Tag: tag, Description: description, Status: status}
+	return nil
+}
+
+// Register tag, panic when it's already registered.
+// Meant to be called from package init so duplicates fail at startup.
+func MustRegisterTag(tag ErrorTag, description string, status int) ErrorTag {
+	if err := RegisterTag(tag, description, status); err != nil {
+		panic(err)
+	}
+
+	return tag
+}
+
+// Get registered tag info.
+func LookupTag(tag ErrorTag) (TagInfo, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	info, ok := registry[tag]
+	return info, ok
+}
+
+// Get all registered tags sorted by wire value.
+func Tags() []TagInfo {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	tags := make([]TagInfo, 0, len(registry))
+	for _, info := range registry {
+		tags = append(tags, info)
+	}
+
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	return tags
+}
@@ -0,0 +1,74 @@
+package shared
+
+import (
+	"net/http"
+	"testing"
+)
+
+// Test core tags registration.
+func TestTags(t *testing.T) {
+	t.Run("Should register every core tag with a distinct wire value", func(t *testing.T) {
+		core := []ErrorTag{
+			MIN_LENGTH_EX,
+			MAX_LENGTH_EX,
+			ALREADY_CREATED_EX,
+			INTERNAL_EX,
+			DEPENDENCY_EX,
+			UNKNOWN_EX,
+			APPLICATION_EX,
+			UNAUTHORIZED_EX,
+			NOT_FOUND_EX,
+		}
+
+		seen := map[ErrorTag]bool{}
+		for _, tag := range core {
+			if seen[tag] {
+				t.Fatalf("Tag %s is declared twice", tag)
+			}
+			seen[tag] = true
+
+			if info, ok := LookupTag(tag); !ok || info.Description == "" {
+				t.Fatalf("Tag %s should be registered with a description", tag)
+			}
+		}
+
+		if len(Tags()) < len(core) {
+			t.Fatalf("Tags() returns %d tags, expects at least %d", len(Tags()), len(core))
+		}
+	})
+}
+
+// Test RegisterTag.
+func TestRegisterTag(t *testing.T) {
+	t.Run("Should register a new tag", func(t *testing.T) {
+		tag := ErrorTag("TEST_REGISTER_EX")
+
+		if err := RegisterTag(tag, "test tag", http.StatusTeapot); err != nil {
+			t.Fatal(err)
+		}
+
+		if StatusCode(tag) != http.StatusTeapot {
+			t.Fatalf("StatusCode(%s) returns %d, expects %d", tag, StatusCode(tag), http.StatusTeapot)
+		}
+	})
+
+	t.Run("Should not register a duplicated tag", func(t *testing.T) {
+		if err := RegisterTag(NOT_FOUND_EX, "duplicate", http.StatusNotFound); err == nil {
+			t.Fatal("RegisterTag() expects error on duplicated tag")
+		}
+
+		if info, _ := LookupTag(NOT_FOUND_EX); info.Description == "duplicate" {
+			t.Fatal("RegisterTag() must keep the first registration")
+		}
+	})
+
+	t.Run("Should panic on duplicated tag", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("MustRegisterTag() expects panic on duplicated tag")
+			}
+		}()
+
+		MustRegisterTag(MIN_LENGTH_EX, "duplicate", http.StatusBadRequest)
+	})
+}
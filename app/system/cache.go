@@ -0,0 +1,140 @@
+package system
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type cacheEntry struct {
+	entity  SystemEntity
+	expires time.Time
+}
+
+// Read-through cache of system variables by key, entries expire after ttl.
+// Methods on a nil cache do nothing, so a nil cache disables caching.
+type Cache struct {
+	ttl     time.Duration
+	mutex   sync.RWMutex
+	entries map[string]cacheEntry
+	// Counter bumped on every invalidation, generation of a key is the last
+	// bump of the key or of the whole cache.
+	version     uint64
+	cleared     uint64
+	generations map[string]uint64
+	hits        atomic.Int64
+	misses      atomic.Int64
+}
+
+// Hits and misses of a cache since its creation.
+type CacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	Size   int   `json:"size"`
+}
+
+// Create a Cache instance, nil when ttl isn't positive.
+func (cache *Cache) New(ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &Cache{ttl: ttl, entries: map[string]cacheEntry{}, generations: map[string]uint64{}}
+}
+
+// Get a copy of the cached variable of key.
+func (cache *Cache) Get(key string) (*SystemEntity, bool) {
+	if cache == nil {
+		return nil, false
+	}
+
+	cache.mutex.RLock()
+	entry, ok := cache.entries[key]
+	cache.mutex.RUnlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		cache.misses.Add(1)
+		return nil, false
+	}
+
+	cache.hits.Add(1)
+	entity := entry.entity
+	return &entity, true
+}
+
+// Get generation of key, taken before reading the variable to cache.
+func (cache *Cache) Generation(key string) uint64 {
+	if cache == nil {
+		return 0
+	}
+
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+
+	return cache.generation(key)
+}
+
+// Cache a copy of entity read at generation, skipped when the key was
+// invalidated since, as the read may predate the write.
+func (cache *Cache) Set(entity *SystemEntity, generation uint64) {
+	if cache == nil {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.generation(entity.Key) != generation {
+		return
+	}
+
+	cache.entries[entity.Key] = cacheEntry{entity: *entity, expires: time.Now().Add(cache.ttl)}
+}
+
+// Drop cached variable of key.
+func (cache *Cache) Invalidate(key string) {
+	if cache == nil {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.version++
+	cache.generations[key] = cache.version
+	delete(cache.entries, key)
+}
+
+// Drop every cached variable.
+func (cache *Cache) Clear() {
+	if cache == nil {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.version++
+	cache.cleared = cache.version
+	cache.generations = map[string]uint64{}
+	cache.entries = map[string]cacheEntry{}
+}
+
+// Get hits, misses and size of cache.
+func (cache *Cache) Stats() CacheStats {
+	if cache == nil {
+		return CacheStats{}
+	}
+
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+
+	return CacheStats{Hits: cache.hits.Load(), Misses: cache.misses.Load(), Size: len(cache.entries)}
+}
+
+// PRIVATE:
+
+// Get generation of key, the caller holds the mutex.
+func (cache *Cache) generation(key string) uint64 {
+	return max(cache.generations[key], cache.cleared)
+}
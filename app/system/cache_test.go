@@ -0,0 +1,135 @@
+package system
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Test Cache.
+func TestCache(t *testing.T) {
+	t.Run("Should count hits and misses", func(t *testing.T) {
+		cache := (&Cache{}).New(time.Minute)
+
+		cache.Get("rate")
+		cache.Set(&SystemEntity{Key: "rate", Value: "1"}, cache.Generation("rate"))
+		entity, ok := cache.Get("rate")
+
+		if !ok || entity.Value != "1" {
+			t.Fatal("Should get the cached variable")
+		}
+
+		if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Size != 1 {
+			t.Fatalf("Expected 1 hit, 1 miss and 1 entry, got %+v", stats)
+		}
+	})
+
+	t.Run("Should expire entries after ttl", func(t *testing.T) {
+		cache := (&Cache{}).New(time.Millisecond)
+		cache.Set(&SystemEntity{Key: "rate", Value: "1"}, cache.Generation("rate"))
+		time.Sleep(2 * time.Millisecond)
+
+		if _, ok := cache.Get("rate"); ok {
+			t.Fatal("Should not get an expired variable")
+		}
+	})
+
+	t.Run("Should not cache reads older than an invalidation", func(t *testing.T) {
+		cache := (&Cache{}).New(time.Minute)
+
+		for _, invalidate := range []func(){func() { cache.Invalidate("rate") }, cache.Clear} {
+			generation := cache.Generation("rate")
+			invalidate()
+			cache.Set(&SystemEntity{Key: "rate", Value: "1"}, generation)
+
+			if _, ok := cache.Get("rate"); ok {
+				t.Fatal("Should not cache a variable read before its invalidation")
+			}
+		}
+
+		cache.Invalidate("limit")
+		cache.Set(&SystemEntity{Key: "rate", Value: "1"}, cache.Generation("rate"))
+		if _, ok := cache.Get("rate"); !ok {
+			t.Fatal("Should cache a variable when other keys are invalidated")
+		}
+	})
+
+	t.Run("Should not cache without ttl", func(t *testing.T) {
+		cache := (&Cache{}).New(0)
+		cache.Set(&SystemEntity{Key: "rate", Value: "1"}, cache.Generation("rate"))
+
+		if _, ok := cache.Get("rate"); ok {
+			t.Fatal("Should not get a variable from a disabled cache")
+		}
+	})
+}
+
+// Test GetByKey through the cache.
+func TestCachedService(t *testing.T) {
+	t.Run("Should serve lookups from the cache", func(t *testing.T) {
+		service, DB := CreateCachedSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+
+		service.GetByKey(reader, &SystemKeyDTO{Key: "rate"})
+		DB.Model(&System{}).Where("key = ?", "rate").Update("value", "9")
+		result, _ := service.GetByKey(reader, &SystemKeyDTO{Key: "rate"})
+
+		if result.Value != "1" {
+			t.Fatalf("Expected cached value 1, got %s", result.Value)
+		}
+
+		if stats := service.CacheStats(); stats.Hits != 1 || stats.Misses != 1 {
+			t.Fatalf("Expected 1 hit and 1 miss, got %+v", stats)
+		}
+	})
+
+	t.Run("Should invalidate the key on local writes", func(t *testing.T) {
+		service, _ := CreateCachedSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+		service.GetByKey(reader, &SystemKeyDTO{Key: "rate"})
+
+		service.UpdateValueByKey(operator, &SystemKeyUpdateDTO{Key: "rate", Value: "2"})
+		result, _ := service.GetByKey(reader, &SystemKeyDTO{Key: "rate"})
+
+		if result.Value != "2" {
+			t.Fatalf("Expected updated value 2, got %s", result.Value)
+		}
+	})
+
+	t.Run("Should not let callers modify cached variables", func(t *testing.T) {
+		service, _ := CreateCachedSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+		service.GetByKey(reader, &SystemKeyDTO{Key: "rate"})
+
+		result, _ := service.GetByKey(reader, &SystemKeyDTO{Key: "rate"})
+		result.Value = "9"
+		result, _ = service.GetByKey(reader, &SystemKeyDTO{Key: "rate"})
+
+		if result.Value != "1" {
+			t.Fatalf("Expected cached value 1, got %s", result.Value)
+		}
+	})
+}
+
+// Compare lookups by key on the repository and through the cache.
+func BenchmarkGetByKey(b *testing.B) {
+	service, _ := CreateCachedSystemService(b)
+	service.systemRepository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "1", Type: "int"}, nil)
+
+	b.Run("Repository", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := service.systemRepository.GetByKey("rate"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, ex := service.GetByKey(reader, &SystemKeyDTO{Key: "rate"}); ex != nil {
+				b.Fatal(ex)
+			}
+		}
+	})
+}
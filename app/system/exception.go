@@ -0,0 +1,21 @@
+package system
+
+import (
+	"net/http"
+
+	"msim/app/shared"
+)
+
+// Error tags of the system module.
+var (
+	INVALID_TYPE_EX  = shared.MustRegisterTag("INVALID_TYPE", "unsupported type or type mismatch", http.StatusUnprocessableEntity)
+	INVALID_VALUE_EX = shared.MustRegisterTag("INVALID_VALUE", "value doesn't match its type", http.StatusUnprocessableEntity)
+	INVALID_KEY_EX   = shared.MustRegisterTag("INVALID_KEY", "malformed key or namespace", http.StatusUnprocessableEntity)
+)
+
+// Sentinel exceptions of the system module.
+var (
+	ErrInvalidType  = &shared.Exception{Tag: INVALID_TYPE_EX}
+	ErrInvalidValue = &shared.Exception{Tag: INVALID_VALUE_EX}
+	ErrInvalidKey   = &shared.Exception{Tag: INVALID_KEY_EX}
+)
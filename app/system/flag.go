@@ -0,0 +1,133 @@
+package system
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"msim/app/user"
+)
+
+// Reasons of a flag evaluation.
+const (
+	// Boolean variable, the same for every user.
+	BooleanReason = "boolean"
+	// Flag turned off for every user.
+	DisabledReason = "disabled"
+	// User is in the deny list.
+	DeniedReason = "denied"
+	// User is in the allow list.
+	AllowedReason = "allowed"
+	// User falls inside the rollout percentage.
+	RolloutReason = "rollout"
+	// User falls outside the rollout percentage, or is anonymous.
+	ExcludedReason = "excluded"
+)
+
+// Buckets users are hashed into, giving rollouts a 0.01% precision.
+const flagBuckets = 10000
+
+// Rules of a flag variable, stored as its JSON value. Deny wins over allow,
+// allow over the rollout percentage.
+type Flag struct {
+	Enabled bool        `json:"enabled"`
+	Rollout float64     `json:"rollout"`
+	Allow   []uuid.UUID `json:"allow,omitempty"`
+	Deny    []uuid.UUID `json:"deny,omitempty"`
+}
+
+// Outcome of a flag for an user.
+type FlagEvaluation struct {
+	Key     string `json:"key"`
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// Parse flag rules, rollout defaults to 100 and unknown fields are rejected.
+func ParseFlag(value string) (*Flag, error) {
+	flag := &Flag{Rollout: 100}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(flag); err != nil || decoder.More() {
+		return nil, errors.New(`expects flag rules like {"enabled": true, "rollout": 25}`)
+	}
+
+	if flag.Rollout < 0 || flag.Rollout > 100 {
+		return nil, fmt.Errorf("rollout %g is not a percentage", flag.Rollout)
+	}
+
+	return flag, nil
+}
+
+// Evaluate flag key for actor. Rollouts hash the key with the user id so a
+// given user keeps its outcome while the percentage grows, anonymous actors
+// are only included in full rollouts.
+func (f *Flag) Evaluate(key string, actor *user.UserEntity) *FlagEvaluation {
+	evaluation := &FlagEvaluation{Key: key}
+
+	switch {
+	case !f.Enabled:
+		evaluation.Reason = DisabledReason
+	case actor != nil && slices.Contains(f.Deny, actor.ID):
+		evaluation.Reason = DeniedReason
+	case actor != nil && slices.Contains(f.Allow, actor.ID):
+		evaluation.Enabled, evaluation.Reason = true, AllowedReason
+	case f.Rollout >= 100 || (actor != nil && float64(bucket(key, actor.ID)) < f.Rollout*flagBuckets/100):
+		evaluation.Enabled, evaluation.Reason = true, RolloutReason
+	default:
+		evaluation.Reason = ExcludedReason
+	}
+
+	return evaluation
+}
+
+// Return rules of a flag variable.
+func (s *SystemEntity) AsFlag() (*Flag, error) {
+	if _, err := s.expect(FlagType); err != nil {
+		return nil, err
+	}
+
+	flag, err := ParseFlag(s.Value)
+	if err != nil {
+		return nil, s.invalidValue(err)
+	}
+
+	return flag, nil
+}
+
+// PRIVATE:
+
+// Evaluate flag or boolean variable for actor.
+func (s *SystemEntity) evaluate(actor *user.UserEntity) (*FlagEvaluation, error) {
+	spec, err := s.expect(FlagType, BooleanType)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.Base == BooleanType {
+		enabled, err := s.AsBool()
+		if err != nil {
+			return nil, err
+		}
+		return &FlagEvaluation{Key: s.Key, Enabled: enabled, Reason: BooleanReason}, nil
+	}
+
+	flag, err := s.AsFlag()
+	if err != nil {
+		return nil, err
+	}
+
+	return flag.Evaluate(s.Key, actor), nil
+}
+
+// Get stable bucket of user id for flag key.
+func bucket(key string, id uuid.UUID) uint64 {
+	sum := sha256.Sum256(append([]byte(key+":"), id[:]...))
+	return binary.BigEndian.Uint64(sum[:8]) % flagBuckets
+}
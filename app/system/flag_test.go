@@ -0,0 +1,105 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"msim/app/user"
+)
+
+// Test ParseFlag.
+func TestParseFlag(t *testing.T) {
+	t.Run("Should default rollout to every user", func(t *testing.T) {
+		flag, err := ParseFlag(`{"enabled": true}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if flag.Rollout != 100 {
+			t.Fatalf("Expected rollout 100, got %g", flag.Rollout)
+		}
+	})
+
+	t.Run("Should reject malformed rules", func(t *testing.T) {
+		cases := []string{
+			`{"enabled": true, "rollout": 150}`,
+			`{"enabled": true, "rolout": 10}`,
+			`{"allow": ["nope"]}`,
+			`{"enabled": true} {}`,
+			`true`,
+		}
+
+		for _, value := range cases {
+			if _, err := ParseFlag(value); err == nil {
+				t.Fatalf("ParseFlag(%s) expects error", value)
+			}
+		}
+	})
+}
+
+// Test Flag.Evaluate.
+func TestEvaluateFlag(t *testing.T) {
+	t.Run("Should apply deny, then allow, then rollout", func(t *testing.T) {
+		allowed := &user.UserEntity{ID: uuid.New()}
+		denied := &user.UserEntity{ID: uuid.New()}
+		flag := &Flag{Enabled: true, Rollout: 100, Allow: []uuid.UUID{allowed.ID, denied.ID}, Deny: []uuid.UUID{denied.ID}}
+
+		if evaluation := flag.Evaluate("beta", denied); evaluation.Enabled || evaluation.Reason != DeniedReason {
+			t.Fatal("Should deny users of the deny list")
+		}
+
+		flag.Rollout = 0
+		if evaluation := flag.Evaluate("beta", allowed); !evaluation.Enabled || evaluation.Reason != AllowedReason {
+			t.Fatal("Should allow users of the allow list")
+		}
+
+		flag.Enabled = false
+		if evaluation := flag.Evaluate("beta", allowed); evaluation.Enabled || evaluation.Reason != DisabledReason {
+			t.Fatal("Should disable the flag for everyone")
+		}
+	})
+
+	t.Run("Should roll out to a stable share of users", func(t *testing.T) {
+		flag := &Flag{Enabled: true, Rollout: 25}
+
+		enabled := 0
+		for i := 0; i < 4000; i++ {
+			actor := &user.UserEntity{ID: uuid.New()}
+			first := flag.Evaluate("beta", actor)
+			if first.Enabled != flag.Evaluate("beta", actor).Enabled {
+				t.Fatal("Should evaluate the same user the same way")
+			}
+
+			if first.Enabled {
+				enabled++
+			}
+		}
+
+		if enabled < 800 || enabled > 1200 {
+			t.Fatalf("Expected about 1000 enabled users, got %d", enabled)
+		}
+	})
+
+	t.Run("Should keep enabled users while the rollout grows", func(t *testing.T) {
+		actor := &user.UserEntity{ID: uuid.New()}
+
+		enabled := false
+		for rollout := 0.0; rollout <= 100; rollout += 5 {
+			result := (&Flag{Enabled: true, Rollout: rollout}).Evaluate("beta", actor).Enabled
+			if enabled && !result {
+				t.Fatalf("Should stay enabled at rollout %g", rollout)
+			}
+			enabled = result
+		}
+	})
+
+	t.Run("Should only include anonymous users in full rollouts", func(t *testing.T) {
+		if (&Flag{Enabled: true, Rollout: 99.99}).Evaluate("beta", nil).Enabled {
+			t.Fatal("Should exclude anonymous users")
+		}
+
+		if !(&Flag{Enabled: true, Rollout: 100}).Evaluate("beta", nil).Enabled {
+			t.Fatal("Should include anonymous users")
+		}
+	})
+}
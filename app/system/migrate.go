@@ -1,11 +1,184 @@
 package system
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"msim/db"
+)
 
-func Migrate(db *gorm.DB) {
-	db.AutoMigrate(&System{})
+// Schema migrations of the system module.
+var Migrations = []db.Migration{
+	{
+		Version: 2023090201,
+		Name:    "create_systems",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS systems (
+				id uuid PRIMARY KEY,
+				created_at timestamp,
+				updated_at timestamp,
+				deleted_at timestamp,
+				key text,
+				value text,
+				type text
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_systems_key ON systems (key)`,
+			`CREATE INDEX IF NOT EXISTS idx_systems_deleted_at ON systems (deleted_at)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS systems`,
+		},
+	},
+	{
+		Version: 2026101805,
+		Name:    "add_systems_policies",
+		Up: []string{
+			`ALTER TABLE systems ADD COLUMN read_policy text NOT NULL DEFAULT ''`,
+			`ALTER TABLE systems ADD COLUMN write_policy text NOT NULL DEFAULT ''`,
+		},
+		Down: []string{
+			`ALTER TABLE systems DROP COLUMN write_policy`,
+			`ALTER TABLE systems DROP COLUMN read_policy`,
+		},
+	},
+	{
+		Version: 2026101806,
+		Name:    "normalize_systems_type",
+		// Legacy types were free text read as strings unless int, float or
+		// boolean, so aliases map to their type and the rest to string.
+		// Original types are kept to be restored on rows still unchanged.
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS systems_legacy_types (
+				id uuid PRIMARY KEY,
+				type text,
+				normalized text
+			)`,
+			`INSERT INTO systems_legacy_types (id, type)
+				SELECT id, type FROM systems
+				WHERE type IS NULL OR type NOT IN ('string', 'int', 'float', 'boolean', 'duration', 'json')`,
+			`UPDATE systems SET type = CASE lower(trim(type))
+					WHEN 'int' THEN 'int'
+					WHEN 'integer' THEN 'int'
+					WHEN 'float' THEN 'float'
+					WHEN 'number' THEN 'float'
+					WHEN 'double' THEN 'float'
+					WHEN 'boolean' THEN 'boolean'
+					WHEN 'bool' THEN 'boolean'
+					WHEN 'duration' THEN 'duration'
+					WHEN 'json' THEN 'json'
+					ELSE 'string'
+				END
+				WHERE id IN (SELECT id FROM systems_legacy_types)`,
+			`UPDATE systems_legacy_types SET normalized = (
+				SELECT type FROM systems WHERE systems.id = systems_legacy_types.id
+			)`,
+		},
+		Down: []string{
+			`UPDATE systems SET type = (
+					SELECT type FROM systems_legacy_types WHERE systems_legacy_types.id = systems.id
+				)
+				WHERE EXISTS (
+					SELECT 1 FROM systems_legacy_types
+					WHERE systems_legacy_types.id = systems.id AND systems_legacy_types.normalized = systems.type
+				)`,
+			`DROP TABLE IF EXISTS systems_legacy_types`,
+		},
+	},
+	{
+		Version: 2026101807,
+		Name:    "create_system_history",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS system_history (
+				id uuid PRIMARY KEY,
+				key text NOT NULL,
+				version integer NOT NULL,
+				action text NOT NULL,
+				old_value text NOT NULL DEFAULT '',
+				new_value text NOT NULL DEFAULT '',
+				actor_id uuid,
+				actor_name text NOT NULL DEFAULT '',
+				reason text NOT NULL DEFAULT '',
+				created_at timestamp NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_system_history_key_version ON system_history (key, version)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS system_history`,
+		},
+	},
+	{
+		Version: 2026101808,
+		Name:    "unique_live_systems_key",
+		// Databases created by AutoMigrate hold an inline UNIQUE on key, kept
+		// by sqlite until the table is rebuilt and named systems_key_key on
+		// PostgreSQL.
+		DialectUp: map[string][]string{
+			db.Sqlite: {
+				`CREATE TABLE systems_rebuild AS SELECT * FROM systems`,
+				`DROP TABLE systems`,
+				`CREATE TABLE systems (
+					id uuid PRIMARY KEY,
+					created_at timestamp,
+					updated_at timestamp,
+					deleted_at timestamp,
+					key text,
+					value text,
+					type text,
+					read_policy text NOT NULL DEFAULT '',
+					write_policy text NOT NULL DEFAULT ''
+				)`,
+				`INSERT INTO systems (id, created_at, updated_at, deleted_at, key, value, type, read_policy, write_policy)
+					SELECT id, created_at, updated_at, deleted_at, key, value, type, read_policy, write_policy FROM systems_rebuild`,
+				`DROP TABLE systems_rebuild`,
+				`CREATE INDEX IF NOT EXISTS idx_systems_deleted_at ON systems (deleted_at)`,
+			},
+			db.Postgres: {
+				`ALTER TABLE systems DROP CONSTRAINT IF EXISTS systems_key_key`,
+			},
+		},
+		Up: []string{
+			`DROP INDEX IF EXISTS idx_systems_key`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_systems_key ON systems (key) WHERE deleted_at IS NULL`,
+		},
+		// Deleted variables sharing a key get their id appended on down, as
+		// the key index covers them again.
+		Down: []string{
+			`UPDATE systems SET key = key || '#' || id
+				WHERE deleted_at IS NOT NULL AND key IN (SELECT key FROM systems GROUP BY key HAVING count(*) > 1)`,
+			`DROP INDEX IF EXISTS idx_systems_key`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_systems_key ON systems (key)`,
+		},
+	},
+	{
+		Version: 2026101809,
+		Name:    "add_system_history_types",
+		Up: []string{
+			`ALTER TABLE system_history ADD COLUMN old_type text NOT NULL DEFAULT ''`,
+			`ALTER TABLE system_history ADD COLUMN new_type text NOT NULL DEFAULT ''`,
+		},
+		Down: []string{
+			`ALTER TABLE system_history DROP COLUMN new_type`,
+			`ALTER TABLE system_history DROP COLUMN old_type`,
+		},
+	},
+	{
+		Version: 2026101812,
+		Name:    "add_systems_created_at_index",
+		Up: []string{
+			`CREATE INDEX IF NOT EXISTS idx_systems_created_at_id ON systems (created_at, id)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_systems_created_at_id`,
+		},
+	},
 }
 
-func Drop(db *gorm.DB) {
-	db.Migrator().DropTable(&System{})
+// Apply pending system migrations.
+func Migrate(database *gorm.DB) error {
+	_, err := (&db.Migrator{}).New(database, Migrations).Up(false)
+	return err
+}
+
+// Revert every applied system migration.
+func Drop(database *gorm.DB) error {
+	_, err := (&db.Migrator{}).New(database, Migrations).Down(len(Migrations), false)
+	return err
 }
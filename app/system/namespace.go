@@ -0,0 +1,137 @@
+package system
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Separator of namespaces in keys, like billing.rates.eu.
+const Separator = "."
+
+// Check key is made of non empty segments of letters, digits, "_" or "-"
+// separated by dots.
+func ValidateKey(key string) error {
+	if key == "" {
+		return errors.New("expects a key like billing.rates.eu")
+	}
+
+	for _, segment := range strings.Split(key, Separator) {
+		if segment == "" {
+			return fmt.Errorf("%s has an empty segment", key)
+		}
+
+		for _, char := range segment {
+			if !isKeyChar(char) {
+				return fmt.Errorf("%s holds %q, expects letters, digits, _ or -", key, char)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Check key is namespace itself or lies within it, every key lies
+// within the empty namespace.
+func InNamespace(key, namespace string) bool {
+	return namespace == "" || key == namespace || strings.HasPrefix(key, namespace+Separator)
+}
+
+// Get key moved from namespace from to namespace to.
+func MoveKey(key, from, to string) string {
+	return to + strings.TrimPrefix(key, from)
+}
+
+// PRIVATE:
+
+// Check char is allowed in key segments.
+func isKeyChar(char rune) bool {
+	return char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' ||
+		char >= '0' && char <= '9' || char == '_' || char == '-'
+}
+
+// Namespace level of a nested tree, kept apart from decoded json maps so
+// leaves are never merged into.
+type namespaceNode map[string]any
+
+// Nest entities of namespace into a map by key segment below it. Leaves are
+// decoded values, a variable that is also a namespace keeps its value under "".
+func nest(namespace string, entities []*SystemEntity) (map[string]any, error) {
+	tree := namespaceNode{}
+
+	for _, entity := range entities {
+		value, err := entity.decoded()
+		if err != nil {
+			return nil, err
+		}
+
+		relative := strings.TrimPrefix(strings.TrimPrefix(entity.Key, namespace), Separator)
+		if relative == "" {
+			tree[""] = value
+			continue
+		}
+
+		segments := strings.Split(relative, Separator)
+		node := tree
+		for _, segment := range segments[:len(segments)-1] {
+			child, ok := node[segment].(namespaceNode)
+			if !ok {
+				child = namespaceNode{}
+				if leaf, exists := node[segment]; exists {
+					child[""] = leaf
+				}
+				node[segment] = child
+			}
+			node = child
+		}
+
+		leaf := segments[len(segments)-1]
+		if child, ok := node[leaf].(namespaceNode); ok {
+			child[""] = value
+		} else {
+			node[leaf] = value
+		}
+	}
+
+	return tree.plain(), nil
+}
+
+// Get node as a plain map, nested nodes included.
+func (node namespaceNode) plain() map[string]any {
+	result := make(map[string]any, len(node))
+	for segment, value := range node {
+		if child, ok := value.(namespaceNode); ok {
+			value = child.plain()
+		}
+		result[segment] = value
+	}
+
+	return result
+}
+
+// Decode value by type, json, list and flag values as their JSON documents,
+// durations stay strings.
+func (s *SystemEntity) decoded() (any, error) {
+	spec, err := ParseType(s.Type)
+	if err != nil {
+		return nil, fieldException(INVALID_TYPE_EX, s.Key, err)
+	}
+
+	switch spec.Base {
+	case IntType:
+		return s.AsInt()
+	case FloatType:
+		return s.AsFloat()
+	case BooleanType:
+		return s.AsBool()
+	case JSONType, ListType, FlagType:
+		var value any
+		if err := json.Unmarshal([]byte(s.Value), &value); err != nil {
+			return nil, s.invalidValue(err)
+		}
+		return value, nil
+	}
+
+	return s.Value, nil
+}
@@ -0,0 +1,91 @@
+package system
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Test ValidateKey, InNamespace and MoveKey.
+func TestNamespaceKeys(t *testing.T) {
+	t.Run("Should accept dotted keys", func(t *testing.T) {
+		for _, key := range []string{"rate", "billing.rates.eu", "MSIM_ADDR", "feature-x.v2"} {
+			if err := ValidateKey(key); err != nil {
+				t.Fatalf("ValidateKey(%s) returns %v", key, err)
+			}
+		}
+	})
+
+	t.Run("Should reject malformed keys", func(t *testing.T) {
+		for _, key := range []string{"", ".rate", "billing.", "billing..eu", "billing/eu", "rate eu"} {
+			if err := ValidateKey(key); err == nil {
+				t.Fatalf("ValidateKey(%q) expects error", key)
+			}
+		}
+	})
+
+	t.Run("Should match keys by whole segments", func(t *testing.T) {
+		cases := map[string]bool{"billing": true, "billing.eu": true, "billing.eu.rate": true, "billings": false, "invoicing.billing": false}
+		for key, expected := range cases {
+			if InNamespace(key, "billing") != expected {
+				t.Fatalf("InNamespace(%s, billing) expects %t", key, expected)
+			}
+		}
+	})
+
+	t.Run("Should move keys to another namespace", func(t *testing.T) {
+		if key := MoveKey("billing.eu.rate", "billing", "invoicing.v2"); key != "invoicing.v2.eu.rate" {
+			t.Fatalf("MoveKey() returns %s", key)
+		}
+	})
+}
+
+// Test nest.
+func TestNest(t *testing.T) {
+	t.Run("Should nest decoded values by segment", func(t *testing.T) {
+		entities := []*SystemEntity{
+			{Key: "billing", Value: "on", Type: "string"},
+			{Key: "billing.eu", Value: "true", Type: "boolean"},
+			{Key: "billing.eu.rate", Value: "2", Type: "int"},
+			{Key: "billing.us.codes", Value: `["a","b"]`, Type: "list:string"},
+		}
+
+		result, err := nest("billing", entities)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[string]any{
+			"":   "on",
+			"eu": map[string]any{"": true, "rate": 2},
+			"us": map[string]any{"codes": []any{"a", "b"}},
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("nest() returns %v, expects %v", result, expected)
+		}
+	})
+
+	t.Run("Should keep json values apart from child keys", func(t *testing.T) {
+		for _, entities := range [][]*SystemEntity{
+			{{Key: "a", Value: `{"x":1}`, Type: "json"}, {Key: "a.b", Value: "2", Type: "int"}},
+			{{Key: "a.b", Value: "2", Type: "int"}, {Key: "a", Value: `{"x":1}`, Type: "json"}},
+		} {
+			result, err := nest("", entities)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := map[string]any{
+				"a": map[string]any{"": map[string]any{"x": float64(1)}, "b": 2},
+			}
+			if !reflect.DeepEqual(result, expected) {
+				t.Fatalf("nest() returns %v, expects %v", result, expected)
+			}
+		}
+	})
+
+	t.Run("Should fail on values not matching their type", func(t *testing.T) {
+		if _, err := nest("", []*SystemEntity{{Key: "rate", Value: "x", Type: "int"}}); err == nil {
+			t.Fatal("nest() expects error")
+		}
+	})
+}
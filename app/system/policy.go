@@ -0,0 +1,86 @@
+package system
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"msim/app/user"
+)
+
+// Comma separated principals allowed to access a system variable:
+// "*" for everyone, "role:<role>" or "user:<user id>".
+// An empty policy falls back to the permissions of the caller role.
+type Policy string
+
+// Principal matching every caller, authenticated or not, in read policies
+// and every authenticated user in write policies.
+const Everyone = "*"
+
+// Principal prefixes.
+const (
+	rolePrincipal = "role:"
+	userPrincipal = "user:"
+)
+
+// Check if every principal of policy is well formed.
+func (p Policy) Valid() bool {
+	for _, principal := range p.principals() {
+		switch {
+		case principal == Everyone:
+		case strings.HasPrefix(principal, rolePrincipal):
+			if !user.Role(strings.TrimPrefix(principal, rolePrincipal)).Valid() {
+				return false
+			}
+		case strings.HasPrefix(principal, userPrincipal):
+			if _, err := uuid.Parse(strings.TrimPrefix(principal, userPrincipal)); err != nil {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Check if policy lets actor access a variable, falling back to
+// permission when empty. Callers managing policies are always allowed.
+func (p Policy) Allows(actor *user.UserEntity, permission user.Permission) bool {
+	if p == "" {
+		return actor.Can(permission)
+	}
+
+	if actor.Can(user.ManagePoliciesPermission) {
+		return true
+	}
+
+	for _, principal := range p.principals() {
+		if principal == Everyone {
+			return true
+		}
+
+		if actor == nil {
+			continue
+		}
+
+		if principal == rolePrincipal+string(actor.Role) || principal == userPrincipal+actor.ID.String() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PRIVATE:
+
+// Get trimmed, non empty principals of policy.
+func (p Policy) principals() []string {
+	var principals []string
+	for _, principal := range strings.Split(string(p), ",") {
+		if principal = strings.TrimSpace(principal); principal != "" {
+			principals = append(principals, principal)
+		}
+	}
+
+	return principals
+}
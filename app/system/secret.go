@@ -0,0 +1,241 @@
+package system
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Value shown in place of secret values, only Reveal decrypts them.
+const SecretMask = "********"
+
+// Master key files are "<kid>.aes", holding a raw AES-256 key.
+const (
+	masterKeyExtension = ".aes"
+	masterKeySize      = 32
+)
+
+// Version prefix of sealed values, "v1:<kid>:<wrapped data key>:<ciphertext>".
+const sealedVersion = "v1"
+
+var errNoKeyring = errors.New("secret variables need system.secrets.master_key")
+
+// Master keys by key id, one of them seals new secrets. Every secret is
+// encrypted with its own data key, stored wrapped by a master key.
+type Keyring struct {
+	master string
+	keys   map[string][]byte
+}
+
+// Load every "<kid>.aes" master key file of dir. New secrets are sealed with
+// masterKid, keys left in dir keep opening secrets sealed before a rotation.
+func LoadKeyring(dir, masterKid string) (*Keyring, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read secrets keys folder: %w", err)
+	}
+
+	keyring := &Keyring{master: masterKid, keys: map[string][]byte{}}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != masterKeyExtension {
+			continue
+		}
+
+		path := filepath.Join(dir, file.Name())
+		kid := strings.TrimSuffix(file.Name(), masterKeyExtension)
+		if strings.Contains(kid, ":") {
+			return nil, fmt.Errorf("key id of %s must not contain \":\"", path)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(content) != masterKeySize {
+			return nil, fmt.Errorf("key %s must have %d bytes", path, masterKeySize)
+		}
+
+		keyring.keys[kid] = content
+	}
+
+	if _, ok := keyring.keys[masterKid]; !ok {
+		return nil, fmt.Errorf("master key %q not found in %s", masterKid, dir)
+	}
+
+	return keyring, nil
+}
+
+// Generate a master key file in dir.
+func GenerateMasterKey(dir, kid string) (string, error) {
+	if kid == "" || strings.Contains(kid, ":") {
+		return "", fmt.Errorf("key id %q must be set and not contain \":\"", kid)
+	}
+
+	content := make([]byte, masterKeySize)
+	if _, err := rand.Read(content); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, kid+masterKeyExtension)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	_, err = file.Write(content)
+	return path, err
+}
+
+// Encrypt plaintext with a new data key wrapped by the master key.
+func (keyring *Keyring) Seal(plaintext string) (string, error) {
+	if keyring == nil {
+		return "", errNoKeyring
+	}
+
+	dataKey := make([]byte, masterKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrapped, err := encrypt(keyring.keys[keyring.master], dataKey, []byte(keyring.master))
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := encrypt(dataKey, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+
+	encoding := base64.RawURLEncoding
+	return strings.Join([]string{sealedVersion, keyring.master, encoding.EncodeToString(wrapped), encoding.EncodeToString(ciphertext)}, ":"), nil
+}
+
+// Decrypt a sealed value with the master key that wrapped its data key.
+func (keyring *Keyring) Open(sealed string) (string, error) {
+	if keyring == nil {
+		return "", errNoKeyring
+	}
+
+	kid, wrapped, ciphertext, err := splitSealed(sealed)
+	if err != nil {
+		return "", err
+	}
+
+	master, ok := keyring.keys[kid]
+	if !ok {
+		return "", fmt.Errorf("master key %q not found", kid)
+	}
+
+	dataKey, err := decrypt(master, wrapped, []byte(kid))
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := decrypt(dataKey, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// Seal again a value sealed by another master key than the current one,
+// reporting whether it changed.
+func (keyring *Keyring) Reseal(sealed string) (string, bool, error) {
+	if keyring == nil {
+		return "", false, errNoKeyring
+	}
+
+	kid, _, _, err := splitSealed(sealed)
+	if err != nil {
+		return "", false, err
+	}
+
+	if kid == keyring.master {
+		return sealed, false, nil
+	}
+
+	plaintext, err := keyring.Open(sealed)
+	if err != nil {
+		return "", false, err
+	}
+
+	resealed, err := keyring.Seal(plaintext)
+	return resealed, err == nil, err
+}
+
+// PRIVATE:
+
+// Split sealed value into master key id, wrapped data key and ciphertext.
+func splitSealed(sealed string) (string, []byte, []byte, error) {
+	parts := strings.Split(sealed, ":")
+	if len(parts) != 4 || parts[0] != sealedVersion {
+		return "", nil, nil, errors.New("malformed sealed secret")
+	}
+
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, errors.New("malformed sealed secret")
+	}
+
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", nil, nil, errors.New("malformed sealed secret")
+	}
+
+	return parts[1], wrapped, ciphertext, nil
+}
+
+// Encrypt plaintext with AES-GCM under key, the nonce prefixing the result.
+func encrypt(key, plaintext, data []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, data), nil
+}
+
+// Decrypt AES-GCM ciphertext prefixed by its nonce under key.
+func decrypt(key, ciphertext, data []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("malformed sealed secret")
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, data)
+	if err != nil {
+		return nil, errors.New("can't decrypt sealed secret")
+	}
+
+	return plaintext, nil
+}
+
+// Get AES-GCM cipher of key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,109 @@
+package system
+
+import (
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test Keyring.
+func TestKeyring(t *testing.T) {
+	t.Run("Should open sealed values", func(t *testing.T) {
+		keyring := CreateKeyring("current")
+
+		sealed, err := keyring.Seal("s3cr3t")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(sealed, "s3cr3t") || !strings.HasPrefix(sealed, "v1:current:") {
+			t.Fatalf("Expected a v1 value sealed by current, got %s", sealed)
+		}
+
+		if value, err := keyring.Open(sealed); err != nil || value != "s3cr3t" {
+			t.Fatalf("Open() returns %q, %v", value, err)
+		}
+	})
+
+	t.Run("Should not open tampered values", func(t *testing.T) {
+		keyring := CreateKeyring("current")
+		sealed, _ := keyring.Seal("s3cr3t")
+
+		parts := strings.Split(sealed, ":")
+		parts[1] = "other"
+		keyring.keys["other"] = keyring.keys["current"]
+
+		cases := []string{sealed[:len(sealed)-2] + "AA", strings.Join(parts, ":"), "s3cr3t"}
+		for _, value := range cases {
+			if _, err := keyring.Open(value); err == nil {
+				t.Fatalf("Open(%s) expects error", value)
+			}
+		}
+	})
+
+	t.Run("Should seal again values of older master keys", func(t *testing.T) {
+		old := CreateKeyring("old")
+		sealed, _ := old.Seal("s3cr3t")
+
+		keyring := CreateKeyring("new")
+		keyring.keys["old"] = old.keys["old"]
+
+		resealed, changed, err := keyring.Reseal(sealed)
+		if err != nil || !changed || !strings.HasPrefix(resealed, "v1:new:") {
+			t.Fatalf("Reseal() returns %s, %t, %v", resealed, changed, err)
+		}
+
+		if _, changed, _ := keyring.Reseal(resealed); changed {
+			t.Fatal("Should keep values of the current master key")
+		}
+	})
+
+	t.Run("Should load generated master keys", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, kid := range []string{"2026-10", "2026-11"} {
+			if _, err := GenerateMasterKey(dir, kid); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		keyring, err := LoadKeyring(dir, "2026-11")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(keyring.keys) != 2 || keyring.master != "2026-11" {
+			t.Fatal("Should load every master key")
+		}
+
+		if _, err := LoadKeyring(dir, "2026-12"); err == nil {
+			t.Fatal("Should not load without the master key")
+		}
+	})
+
+	t.Run("Should not load short master keys", func(t *testing.T) {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "short.aes"), []byte("short"), 0o600)
+
+		if _, err := LoadKeyring(dir, "short"); err == nil {
+			t.Fatal("LoadKeyring() expects error")
+		}
+	})
+
+	t.Run("Should refuse secrets without keyring", func(t *testing.T) {
+		var keyring *Keyring
+
+		if _, err := keyring.Seal("s3cr3t"); err == nil {
+			t.Fatal("Seal() expects error")
+		}
+	})
+}
+
+// Create keyring with a random master key.
+func CreateKeyring(master string) *Keyring {
+	key := make([]byte, masterKeySize)
+	rand.Read(key)
+
+	return &Keyring{master: master, keys: map[string][]byte{master: key}}
+}
@@ -0,0 +1,155 @@
+package system
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"msim/app/user"
+	"msim/db"
+)
+
+// Actions recorded in system history.
+const (
+	CreateAction   = "create"
+	UpdateAction   = "update"
+	RollbackAction = "rollback"
+	DeleteAction   = "delete"
+	RestoreAction  = "restore"
+	PurgeAction    = "purge"
+	MoveAction     = "move"
+	RevealAction   = "reveal"
+)
+
+type SystemHistory struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Key       string
+	Version   int
+	Action    string
+	OldValue  string
+	NewValue  string
+	OldType   string
+	NewType   string
+	ActorID   *uuid.UUID
+	ActorName string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// One recorded change of a system variable, versions start at 1 on creation.
+type HistoryEntry struct {
+	Version   int       `json:"version"`
+	Action    string    `json:"action"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	OldType   string    `json:"old_type,omitempty"`
+	NewType   string    `json:"new_type,omitempty"`
+	ActorID   uuid.UUID `json:"actor_id"`
+	ActorName string    `json:"actor_name"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+	// Value and type set by the change, sealed for secrets.
+	state snapshot
+}
+
+// Value and type of a system variable around a change.
+type snapshot struct {
+	Value string
+	Type  string
+}
+
+// Who changed a system variable and why.
+type Audit struct {
+	Actor  *user.UserEntity
+	Reason string
+}
+
+// Table name of SystemHistory.
+func (SystemHistory) TableName() string {
+	return "system_history"
+}
+
+// Get history of key, oldest version first.
+func (repository *SystemRepository) History(key string) ([]*HistoryEntry, error) {
+	var models []SystemHistory
+
+	result := repository.db.Where("key = ?", key).Order("version").Find(&models)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	entries := []*HistoryEntry{}
+	for i := range models {
+		entries = append(entries, toHistoryEntry(&models[i]))
+	}
+
+	return entries, nil
+}
+
+// Get history entry of key at version.
+func (repository *SystemRepository) HistoryVersion(key string, version int) (*HistoryEntry, error) {
+	var model SystemHistory
+
+	result := repository.db.Where("key = ? AND version = ?", key, version).First(&model)
+	if result.Error != nil {
+		return nil, db.TranslateError(result.Error, "version")
+	}
+
+	return toHistoryEntry(&model), nil
+}
+
+// PRIVATE:
+
+// Map history model to entry.
+func toHistoryEntry(model *SystemHistory) *HistoryEntry {
+	entry := &HistoryEntry{
+		Version:   model.Version,
+		Action:    model.Action,
+		OldValue:  masked(model.OldValue, model.OldType),
+		NewValue:  masked(model.NewValue, model.NewType),
+		OldType:   model.OldType,
+		NewType:   model.NewType,
+		ActorName: model.ActorName,
+		Reason:    model.Reason,
+		CreatedAt: model.CreatedAt,
+		state:     snapshot{model.NewValue, model.NewType},
+	}
+
+	if model.ActorID != nil {
+		entry.ActorID = *model.ActorID
+	}
+
+	return entry
+}
+
+// Record change of key within transaction tx as its next version.
+func record(tx *gorm.DB, key, action string, old, new snapshot, audit *Audit) error {
+	var version int
+	err := tx.Model(&SystemHistory{}).Where("key = ?", key).
+		Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	if err != nil {
+		return err
+	}
+
+	model := &SystemHistory{
+		ID:        uuid.New(),
+		Key:       key,
+		Version:   version + 1,
+		Action:    action,
+		OldValue:  old.Value,
+		NewValue:  new.Value,
+		OldType:   old.Type,
+		NewType:   new.Type,
+		CreatedAt: time.Now(),
+	}
+
+	if audit != nil {
+		model.Reason = audit.Reason
+		if audit.Actor != nil {
+			model.ActorID = &audit.Actor.ID
+			model.ActorName = audit.Actor.Name
+		}
+	}
+
+	return tx.Create(model).Error
+}
@@ -2,17 +2,23 @@ package system
 
 import (
 	"fmt"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"msim/app/shared"
+	"msim/db"
 )
 
 type System struct {
 	gorm.Model
-	ID    uuid.UUID `gorm:"type:uuid;primaryKey"`
-	Key   string    `gorm:"unique"`
-	Value string
-	Type  string
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Key         string
+	Value       string
+	Type        string
+	ReadPolicy  string
+	WritePolicy string
 }
 
 type SystemRepository struct {
@@ -24,14 +30,15 @@ func (repository *SystemRepository) New(database *gorm.DB) *SystemRepository {
 	return &SystemRepository{db: database}
 }
 
-// Create system variable.
-func (repository *SystemRepository) Create(s *SystemEntity) (*SystemEntity, error) {
-	envModel := &System{ID: s.ID, Key: s.Key, Value: s.Value, Type: s.Type}
-	result := repository.db.Create(&envModel)
+// Create system variable, recording it as version 1 of its history.
+func (repository *SystemRepository) Create(s *SystemEntity, audit *Audit) (*SystemEntity, error) {
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		return insertSystem(tx, s, audit)
+	})
 
-	if result.Error != nil {
-		fmt.Println(result.Error)
-		return nil, result.Error
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
 	}
 
 	return s, nil
@@ -43,60 +50,554 @@ func (repository *SystemRepository) GetByKey(key string) (*SystemEntity, error)
 
 	result := repository.db.Where("key = ?", key).First(&model)
 	if result.Error != nil {
-		return nil, result.Error
+		return nil, db.TranslateError(result.Error, "key")
 	}
 
-	return &SystemEntity{Key: model.Key, Value: model.Value, Type: model.Type}, nil
+	return toEntity(&model), nil
 }
 
-// Get all system variables.
+// Get all system variables ordered by key.
 func (repository *SystemRepository) GetAll() ([]*SystemEntity, error) {
 	var models []*System
 
-	result := repository.db.Find(&models)
+	result := repository.db.Order("key").Find(&models)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
 	var entities []*SystemEntity
 	for _, model := range models {
-		entities = append(entities, &SystemEntity{
-			Key:   model.Key,
-			Value: model.Value,
-			Type:  model.Type,
-		})
+		entities = append(entities, toEntity(model))
+	}
+
+	return entities, nil
+}
+
+// Filters of system variable lists, zero values match every variable.
+type SystemFilter struct {
+	Namespace     string
+	Type          ValueType
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// Columns system variable lists sort on, the first by default.
+var SystemSorts = []string{"created_at", "key"}
+
+// Get a page of system variables matching filter, a type filter matching
+// every type of its base like list:int for list.
+func (repository *SystemRepository) List(filter *SystemFilter, page *db.PageQuery) (*db.Page[*SystemEntity], error) {
+	query := repository.db.Model(&System{})
+	if filter.Namespace != "" {
+		prefix := filter.Namespace + Separator
+		query = query.Where("(key = ? OR substr(key, 1, ?) = ?)", filter.Namespace, utf8.RuneCountInString(prefix), prefix)
+	}
+
+	if filter.Type != "" {
+		prefix := string(filter.Type) + ":"
+		query = query.Where("(type = ? OR substr(type, 1, ?) = ?)", string(filter.Type), utf8.RuneCountInString(prefix), prefix)
+	}
+
+	if !filter.CreatedAfter.IsZero() {
+		query = query.Where("created_at >= ?", filter.CreatedAfter)
+	}
+
+	if !filter.CreatedBefore.IsZero() {
+		query = query.Where("created_at < ?", filter.CreatedBefore)
+	}
+
+	var total int64
+	if page.Total {
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	paginated, err := db.Paginate(query.Session(&gorm.Session{}), page)
+	if err != nil {
+		return nil, err
+	}
+
+	var models []*System
+	if err := paginated.Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	result := db.MapPage(db.Cut(models, page, func(model *System) (any, uuid.UUID) {
+		if page.Sort == "key" {
+			return model.Key, model.ID
+		}
+		return model.CreatedAt, model.ID
+	}), toEntity)
+
+	if page.Total {
+		result.Total = &total
+	}
+
+	return result, nil
+}
+
+// Get system variables of the given base types ordered by key.
+func (repository *SystemRepository) GetByTypes(types ...ValueType) ([]*SystemEntity, error) {
+	var models []*System
+
+	if err := repository.db.Where("type IN ?", types).Order("key").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	entities := []*SystemEntity{}
+	for _, model := range models {
+		entities = append(entities, toEntity(model))
 	}
 
 	return entities, nil
 }
 
-// Update system variable value by key
-func (repository *SystemRepository) UpdateValueByKey(key string, value string) (*SystemEntity, error) {
-	tx := repository.db.Begin()
-	if tx.Error != nil {
-		return nil, tx.Error
+// Get system variables of namespace ordered by key, the variable named like
+// the namespace included.
+func (repository *SystemRepository) GetByNamespace(namespace string) ([]*SystemEntity, error) {
+	return getByNamespace(repository.db, namespace)
+}
+
+// Move every variable of namespace from to namespace to, recording the move
+// in the history of the old and the new key. Every variable is passed to
+// authorize and no new key may be taken, both checked within the move
+// transaction; a nil authorize allows every variable. Return the moved
+// variables.
+func (repository *SystemRepository) MoveNamespace(from, to string, authorize func(entity *SystemEntity) error, audit *Audit) ([]*SystemEntity, error) {
+	var moved []*SystemEntity
+
+	err := repository.db.Transaction(func(tx *gorm.DB) (err error) {
+		moved, err = getByNamespace(tx, from)
+		if err != nil {
+			return err
+		}
+
+		if len(moved) == 0 {
+			return db.TranslateError(gorm.ErrRecordNotFound, "namespace")
+		}
+
+		for _, entity := range moved {
+			if authorize != nil {
+				if err := authorize(entity); err != nil {
+					return err
+				}
+			}
+
+			key := MoveKey(entity.Key, from, to)
+
+			var taken int64
+			if err := tx.Model(&System{}).Where("key = ?", key).Count(&taken).Error; err != nil {
+				return err
+			}
+
+			if taken > 0 {
+				return shared.FormException(shared.ALREADY_CREATED_EX, key)
+			}
+
+			result := tx.Model(&System{}).Where("key = ?", entity.Key).Update("key", key)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			if result.RowsAffected == 0 {
+				return db.TranslateError(gorm.ErrRecordNotFound, entity.Key)
+			}
+
+			state := snapshot{entity.stored(), entity.Type}
+			if err := record(tx, entity.Key, MoveAction, state, state, audit); err != nil {
+				return err
+			}
+
+			if err := record(tx, key, MoveAction, state, state, audit); err != nil {
+				return err
+			}
+
+			entity.Key = key
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return moved, nil
+}
+
+// Update system variable value by key, recording the change in its history.
+func (repository *SystemRepository) UpdateValueByKey(key string, value string, audit *Audit) (*SystemEntity, error) {
+	return repository.update(key, snapshot{Value: value}, UpdateAction, audit)
+}
+
+// Update system variable value and type by key at once,
+// an empty valueType keeps the current one.
+func (repository *SystemRepository) UpdateByKey(key, value, valueType string, audit *Audit) (*SystemEntity, error) {
+	return repository.update(key, snapshot{value, valueType}, UpdateAction, audit)
+}
+
+// Set system variable value and type by key back to the ones of version.
+func (repository *SystemRepository) RollbackByKey(key string, version int, audit *Audit) (*SystemEntity, error) {
+	entry, err := repository.HistoryVersion(key, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.update(key, entry.state, RollbackAction, audit)
+}
+
+// Soft delete system variable by key, freeing the key for a new variable.
+func (repository *SystemRepository) DeleteByKey(key string, audit *Audit) (*SystemEntity, error) {
+	var system *System
+
+	err := repository.db.Transaction(func(tx *gorm.DB) (err error) {
+		system, err = deleteSystem(tx, key, audit)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return toEntity(system), nil
+}
+
+// Get the last deleted system variable of key.
+func (repository *SystemRepository) GetDeletedByKey(key string) (*SystemEntity, error) {
+	var model System
+
+	result := repository.db.Unscoped().Where("key = ? AND deleted_at IS NOT NULL", key).
+		Order("deleted_at DESC").First(&model)
+	if result.Error != nil {
+		return nil, db.TranslateError(result.Error, "key")
 	}
 
+	return toEntity(&model), nil
+}
+
+// Restore the last deleted system variable of key.
+func (repository *SystemRepository) RestoreByKey(key string, audit *Audit) (*SystemEntity, error) {
 	var system System
-	result := tx.Where("key = ?", key).First(&system)
+
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("key = ? AND deleted_at IS NOT NULL", key).
+			Order("deleted_at DESC").First(&system)
+		if result.Error != nil {
+			return db.TranslateError(result.Error, "key")
+		}
+
+		if err := tx.Unscoped().Model(&system).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		state := snapshot{system.Value, system.Type}
+		return record(tx, key, RestoreAction, state, state, audit)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return toEntity(&system), nil
+}
+
+// Permanently delete every system variable of key, live or deleted.
+// The history of key is kept.
+func (repository *SystemRepository) PurgeByKey(key string, audit *Audit) (*SystemEntity, error) {
+	var system System
+
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("key = ?", key).Order("deleted_at IS NOT NULL, deleted_at DESC").First(&system)
+		if result.Error != nil {
+			return db.TranslateError(result.Error, "key")
+		}
+
+		if err := tx.Unscoped().Where("key = ?", key).Delete(&System{}).Error; err != nil {
+			return err
+		}
+
+		return record(tx, key, PurgeAction, snapshot{system.Value, system.Type}, snapshot{}, audit)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return toEntity(&system), nil
+}
+
+// Update system variable policies by key.
+func (repository *SystemRepository) UpdatePoliciesByKey(key string, read, write Policy) (*SystemEntity, error) {
+	result := repository.db.Model(&System{}).Where("key = ?", key).
+		Updates(map[string]any{"read_policy": string(read), "write_policy": string(write)})
 
 	if result.Error != nil {
-		tx.Rollback()
 		return nil, result.Error
 	}
 
-	system.Value = value
-	err := tx.Save(&system).Error
+	if result.RowsAffected == 0 {
+		return nil, db.TranslateError(gorm.ErrRecordNotFound, "key")
+	}
+
+	return repository.GetByKey(key)
+}
+
+// Record a reveal of the secret value of key in its history and return the
+// variable with its sealed value.
+func (repository *SystemRepository) RevealByKey(key string, audit *Audit) (*SystemEntity, error) {
+	var system System
+
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("key = ?", key).First(&system).Error; err != nil {
+			return db.TranslateError(err, "key")
+		}
+
+		state := snapshot{system.Value, system.Type}
+		return record(tx, key, RevealAction, state, state, audit)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return toEntity(&system), nil
+}
+
+// Replace every sealed secret value, of live and deleted variables and of
+// their history, with the one returned by reseal in a single transaction.
+// Returns the number of values changed.
+func (repository *SystemRepository) ResealSecrets(reseal func(sealed string) (string, bool, error)) (int, error) {
+	count := 0
+
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		var systems []*System
+		if err := tx.Unscoped().Where("type = ?", string(SecretType)).Find(&systems).Error; err != nil {
+			return err
+		}
+
+		for _, system := range systems {
+			value, changed, err := reseal(system.Value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", system.Key, err)
+			}
+
+			if changed {
+				if err := tx.Unscoped().Model(system).UpdateColumn("value", value).Error; err != nil {
+					return err
+				}
+				count++
+			}
+		}
+
+		var entries []*SystemHistory
+		if err := tx.Where("old_type = ? OR new_type = ?", string(SecretType), string(SecretType)).Find(&entries).Error; err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			columns := map[string]any{}
+			for column, state := range map[string]snapshot{"old_value": {entry.OldValue, entry.OldType}, "new_value": {entry.NewValue, entry.NewType}} {
+				if state.Type != string(SecretType) || state.Value == "" {
+					continue
+				}
+
+				value, changed, err := reseal(state.Value)
+				if err != nil {
+					return fmt.Errorf("%s version %d: %w", entry.Key, entry.Version, err)
+				}
+
+				if changed {
+					columns[column] = value
+				}
+			}
+
+			if len(columns) > 0 {
+				if err := tx.Model(entry).Updates(columns).Error; err != nil {
+					return err
+				}
+				count += len(columns)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Apply planned import changes all at once, recording each in its history.
+func (repository *SystemRepository) Import(changes []*ImportChange, audit *Audit) error {
+	return repository.db.Transaction(func(tx *gorm.DB) error {
+		for _, change := range changes {
+			var err error
+
+			switch change.Action {
+			case CreateAction:
+				err = insertSystem(tx, change.entity, audit)
+			case UpdateAction:
+				_, err = updateSystem(tx, change.Key, snapshot{change.entity.stored(), change.NewType}, UpdateAction, audit)
+				if err == nil {
+					err = tx.Model(&System{}).Where("key = ?", change.Key).Updates(map[string]any{
+						"read_policy":  string(change.entity.ReadPolicy),
+						"write_policy": string(change.entity.WritePolicy),
+					}).Error
+				}
+			case DeleteAction:
+				_, err = deleteSystem(tx, change.Key, audit)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// PRIVATE:
+
+// Set value and type of key within a transaction, recording action in its
+// history. An empty type keeps the current one.
+func (repository *SystemRepository) update(key string, state snapshot, action string, audit *Audit) (*SystemEntity, error) {
+	var system *System
+
+	err := repository.db.Transaction(func(tx *gorm.DB) (err error) {
+		system, err = updateSystem(tx, key, state, action, audit)
+		return err
+	})
+
 	if err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 
-	tx.Commit()
+	return toEntity(system), nil
+}
+
+// Get system variables of namespace within transaction tx ordered by key.
+func getByNamespace(tx *gorm.DB, namespace string) ([]*SystemEntity, error) {
+	var models []*System
+
+	query := tx.Order("key")
+	if namespace != "" {
+		prefix := namespace + Separator
+		query = query.Where("key = ? OR substr(key, 1, ?) = ?", namespace, utf8.RuneCountInString(prefix), prefix)
+	}
+
+	if err := query.Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	entities := []*SystemEntity{}
+	for _, model := range models {
+		entities = append(entities, toEntity(model))
+	}
+
+	return entities, nil
+}
+
+// Insert variable s within transaction tx, recording it in its history.
+func insertSystem(tx *gorm.DB, s *SystemEntity, audit *Audit) error {
+	model := &System{
+		ID:          s.ID,
+		Key:         s.Key,
+		Value:       s.stored(),
+		Type:        s.Type,
+		ReadPolicy:  string(s.ReadPolicy),
+		WritePolicy: string(s.WritePolicy),
+	}
+
+	if err := tx.Create(model).Error; err != nil {
+		return err
+	}
+	s.CreatedAt = model.CreatedAt
+
+	return record(tx, s.Key, CreateAction, snapshot{}, snapshot{model.Value, s.Type}, audit)
+}
+
+// Set value and type of key within transaction tx, recording action in its
+// history. An empty type keeps the current one.
+func updateSystem(tx *gorm.DB, key string, state snapshot, action string, audit *Audit) (*System, error) {
+	var system System
+	if err := tx.Where("key = ?", key).First(&system).Error; err != nil {
+		return nil, db.TranslateError(err, "key")
+	}
+
+	old := snapshot{system.Value, system.Type}
+	if state.Type == "" {
+		state.Type = system.Type
+	}
+
+	system.Value = state.Value
+	system.Type = state.Type
+	if err := tx.Save(&system).Error; err != nil {
+		return nil, err
+	}
+
+	if err := record(tx, key, action, old, state, audit); err != nil {
+		return nil, err
+	}
+
+	return &system, nil
+}
+
+// Soft delete variable of key within transaction tx, recording it in its history.
+func deleteSystem(tx *gorm.DB, key string, audit *Audit) (*System, error) {
+	var system System
+	if err := tx.Where("key = ?", key).First(&system).Error; err != nil {
+		return nil, db.TranslateError(err, "key")
+	}
+
+	if err := tx.Delete(&system).Error; err != nil {
+		return nil, err
+	}
+
+	state := snapshot{system.Value, system.Type}
+	if err := record(tx, key, DeleteAction, state, state, audit); err != nil {
+		return nil, err
+	}
+
+	return &system, nil
+}
+
+// Map system model to entity, masking secret values.
+func toEntity(model *System) *SystemEntity {
+	entity := &SystemEntity{
+		ID:          model.ID,
+		Key:         model.Key,
+		Value:       masked(model.Value, model.Type),
+		Type:        model.Type,
+		ReadPolicy:  Policy(model.ReadPolicy),
+		WritePolicy: Policy(model.WritePolicy),
+		CreatedAt:   model.CreatedAt,
+	}
+
+	if model.Type == string(SecretType) {
+		entity.sealed = model.Value
+	}
+
+	return entity
+}
+
+// Get value as shown outside, SecretMask for secrets.
+func masked(value, valueType string) string {
+	if valueType == string(SecretType) {
+		return SecretMask
+	}
+
+	return value
+}
+
+// Get value as stored, sealed for secrets.
+func (s *SystemEntity) stored() string {
+	if s.sealed != "" {
+		return s.sealed
+	}
 
-	return &SystemEntity{
-		Key:   system.Key,
-		Value: system.Value,
-		Type:  system.Type,
-	}, nil
+	return s.Value
 }
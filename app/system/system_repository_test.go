@@ -1,19 +1,22 @@
 package system
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"msim/app/shared"
+	"msim/app/user"
 	"msim/db"
 )
 
 // Test create.
 func TestCreateRepository(t *testing.T) {
 	t.Run("Should create a system variable", func(t *testing.T) {
-		repository, DB := CreateSystemRepository()
-		result, err := repository.Create(&SystemEntity{ID: uuid.New(), Key: "abcd", Value: "abcd", Type: "string"})
+		repository, DB := CreateSystemRepository(t)
+		result, err := repository.Create(&SystemEntity{ID: uuid.New(), Key: "abcd", Value: "abcd", Type: "string"}, nil)
 
 		resultType := reflect.TypeOf(result)
 		expectedType := reflect.TypeOf((*SystemEntity)(nil))
@@ -37,10 +40,10 @@ func TestCreateRepository(t *testing.T) {
 	})
 
 	t.Run("Should not create a system variable when key already exists", func(t *testing.T) {
-		repository, DB := CreateSystemRepository()
+		repository, DB := CreateSystemRepository(t)
 
 		DB.Create(&System{ID: uuid.New(), Key: "abcd", Value: "abcd", Type: "string"})
-		_, err := repository.Create(&SystemEntity{ID: uuid.New(), Key: "abcd", Value: "abcd", Type: "string"})
+		_, err := repository.Create(&SystemEntity{ID: uuid.New(), Key: "abcd", Value: "abcd", Type: "string"}, nil)
 
 		if err == nil {
 			t.Fatal("Should not create another env with same key")
@@ -51,7 +54,7 @@ func TestCreateRepository(t *testing.T) {
 // Test getByKey.
 func TestGetByKey(t *testing.T) {
 	t.Run("Should get an env by key when exists", func(t *testing.T) {
-		repository, DB := CreateSystemRepository()
+		repository, DB := CreateSystemRepository(t)
 
 		created := System{ID: uuid.New(), Key: "key", Value: "val", Type: "type"}
 		DB.Create(&created)
@@ -76,7 +79,7 @@ func TestGetByKey(t *testing.T) {
 	})
 
 	t.Run("Should not get an env by key when doesnt exists", func(t *testing.T) {
-		repository, _ := CreateSystemRepository()
+		repository, _ := CreateSystemRepository(t)
 		result, err := repository.GetByKey("key2")
 
 		if err == nil {
@@ -92,7 +95,7 @@ func TestGetByKey(t *testing.T) {
 // Test GetAll.
 func TestGetAll(t *testing.T) {
 	t.Run("Should get all system variables", func(t *testing.T) {
-		repository, DB := CreateSystemRepository()
+		repository, DB := CreateSystemRepository(t)
 
 		variables := []System{
 			{ID: uuid.New(), Key: "key1", Value: "value1", Type: "string"},
@@ -120,7 +123,7 @@ func TestGetAll(t *testing.T) {
 	})
 
 	t.Run("Should retrieve an empty list of system variables", func(t *testing.T) {
-		repository, _ := CreateSystemRepository()
+		repository, _ := CreateSystemRepository(t)
 
 		result, err := repository.GetAll()
 
@@ -138,13 +141,13 @@ func TestGetAll(t *testing.T) {
 // Test UpdateValueByKey.
 func TestUpdateValueByKey(t *testing.T) {
 	t.Run("Should update the value of an existing system variable", func(t *testing.T) {
-		repository, DB := CreateSystemRepository()
+		repository, DB := CreateSystemRepository(t)
 
 		initialVariable := System{ID: uuid.New(), Key: "key1", Value: "value1", Type: "string"}
 		DB.Create(&initialVariable)
 
 		newValue := "updatedValue"
-		result, err := repository.UpdateValueByKey(initialVariable.Key, newValue)
+		result, err := repository.UpdateValueByKey(initialVariable.Key, newValue, nil)
 
 		if err != nil {
 			t.Fatal(err)
@@ -162,10 +165,10 @@ func TestUpdateValueByKey(t *testing.T) {
 	})
 
 	t.Run("Should return an error if key does not exist", func(t *testing.T) {
-		repository, _ := CreateSystemRepository()
+		repository, _ := CreateSystemRepository(t)
 		newValue := "updatedValue"
 
-		_, err := repository.UpdateValueByKey("NonExistentKey", newValue)
+		_, err := repository.UpdateValueByKey("NonExistentKey", newValue, nil)
 
 		if err == nil {
 			t.Fatal("Expected an error, got nil")
@@ -173,9 +176,412 @@ func TestUpdateValueByKey(t *testing.T) {
 	})
 }
 
+// Test History and RollbackByKey.
+func TestHistory(t *testing.T) {
+	t.Run("Should record every change as a new version", func(t *testing.T) {
+		repository, _ := CreateSystemRepository(t)
+		actor := &user.UserEntity{ID: uuid.New(), Name: "operator"}
+
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "1", Type: "int"}, &Audit{Actor: actor, Reason: "launch"})
+		repository.UpdateValueByKey("rate", "2", &Audit{Actor: actor, Reason: "promo"})
+
+		result, err := repository.History("rate")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result) != 2 {
+			t.Fatalf("Expected 2 versions, got %d", len(result))
+		}
+
+		update := result[1]
+		if update.Version != 2 || update.Action != UpdateAction || update.OldValue != "1" || update.NewValue != "2" {
+			t.Fatal("Should record the old and new value of the update")
+		}
+
+		if update.ActorID != actor.ID || update.ActorName != actor.Name || update.Reason != "promo" {
+			t.Fatal("Should record who changed the value and why")
+		}
+	})
+
+	t.Run("Should not record a failed change", func(t *testing.T) {
+		repository, DB := CreateSystemRepository(t)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "1", Type: "int"}, nil)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "2", Type: "int"}, nil)
+
+		var count int64
+		DB.Model(&SystemHistory{}).Count(&count)
+		if count != 1 {
+			t.Fatalf("Expected 1 version, got %d", count)
+		}
+	})
+
+	t.Run("Should roll back to the value of a version", func(t *testing.T) {
+		repository, _ := CreateSystemRepository(t)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "1", Type: "int"}, nil)
+		repository.UpdateValueByKey("rate", "2", nil)
+
+		result, err := repository.RollbackByKey("rate", 1, &Audit{Reason: "bad promo"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Value != "1" {
+			t.Fatalf("Expected value to be 1, got %s", result.Value)
+		}
+
+		history, _ := repository.History("rate")
+		if len(history) != 3 || history[2].Action != RollbackAction || history[2].OldValue != "2" {
+			t.Fatal("Should record the rollback as a new version")
+		}
+	})
+
+	t.Run("Should not roll back to an unknown version", func(t *testing.T) {
+		repository, _ := CreateSystemRepository(t)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "1", Type: "int"}, nil)
+
+		if _, err := repository.RollbackByKey("rate", 5, nil); !errors.Is(err, shared.ErrNotFound) {
+			t.Fatal("Should throw a not found exception")
+		}
+	})
+}
+
+// Test DeleteByKey, RestoreByKey and PurgeByKey.
+func TestDeleteByKey(t *testing.T) {
+	t.Run("Should soft delete a variable and free its key", func(t *testing.T) {
+		repository, _ := CreateSystemRepository(t)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "1", Type: "int"}, nil)
+
+		if _, err := repository.DeleteByKey("rate", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := repository.GetByKey("rate"); !errors.Is(err, shared.ErrNotFound) {
+			t.Fatal("Should not get a deleted variable")
+		}
+
+		if _, err := repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "2", Type: "int"}, nil); err != nil {
+			t.Fatal("Should create the key of a deleted variable again")
+		}
+	})
+
+	t.Run("Should restore the last deleted variable", func(t *testing.T) {
+		repository, _ := CreateSystemRepository(t)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "1", Type: "int"}, nil)
+		repository.DeleteByKey("rate", nil)
+
+		result, err := repository.RestoreByKey("rate", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Value != "1" {
+			t.Fatalf("Expected value 1, got %s", result.Value)
+		}
+
+		history, _ := repository.History("rate")
+		if len(history) != 3 || history[1].Action != DeleteAction || history[2].Action != RestoreAction {
+			t.Fatal("Should record the delete and the restore")
+		}
+	})
+
+	t.Run("Should purge every variable of key and keep its history", func(t *testing.T) {
+		repository, DB := CreateSystemRepository(t)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "1", Type: "int"}, nil)
+		repository.DeleteByKey("rate", nil)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "2", Type: "int"}, nil)
+
+		if _, err := repository.PurgeByKey("rate", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		var count int64
+		DB.Unscoped().Model(&System{}).Count(&count)
+		if count != 0 {
+			t.Fatalf("Expected no variable left, got %d", count)
+		}
+
+		history, _ := repository.History("rate")
+		if len(history) != 4 || history[3].Action != PurgeAction || history[3].OldValue != "2" {
+			t.Fatal("Should record the purge of the live variable")
+		}
+	})
+}
+
+// Test UpdateByKey.
+func TestUpdateByKey(t *testing.T) {
+	t.Run("Should update value and type at once", func(t *testing.T) {
+		repository, _ := CreateSystemRepository(t)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "timeout", Value: "30", Type: "int"}, nil)
+
+		result, err := repository.UpdateByKey("timeout", "30s", "duration", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Value != "30s" || result.Type != "duration" {
+			t.Fatalf("Expected 30s duration, got %s %s", result.Value, result.Type)
+		}
+
+		history, _ := repository.History("timeout")
+		if history[1].OldType != "int" || history[1].NewType != "duration" {
+			t.Fatal("Should record the type change")
+		}
+	})
+
+	t.Run("Should roll back value and type", func(t *testing.T) {
+		repository, _ := CreateSystemRepository(t)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "timeout", Value: "30", Type: "int"}, nil)
+		repository.UpdateByKey("timeout", "30s", "duration", nil)
+
+		result, err := repository.RollbackByKey("timeout", 1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Value != "30" || result.Type != "int" {
+			t.Fatalf("Expected 30 int, got %s %s", result.Value, result.Type)
+		}
+	})
+}
+
+// Test GetByNamespace and MoveNamespace.
+func TestNamespaceRepository(t *testing.T) {
+	t.Run("Should get the variables of a namespace by key", func(t *testing.T) {
+		repository, _ := CreateSystemRepository(t)
+		for _, key := range []string{"billing.eu", "billings", "billing", "invoicing.billing"} {
+			repository.Create(&SystemEntity{ID: uuid.New(), Key: key, Value: "1", Type: "int"}, nil)
+		}
+
+		result, err := repository.GetByNamespace("billing")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result) != 2 || result[0].Key != "billing" || result[1].Key != "billing.eu" {
+			t.Fatalf("Expected billing and billing.eu, got %d variables", len(result))
+		}
+	})
+
+	t.Run("Should move every variable of a namespace", func(t *testing.T) {
+		repository, _ := CreateSystemRepository(t)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "billing.eu.rate", Value: "2", Type: "int"}, nil)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "billings", Value: "1", Type: "int"}, nil)
+
+		result, err := repository.MoveNamespace("billing", "invoicing", nil, &Audit{Reason: "rename"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result) != 1 || result[0].Key != "invoicing.eu.rate" {
+			t.Fatal("Should return the moved variable with its new key")
+		}
+
+		if _, err := repository.GetByKey("billings"); err != nil {
+			t.Fatal("Should not move keys sharing a prefix only")
+		}
+
+		old, _ := repository.History("billing.eu.rate")
+		moved, _ := repository.History("invoicing.eu.rate")
+		if len(old) != 2 || old[1].Action != MoveAction || len(moved) != 1 || moved[0].Reason != "rename" {
+			t.Fatal("Should record the move on both keys")
+		}
+	})
+
+	t.Run("Should not move anything when a check fails", func(t *testing.T) {
+		repository, _ := CreateSystemRepository(t)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "billing.eu", Value: "2", Type: "int"}, nil)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "billing.us", Value: "1", Type: "int"}, nil)
+
+		denied := shared.FormException(shared.UNAUTHORIZED_EX, "billing.us")
+		authorize := func(entity *SystemEntity) error {
+			if entity.Key == "billing.us" {
+				return denied
+			}
+			return nil
+		}
+
+		if _, err := repository.MoveNamespace("billing", "invoicing", authorize, nil); err != denied {
+			t.Fatalf("Expected the authorize error, got %v", err)
+		}
+
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "invoicing.us", Value: "3", Type: "int"}, nil)
+		if _, err := repository.MoveNamespace("billing", "invoicing", nil, nil); !errors.Is(err, shared.ErrAlreadyCreated) {
+			t.Fatalf("Expected already created, got %v", err)
+		}
+
+		if result, _ := repository.GetByNamespace("billing"); len(result) != 2 {
+			t.Fatal("Should leave the namespace untouched")
+		}
+	})
+
+	t.Run("Should not move an empty namespace", func(t *testing.T) {
+		repository, _ := CreateSystemRepository(t)
+
+		if _, err := repository.MoveNamespace("billing", "invoicing", nil, nil); !errors.Is(err, shared.ErrNotFound) {
+			t.Fatalf("Expected not found, got %v", err)
+		}
+	})
+}
+
+// Test List.
+func TestListRepository(t *testing.T) {
+	t.Run("Should page variables by key", func(t *testing.T) {
+		repository, _ := CreateSystemRepository(t)
+		for _, key := range []string{"c", "a", "b"} {
+			repository.Create(&SystemEntity{ID: uuid.New(), Key: key, Value: "1", Type: "int"}, nil)
+		}
+
+		page := &db.PageQuery{Limit: 2, Sort: "key", Order: db.Descending}
+		first, err := repository.List(&SystemFilter{}, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(first.Items) != 2 || first.Items[0].Key != "c" || first.NextCursor == "" {
+			t.Fatal("Should return c, b and a cursor")
+		}
+
+		page.Cursor = first.NextCursor
+		last, _ := repository.List(&SystemFilter{}, page)
+		if len(last.Items) != 1 || last.Items[0].Key != "a" || last.NextCursor != "" {
+			t.Fatal("Should return a without a cursor")
+		}
+	})
+
+	t.Run("Should filter variables by namespace and base type", func(t *testing.T) {
+		repository, _ := CreateSystemRepository(t)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "billing.codes", Value: "[1]", Type: "list:int"}, nil)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "billing.rate", Value: "1", Type: "int"}, nil)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "billings.codes", Value: "[1]", Type: "list:int"}, nil)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "billing.names", Value: "[]", Type: "listing"}, nil)
+
+		filter := &SystemFilter{Namespace: "billing", Type: ListType}
+		result, err := repository.List(filter, &db.PageQuery{Limit: 10, Sort: "key", Order: db.Ascending, Total: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Items) != 1 || result.Items[0].Key != "billing.codes" || *result.Total != 1 {
+			t.Fatal("Should only return billing.codes")
+		}
+	})
+}
+
+// Test migration normalize_systems_type.
+func TestNormalizeTypeMigration(t *testing.T) {
+	t.Run("Should map legacy types and restore them on down", func(t *testing.T) {
+		DB, cleanup, err := db.TestDB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(cleanup)
+		Drop(DB)
+		(&db.Migrator{}).New(DB, Migrations[:2]).Up(false)
+
+		legacy := map[string]string{"rate": " Integer", "enabled": "BOOL", "name": "text", "codes": "list:int", "plain": "string"}
+		for key, kind := range legacy {
+			DB.Exec(`INSERT INTO systems (id, key, value, type) VALUES (?, ?, '', ?)`, uuid.New(), key, kind)
+		}
+
+		if err := Migrate(DB); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[string]string{"rate": "int", "enabled": "boolean", "name": "string", "codes": "string", "plain": "string"}
+		for key, kind := range expected {
+			var result System
+			DB.Where("key = ?", key).First(&result)
+			if _, err := ParseType(result.Type); err != nil || result.Type != kind {
+				t.Fatalf("Expected type %s of %s, got %q", kind, key, result.Type)
+			}
+		}
+
+		DB.Model(&System{}).Where("key = ?", "name").Update("type", "json")
+		if _, err := (&db.Migrator{}).New(DB, Migrations).Down(len(Migrations)-2, false); err != nil {
+			t.Fatal(err)
+		}
+
+		legacy["name"] = "json"
+		for key, kind := range legacy {
+			var result System
+			DB.Where("key = ?", key).First(&result)
+			if result.Type != kind {
+				t.Fatalf("Expected type %q of %s restored, got %q", kind, key, result.Type)
+			}
+		}
+	})
+}
+
+// Model of systems as created by AutoMigrate before migrations.
+type autoMigratedSystem struct {
+	gorm.Model
+	ID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Key   string    `gorm:"unique"`
+	Value string
+	Type  string
+}
+
+// Table name of autoMigratedSystem.
+func (autoMigratedSystem) TableName() string {
+	return "systems"
+}
+
+// Test migration unique_live_systems_key.
+func TestUniqueKeyMigration(t *testing.T) {
+	t.Run("Should free keys of deleted variables on databases created by AutoMigrate", func(t *testing.T) {
+		DB, cleanup, err := db.TestDB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(cleanup)
+
+		DB.AutoMigrate(&autoMigratedSystem{})
+		DB.Create(&autoMigratedSystem{ID: uuid.New(), Key: "rate", Value: "1", Type: "int"})
+
+		if err := Migrate(DB); err != nil {
+			t.Fatal(err)
+		}
+
+		repository := &SystemRepository{db: DB}
+		if _, err := repository.DeleteByKey("rate", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "2", Type: "int"}, nil); err != nil {
+			t.Fatal("Should create the key of a deleted variable again", err)
+		}
+
+		if _, err := repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "3", Type: "int"}, nil); err == nil {
+			t.Fatal("Should keep live keys unique")
+		}
+	})
+
+	t.Run("Should rename deleted variables sharing a key on down", func(t *testing.T) {
+		repository, DB := CreateSystemRepository(t)
+		deleted, _ := repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "1", Type: "int"}, nil)
+		repository.DeleteByKey("rate", nil)
+		repository.Create(&SystemEntity{ID: uuid.New(), Key: "rate", Value: "2", Type: "int"}, nil)
+
+		if _, err := (&db.Migrator{}).New(DB, Migrations).Down(3, false); err != nil {
+			t.Fatal(err)
+		}
+
+		var result System
+		DB.Unscoped().Where("id = ?", deleted.ID).First(&result)
+		if result.Key != "rate#"+deleted.ID.String() {
+			t.Fatalf("Expected the deleted variable renamed, got %s", result.Key)
+		}
+	})
+}
+
 // Create repository and test database.
-func CreateSystemRepository() (*SystemRepository, *gorm.DB) {
-	DB, _ := db.InMemoryDB()
+func CreateSystemRepository(t *testing.T) (*SystemRepository, *gorm.DB) {
+	DB, cleanup, err := db.TestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
 
 	Drop(DB)
 	Migrate(DB)
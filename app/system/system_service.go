@@ -1,122 +1,1041 @@
 package system
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"msim/app/shared"
+	"msim/app/user"
+	"msim/db"
 )
 
 type SystemEntity struct {
-	ID    uuid.UUID
-	Key   string
-	Value string
-	Type  string
+	ID          uuid.UUID
+	Key         string
+	Value       string
+	Type        string
+	ReadPolicy  Policy
+	WritePolicy Policy
+	CreatedAt   time.Time
+	// Encrypted value of a secret, its Value being SecretMask.
+	sealed string
+}
+
+// Check if actor can read the variable.
+func (s *SystemEntity) Readable(actor *user.UserEntity) bool {
+	return s.ReadPolicy.Allows(actor, user.ReadSystemPermission)
+}
+
+// Check if actor can edit the variable. Anonymous callers never can,
+// Everyone in a write policy means every authenticated user.
+func (s *SystemEntity) Writable(actor *user.UserEntity) bool {
+	return actor != nil && s.WritePolicy.Allows(actor, user.WriteSystemPermission)
+}
+
+// Return value as string, of a string or enum variable.
+func (s *SystemEntity) AsString() (string, error) {
+	if _, err := s.expect(StringType, EnumType); err != nil {
+		return "", err
+	}
+
+	return s.Value, nil
 }
 
 // Return value as int.
-func (s *SystemEntity) AsInt() int {
-	if strings.ToLower(s.Type) != "int" {
-		return 0
+func (s *SystemEntity) AsInt() (int, error) {
+	if _, err := s.expect(IntType); err != nil {
+		return 0, err
 	}
 
 	num, err := strconv.Atoi(s.Value)
 	if err != nil {
-		return 0
+		return 0, s.invalidValue(err)
 	}
 
-	return num
+	return num, nil
 }
 
 // Return value as float.
-func (s *SystemEntity) AsFloat() float64 {
-	if strings.ToLower(s.Type) != "float" {
-		return 0
+func (s *SystemEntity) AsFloat() (float64, error) {
+	if _, err := s.expect(FloatType); err != nil {
+		return 0, err
 	}
 
 	num, err := strconv.ParseFloat(s.Value, 64)
 	if err != nil {
-		return 0
+		return 0, s.invalidValue(err)
 	}
 
-	return num
+	return num, nil
 }
 
 // Return value as boolean.
-func (s *SystemEntity) AsBool() bool {
-	if strings.ToLower(s.Type) != "boolean" {
-		return false
+func (s *SystemEntity) AsBool() (bool, error) {
+	if _, err := s.expect(BooleanType); err != nil {
+		return false, err
 	}
 
 	boolean, err := strconv.ParseBool(s.Value)
 	if err != nil {
-		return false
+		return false, s.invalidValue(err)
 	}
 
-	return boolean
+	return boolean, nil
+}
+
+// Return value as duration.
+func (s *SystemEntity) AsDuration() (time.Duration, error) {
+	if _, err := s.expect(DurationType); err != nil {
+		return 0, err
+	}
+
+	duration, err := time.ParseDuration(s.Value)
+	if err != nil {
+		return 0, s.invalidValue(err)
+	}
+
+	return duration, nil
+}
+
+// Decode value of a json variable into target.
+func (s *SystemEntity) AsJSON(target any) error {
+	if _, err := s.expect(JSONType); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(s.Value), target); err != nil {
+		return s.invalidValue(err)
+	}
+
+	return nil
+}
+
+// Decode value of a list variable into target slice.
+func (s *SystemEntity) AsList(target any) error {
+	if _, err := s.expect(ListType); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(s.Value), target); err != nil {
+		return s.invalidValue(err)
+	}
+
+	return nil
 }
 
 type SystemService struct {
 	systemRepository *SystemRepository
+	cache            *Cache
+	keyring          *Keyring
+	broker           Broker
+}
+
+// Create a SystemService instance, lookups by key are cached unless cache is
+// nil and secret variables are refused unless keyring is set.
+func (service *SystemService) New(systemRepository *SystemRepository, cache *Cache, keyring *Keyring) *SystemService {
+	return &SystemService{systemRepository: systemRepository, cache: cache, keyring: keyring}
 }
 
 type SystemEnvDTO struct {
-	Key   string
-	Value string
-	Type  string
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Type        string `json:"type"`
+	ReadPolicy  Policy `json:"read_policy,omitempty"`
+	WritePolicy Policy `json:"write_policy,omitempty"`
+	Reason      string `json:"reason,omitempty"`
 }
 
-func (service *SystemService) Create(s *SystemEnvDTO) (*SystemEntity, *shared.Exception) {
-	entity := &SystemEntity{ID: uuid.New(), Key: s.Key, Value: s.Value, Type: s.Type}
-	result, err := service.systemRepository.Create(entity)
+// Create a system variable, actor must be allowed to write system variables
+// and to manage policies when setting any.
+func (service *SystemService) Create(actor *user.UserEntity, s *SystemEnvDTO) (*SystemEntity, *shared.Exception) {
+	if ex := user.Authorize(actor, user.WriteSystemPermission); ex != nil {
+		return nil, ex
+	}
+
+	if s.ReadPolicy != "" || s.WritePolicy != "" {
+		if ex := authorizePolicies(actor, s.ReadPolicy, s.WritePolicy); ex != nil {
+			return nil, ex
+		}
+	}
+
+	if err := ValidateKey(s.Key); err != nil {
+		return nil, fieldException(INVALID_KEY_EX, "key", err)
+	}
+
+	spec, err := ParseType(s.Type)
+	if err != nil {
+		return nil, fieldException(INVALID_TYPE_EX, "type", err)
+	}
+
+	if err := spec.Validate(s.Value); err != nil {
+		return nil, fieldException(INVALID_VALUE_EX, "value", err)
+	}
+
+	entity := &SystemEntity{
+		ID:          uuid.New(),
+		Key:         s.Key,
+		Value:       s.Value,
+		Type:        spec.String(),
+		ReadPolicy:  s.ReadPolicy,
+		WritePolicy: s.WritePolicy,
+	}
+	if err := service.seal(entity); err != nil {
+		return nil, fieldException(INVALID_TYPE_EX, "type", err)
+	}
+
+	result, err := service.systemRepository.Create(entity, &Audit{Actor: actor, Reason: s.Reason})
 
 	if err != nil {
-		return nil, shared.DefaultException(shared.ALREADY_CREATED_EX, "env")
+		return nil, shared.DefaultException(shared.ALREADY_CREATED_EX, "env").Wrap(err)
 	}
 
+	service.cache.Invalidate(result.Key)
+	service.broker.Publish(CreateAction, result)
 	return result, nil
 }
 
 type SystemKeyDTO struct {
-	Key string
+	Key string `json:"key"`
 }
 
-// Get a system variable by key.
-func (service *SystemService) GetByKey(dto *SystemKeyDTO) (*SystemEntity, *shared.Exception) {
-	result, err := service.systemRepository.GetByKey(dto.Key)
+// Get a system variable by key, actor must be allowed by its read policy.
+func (service *SystemService) GetByKey(actor *user.UserEntity, dto *SystemKeyDTO) (*SystemEntity, *shared.Exception) {
+	result, err := service.lookup(dto.Key)
 
 	if err != nil {
+		return nil, shared.DefaultException(shared.NOT_FOUND_EX, "env").Wrap(err)
+	}
+
+	// Unreadable variables look missing, so callers can't probe for keys.
+	if !result.Readable(actor) {
 		return nil, shared.DefaultException(shared.NOT_FOUND_EX, "env")
 	}
 
 	return result, nil
 }
 
-// Retrieves all system variables.
-func (service *SystemService) GetAll() ([]*SystemEntity, *shared.Exception) {
+// Retrieves system variables actor is allowed to read.
+func (service *SystemService) GetAll(actor *user.UserEntity) ([]*SystemEntity, *shared.Exception) {
 	result, err := service.systemRepository.GetAll()
 
 	if err != nil {
-		return nil, shared.DefaultException(shared.INTERNAL_EX, "system")
+		return nil, shared.DefaultException(shared.INTERNAL_EX, "system").Wrap(err)
+	}
+
+	readable := []*SystemEntity{}
+	for _, entity := range result {
+		if entity.Readable(actor) {
+			readable = append(readable, entity)
+		}
+	}
+
+	return readable, nil
+}
+
+type SystemListDTO struct {
+	SystemFilter
+	Page db.PageQuery
+}
+
+// List a page of variables matching the filter that actor is allowed to read.
+// Variables actor can't read are skipped, pages are filled from the next
+// ones. The total counts readable variables, walking every matching one.
+func (service *SystemService) List(actor *user.UserEntity, dto *SystemListDTO) (*db.Page[*SystemEntity], *shared.Exception) {
+	if dto.Namespace != "" {
+		if err := ValidateKey(dto.Namespace); err != nil {
+			return nil, fieldException(INVALID_KEY_EX, "namespace", err)
+		}
+	}
+
+	if dto.Type != "" && !dto.Type.Valid() {
+		return nil, fieldException(INVALID_TYPE_EX, "type", fmt.Errorf("unsupported type %q", dto.Type))
+	}
+
+	page := dto.Page
+	if ex := page.Validate(SystemSorts...); ex != nil {
+		return nil, ex
+	}
+
+	result := &db.Page[*SystemEntity]{Items: []*SystemEntity{}}
+	batch := page
+	batch.Total = false
+	for {
+		fetched, err := service.systemRepository.List(&dto.SystemFilter, &batch)
+		if err != nil {
+			return nil, shared.InternalErrorException().Wrap(err)
+		}
+
+		for i, entity := range fetched.Items {
+			if !entity.Readable(actor) {
+				continue
+			}
+
+			result.Items = append(result.Items, entity)
+			if len(result.Items) == page.Limit {
+				if i < len(fetched.Items)-1 || fetched.NextCursor != "" {
+					result.NextCursor = fetched.CursorAt(i)
+				}
+				break
+			}
+		}
+
+		if len(result.Items) == page.Limit || fetched.NextCursor == "" {
+			break
+		}
+		batch.Cursor = fetched.NextCursor
+	}
+
+	if page.Total {
+		total, ex := service.countReadable(actor, &dto.SystemFilter)
+		if ex != nil {
+			return nil, ex
+		}
+		result.Total = &total
 	}
 
 	return result, nil
 }
 
+// Evaluate a flag or boolean variable for actor, who must be allowed by its
+// read policy.
+func (service *SystemService) Evaluate(actor *user.UserEntity, dto *SystemKeyDTO) (*FlagEvaluation, *shared.Exception) {
+	entity, ex := service.GetByKey(actor, dto)
+	if ex != nil {
+		return nil, ex
+	}
+
+	evaluation, err := entity.evaluate(actor)
+	if err != nil {
+		return nil, toException(err)
+	}
+
+	return evaluation, nil
+}
+
+// Evaluate every flag and boolean variable actor is allowed to read, ordered
+// by key. Variables whose value doesn't match their type are left out.
+func (service *SystemService) Flags(actor *user.UserEntity) ([]*FlagEvaluation, *shared.Exception) {
+	result, err := service.systemRepository.GetByTypes(FlagType, BooleanType)
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	evaluations := []*FlagEvaluation{}
+	for _, entity := range result {
+		if !entity.Readable(actor) {
+			continue
+		}
+
+		if evaluation, err := entity.evaluate(actor); err == nil {
+			evaluations = append(evaluations, evaluation)
+		}
+	}
+
+	return evaluations, nil
+}
+
+type SystemNamespaceDTO struct {
+	Namespace string `json:"namespace"`
+}
+
+// Get variables of a namespace actor is allowed to read, ordered by key.
+// The variable named like the namespace is included, an empty namespace
+// holds every variable.
+func (service *SystemService) GetByNamespace(actor *user.UserEntity, dto *SystemNamespaceDTO) ([]*SystemEntity, *shared.Exception) {
+	if dto.Namespace != "" {
+		if err := ValidateKey(dto.Namespace); err != nil {
+			return nil, fieldException(INVALID_KEY_EX, "namespace", err)
+		}
+	}
+
+	result, err := service.systemRepository.GetByNamespace(dto.Namespace)
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	readable := []*SystemEntity{}
+	for _, entity := range result {
+		if entity.Readable(actor) {
+			readable = append(readable, entity)
+		}
+	}
+
+	return readable, nil
+}
+
+// Get variables of a namespace actor is allowed to read as a map nested by
+// key segment, with values decoded by type. A variable that is also a
+// namespace keeps its value under the "" key of that namespace.
+func (service *SystemService) GetTree(actor *user.UserEntity, dto *SystemNamespaceDTO) (map[string]any, *shared.Exception) {
+	entities, ex := service.GetByNamespace(actor, dto)
+	if ex != nil {
+		return nil, ex
+	}
+
+	tree, err := nest(dto.Namespace, entities)
+	if err != nil {
+		return nil, toException(err)
+	}
+
+	return tree, nil
+}
+
 type SystemKeyUpdateDTO struct {
-	Key   string
-	Value string
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Edit a system variable, actor must be allowed by its write policy
+// and value must match the variable type.
+func (service *SystemService) UpdateValueByKey(actor *user.UserEntity, dto *SystemKeyUpdateDTO) (*SystemEntity, *shared.Exception) {
+	return service.UpdateByKey(actor, &SystemUpdateDTO{Key: dto.Key, Value: dto.Value, Reason: dto.Reason})
+}
+
+type SystemUpdateDTO struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Type   string `json:"type,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Edit value and type of a system variable at once, an empty type keeps the
+// current one. Actor must be allowed by its write policy and value must match
+// the resulting type.
+func (service *SystemService) UpdateByKey(actor *user.UserEntity, dto *SystemUpdateDTO) (*SystemEntity, *shared.Exception) {
+	entity, ex := service.writable(actor, dto.Key)
+	if ex != nil {
+		return nil, ex
+	}
+
+	valueType := dto.Type
+	if valueType == "" {
+		valueType = entity.Type
+	}
+
+	spec, err := ParseType(valueType)
+	if err != nil {
+		return nil, fieldException(INVALID_TYPE_EX, "type", err)
+	}
+
+	if err := spec.Validate(dto.Value); err != nil {
+		return nil, fieldException(INVALID_VALUE_EX, "value", err)
+	}
+
+	value := dto.Value
+	if spec.Base == SecretType {
+		if value, err = service.keyring.Seal(dto.Value); err != nil {
+			return nil, fieldException(INVALID_TYPE_EX, "type", err)
+		}
+	}
+
+	audit := &Audit{Actor: actor, Reason: dto.Reason}
+	result, err := service.systemRepository.UpdateByKey(dto.Key, value, spec.String(), audit)
+
+	if errors.Is(err, shared.ErrNotFound) {
+		msg := "system variable not found"
+		return nil, shared.DefaultException(shared.NOT_FOUND_EX, msg).Wrap(err)
+	}
+
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	service.cache.Invalidate(result.Key)
+	service.broker.Publish(UpdateAction, result)
+	return result, nil
+}
+
+type SystemAuditDTO struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Soft delete a system variable, its key can be created again.
+// Actor must be allowed by its write policy.
+func (service *SystemService) Delete(actor *user.UserEntity, dto *SystemAuditDTO) (*SystemEntity, *shared.Exception) {
+	if _, ex := service.writable(actor, dto.Key); ex != nil {
+		return nil, ex
+	}
+
+	result, err := service.systemRepository.DeleteByKey(dto.Key, &Audit{Actor: actor, Reason: dto.Reason})
+	if errors.Is(err, shared.ErrNotFound) {
+		msg := "system variable not found"
+		return nil, shared.DefaultException(shared.NOT_FOUND_EX, msg).Wrap(err)
+	}
+
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	service.cache.Invalidate(result.Key)
+	service.broker.Publish(DeleteAction, result)
+	return result, nil
 }
 
-// Edit a system variable.
-func (service *SystemService) UpdateValueByKey(dto *SystemKeyUpdateDTO) (*SystemEntity, *shared.Exception) {
-	result, err := service.systemRepository.UpdateValueByKey(dto.Key, dto.Value)
+// Restore the last deleted system variable of a key that is free again.
+// Actor must be allowed by its write policy.
+func (service *SystemService) Restore(actor *user.UserEntity, dto *SystemAuditDTO) (*SystemEntity, *shared.Exception) {
+	entity, err := service.systemRepository.GetDeletedByKey(dto.Key)
+	if errors.Is(err, shared.ErrNotFound) {
+		msg := "deleted system variable not found"
+		return nil, shared.DefaultException(shared.NOT_FOUND_EX, msg).Wrap(err)
+	}
+
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	if !entity.Writable(actor) {
+		return nil, shared.FormException(shared.UNAUTHORIZED_EX, dto.Key)
+	}
 
+	if _, err := service.systemRepository.GetByKey(dto.Key); err == nil {
+		return nil, shared.FormException(shared.ALREADY_CREATED_EX, "key")
+	}
+
+	result, err := service.systemRepository.RestoreByKey(dto.Key, &Audit{Actor: actor, Reason: dto.Reason})
 	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	service.cache.Invalidate(result.Key)
+	service.broker.Publish(RestoreAction, result)
+	return result, nil
+}
+
+// Permanently delete a system variable, deleted or not, keeping its history.
+// Actor must be allowed to purge system variables.
+func (service *SystemService) Purge(actor *user.UserEntity, dto *SystemAuditDTO) (*SystemEntity, *shared.Exception) {
+	if ex := user.Authorize(actor, user.PurgeSystemPermission); ex != nil {
+		return nil, ex
+	}
+
+	result, err := service.systemRepository.PurgeByKey(dto.Key, &Audit{Actor: actor, Reason: dto.Reason})
+	if errors.Is(err, shared.ErrNotFound) {
 		msg := "system variable not found"
-		return nil, shared.DefaultException(shared.INTERNAL_EX, msg)
+		return nil, shared.DefaultException(shared.NOT_FOUND_EX, msg).Wrap(err)
+	}
+
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
 	}
 
+	service.cache.Invalidate(result.Key)
+	service.broker.Publish(PurgeAction, result)
 	return result, nil
 }
+
+// Decrypt the value of a secret variable, recording the reveal in its history.
+// Actor must be allowed by its read policy and to reveal secrets.
+func (service *SystemService) RevealSecret(actor *user.UserEntity, dto *SystemAuditDTO) (string, *shared.Exception) {
+	if ex := user.Authorize(actor, user.RevealSecretPermission); ex != nil {
+		return "", ex
+	}
+
+	entity, ex := service.GetByKey(actor, &SystemKeyDTO{Key: dto.Key})
+	if ex != nil {
+		return "", ex
+	}
+
+	if _, err := entity.expect(SecretType); err != nil {
+		return "", toException(err)
+	}
+
+	result, err := service.systemRepository.RevealByKey(dto.Key, &Audit{Actor: actor, Reason: dto.Reason})
+	if errors.Is(err, shared.ErrNotFound) {
+		msg := "system variable not found"
+		return "", shared.DefaultException(shared.NOT_FOUND_EX, msg).Wrap(err)
+	}
+
+	if err != nil {
+		return "", shared.InternalErrorException().Wrap(err)
+	}
+
+	value, err := service.keyring.Open(result.sealed)
+	if err != nil {
+		return "", shared.InternalErrorException().Wrap(err)
+	}
+
+	return value, nil
+}
+
+// Seal every secret sealed by an older master key, history included, with
+// the current one. Returns the number of values sealed again, once done the
+// older master keys can be removed.
+func (service *SystemService) RotateSecrets() (int, *shared.Exception) {
+	if service.keyring == nil {
+		return 0, shared.InternalErrorException().Wrap(errNoKeyring)
+	}
+
+	count, err := service.systemRepository.ResealSecrets(service.keyring.Reseal)
+	if err != nil {
+		return 0, shared.InternalErrorException().Wrap(err)
+	}
+
+	service.cache.Clear()
+	return count, nil
+}
+
+// Get recorded changes of a system variable, oldest first,
+// actor must be allowed by its read policy.
+func (service *SystemService) History(actor *user.UserEntity, dto *SystemKeyDTO) ([]*HistoryEntry, *shared.Exception) {
+	if _, ex := service.GetByKey(actor, dto); ex != nil {
+		return nil, ex
+	}
+
+	result, err := service.systemRepository.History(dto.Key)
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	return result, nil
+}
+
+type SystemRollbackDTO struct {
+	Key     string `json:"key"`
+	Version int    `json:"version"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Set a system variable back to its value at version, recording the rollback
+// as a new version. Actor must be allowed by its write policy.
+func (service *SystemService) Rollback(actor *user.UserEntity, dto *SystemRollbackDTO) (*SystemEntity, *shared.Exception) {
+	entity, ex := service.writable(actor, dto.Key)
+	if ex != nil {
+		return nil, ex
+	}
+
+	entry, err := service.systemRepository.HistoryVersion(dto.Key, dto.Version)
+	if errors.Is(err, shared.ErrNotFound) {
+		return nil, shared.FormException(shared.NOT_FOUND_EX, "version").Wrap(err)
+	}
+
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	valueType := entry.NewType
+	if valueType == "" {
+		valueType = entity.Type
+	}
+
+	spec, err := ParseType(valueType)
+	if err != nil {
+		return nil, fieldException(INVALID_TYPE_EX, "type", err)
+	}
+
+	if err := spec.Validate(entry.NewValue); err != nil {
+		return nil, fieldException(INVALID_VALUE_EX, "version", err)
+	}
+
+	reason := dto.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("rollback to version %d", dto.Version)
+	}
+
+	result, err := service.systemRepository.RollbackByKey(dto.Key, dto.Version, &Audit{Actor: actor, Reason: reason})
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	service.cache.Invalidate(result.Key)
+	service.broker.Publish(RollbackAction, result)
+	return result, nil
+}
+
+// Watch committed changes of keys, every key when none, that actor is allowed
+// to read. Events reach watchers of this process only, a watcher not keeping
+// up misses events. The channel is closed once ctx is done.
+func (service *SystemService) Watch(ctx context.Context, actor *user.UserEntity, keys ...string) <-chan *Event {
+	return service.broker.Subscribe(ctx, actor, keys...)
+}
+
+// Export variables actor is allowed to read, ordered by key, in format.
+func (service *SystemService) Export(actor *user.UserEntity, format Format) ([]byte, *shared.Exception) {
+	entities, ex := service.GetAll(actor)
+	if ex != nil {
+		return nil, ex
+	}
+
+	variables := []*Variable{}
+	for _, entity := range entities {
+		variables = append(variables, &Variable{
+			Key:         entity.Key,
+			Value:       entity.Value,
+			Type:        entity.Type,
+			ReadPolicy:  entity.ReadPolicy,
+			WritePolicy: entity.WritePolicy,
+		})
+	}
+
+	data, err := Encode(format, variables)
+	if err != nil {
+		return nil, fieldException(shared.APPLICATION_EX, "format", err)
+	}
+
+	return data, nil
+}
+
+type SystemImportDTO struct {
+	Format Format
+	Mode   ImportMode
+	DryRun bool
+	Reason string
+	Data   []byte
+}
+
+// Import variables from a file, all of them or none. Actor must be allowed to
+// write system variables, by the write policy of every changed variable and
+// to manage policies when the file sets any. A dry run only reports changes.
+func (service *SystemService) Import(actor *user.UserEntity, dto *SystemImportDTO) (*ImportReport, *shared.Exception) {
+	if ex := user.Authorize(actor, user.WriteSystemPermission); ex != nil {
+		return nil, ex
+	}
+
+	if !dto.Mode.Valid() {
+		return nil, shared.FormException(shared.APPLICATION_EX, "mode")
+	}
+
+	variables, err := Decode(dto.Format, dto.Data)
+	if err != nil {
+		return nil, fieldException(shared.APPLICATION_EX, "file", err)
+	}
+
+	for _, variable := range variables {
+		if err := ValidateKey(variable.Key); err != nil {
+			return nil, fieldException(INVALID_KEY_EX, variable.Key, err)
+		}
+
+		spec, err := ParseType(variable.Type)
+		if err != nil {
+			return nil, fieldException(INVALID_TYPE_EX, variable.Key, err)
+		}
+
+		if err := spec.Validate(variable.Value); err != nil {
+			return nil, fieldException(INVALID_VALUE_EX, variable.Key, err)
+		}
+
+		variable.Type = spec.String()
+	}
+
+	stored, err := service.systemRepository.GetAll()
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	changes := plan(dto.Mode, stored, variables)
+	if ex := authorizeImport(actor, stored, variables, changes); ex != nil {
+		return nil, ex
+	}
+
+	if ex := service.sealImport(stored, changes); ex != nil {
+		return nil, ex
+	}
+
+	report := &ImportReport{DryRun: dto.DryRun, Changes: changes}
+	if dto.DryRun {
+		return report, nil
+	}
+
+	for _, change := range changes {
+		if change.Action == CreateAction {
+			change.entity.ID = uuid.New()
+		}
+	}
+
+	if err := service.systemRepository.Import(changes, &Audit{Actor: actor, Reason: dto.Reason}); err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	for _, change := range changes {
+		if change.Action == CreateAction || change.Action == UpdateAction || change.Action == DeleteAction {
+			service.cache.Invalidate(change.Key)
+			service.broker.Publish(change.Action, change.entity)
+		}
+	}
+
+	return report, nil
+}
+
+type SystemMoveDTO struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Move every variable of a namespace to another one, renaming billing.eu.rate
+// to invoicing.eu.rate when moving billing to invoicing. Actor must be allowed
+// by the write policy of every moved variable and no key may be taken.
+func (service *SystemService) Move(actor *user.UserEntity, dto *SystemMoveDTO) ([]*SystemEntity, *shared.Exception) {
+	if err := ValidateKey(dto.From); err != nil {
+		return nil, fieldException(INVALID_KEY_EX, "from", err)
+	}
+
+	if err := ValidateKey(dto.To); err != nil {
+		return nil, fieldException(INVALID_KEY_EX, "to", err)
+	}
+
+	if InNamespace(dto.To, dto.From) || InNamespace(dto.From, dto.To) {
+		return nil, fieldException(INVALID_KEY_EX, "to", fmt.Errorf("%s and %s overlap", dto.From, dto.To))
+	}
+
+	authorize := func(entity *SystemEntity) error {
+		if !entity.Writable(actor) {
+			return shared.FormException(shared.UNAUTHORIZED_EX, entity.Key)
+		}
+		return nil
+	}
+
+	result, err := service.systemRepository.MoveNamespace(dto.From, dto.To, authorize, &Audit{Actor: actor, Reason: dto.Reason})
+	if err != nil {
+		return nil, toException(err)
+	}
+
+	for _, entity := range result {
+		old := *entity
+		old.Key = MoveKey(entity.Key, dto.To, dto.From)
+
+		service.cache.Invalidate(old.Key)
+		service.cache.Invalidate(entity.Key)
+		service.broker.Publish(DeleteAction, &old)
+		service.broker.Publish(CreateAction, entity)
+	}
+
+	return result, nil
+}
+
+type SystemPolicyDTO struct {
+	Key         string `json:"key"`
+	ReadPolicy  Policy `json:"read_policy"`
+	WritePolicy Policy `json:"write_policy"`
+}
+
+// Set access policies of a system variable, actor must be allowed to manage policies.
+func (service *SystemService) UpdatePoliciesByKey(actor *user.UserEntity, dto *SystemPolicyDTO) (*SystemEntity, *shared.Exception) {
+	if ex := authorizePolicies(actor, dto.ReadPolicy, dto.WritePolicy); ex != nil {
+		return nil, ex
+	}
+
+	result, err := service.systemRepository.UpdatePoliciesByKey(dto.Key, dto.ReadPolicy, dto.WritePolicy)
+
+	if errors.Is(err, shared.ErrNotFound) {
+		msg := "system variable not found"
+		return nil, shared.DefaultException(shared.NOT_FOUND_EX, msg).Wrap(err)
+	}
+
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	service.cache.Invalidate(result.Key)
+	return result, nil
+}
+
+// Get hits and misses of the lookup cache.
+func (service *SystemService) CacheStats() CacheStats {
+	return service.cache.Stats()
+}
+
+// PRIVATE:
+
+// Get variable of key from cache, reading through to the repository.
+func (service *SystemService) lookup(key string) (*SystemEntity, error) {
+	generation := service.cache.Generation(key)
+	if entity, ok := service.cache.Get(key); ok {
+		return entity, nil
+	}
+
+	entity, err := service.systemRepository.GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	service.cache.Set(entity, generation)
+	return entity, nil
+}
+
+// Count variables matching filter that actor is allowed to read.
+func (service *SystemService) countReadable(actor *user.UserEntity, filter *SystemFilter) (int64, *shared.Exception) {
+	var total int64
+
+	page := &db.PageQuery{Limit: db.MaxPageLimit, Sort: SystemSorts[0], Order: db.Ascending}
+	for {
+		fetched, err := service.systemRepository.List(filter, page)
+		if err != nil {
+			return 0, shared.InternalErrorException().Wrap(err)
+		}
+
+		for _, entity := range fetched.Items {
+			if entity.Readable(actor) {
+				total++
+			}
+		}
+
+		if fetched.NextCursor == "" {
+			return total, nil
+		}
+		page.Cursor = fetched.NextCursor
+	}
+}
+
+// Seal the value of a secret entity with the master key, masking its Value.
+func (service *SystemService) seal(entity *SystemEntity) error {
+	if entity.Type != string(SecretType) {
+		return nil
+	}
+
+	sealed, err := service.keyring.Seal(entity.Value)
+	if err != nil {
+		return err
+	}
+
+	entity.Value, entity.sealed = SecretMask, sealed
+	return nil
+}
+
+// Seal secret values of planned import changes and mask them in the report.
+// A masked value, as exported, keeps the stored secret.
+func (service *SystemService) sealImport(stored []*SystemEntity, changes []*ImportChange) *shared.Exception {
+	current := map[string]*SystemEntity{}
+	for _, entity := range stored {
+		current[entity.Key] = entity
+	}
+
+	for _, change := range changes {
+		if change.NewType != string(SecretType) {
+			continue
+		}
+
+		if change.NewValue == SecretMask {
+			old, ok := current[change.Key]
+			if !ok || old.Type != string(SecretType) {
+				return fieldException(INVALID_VALUE_EX, change.Key, errors.New("masked secret has no value to import"))
+			}
+			change.entity.Value, change.entity.sealed = SecretMask, old.sealed
+			continue
+		}
+
+		if change.Action == CreateAction || change.Action == UpdateAction {
+			if err := service.seal(change.entity); err != nil {
+				return fieldException(INVALID_TYPE_EX, change.Key, err)
+			}
+		}
+		change.NewValue = SecretMask
+	}
+
+	return nil
+}
+
+// Get variable of key when actor is allowed by its write policy.
+func (service *SystemService) writable(actor *user.UserEntity, key string) (*SystemEntity, *shared.Exception) {
+	entity, err := service.systemRepository.GetByKey(key)
+
+	if errors.Is(err, shared.ErrNotFound) {
+		msg := "system variable not found"
+		return nil, shared.DefaultException(shared.NOT_FOUND_EX, msg).Wrap(err)
+	}
+
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	if !entity.Writable(actor) {
+		return nil, shared.FormException(shared.UNAUTHORIZED_EX, key)
+	}
+
+	return entity, nil
+}
+
+// Check the variable type is one of bases.
+func (s *SystemEntity) expect(bases ...ValueType) (*TypeSpec, error) {
+	spec, err := ParseType(s.Type)
+	if err != nil {
+		return nil, fieldException(INVALID_TYPE_EX, s.Key, err)
+	}
+
+	for _, base := range bases {
+		if spec.Base == base {
+			return spec, nil
+		}
+	}
+
+	return nil, fieldException(INVALID_TYPE_EX, s.Key, fmt.Errorf("%s is a %s", s.Key, spec))
+}
+
+// Get exception for a value not matching the variable type.
+func (s *SystemEntity) invalidValue(err error) error {
+	return fieldException(INVALID_VALUE_EX, s.Key, err)
+}
+
+// Get exception of err, internal unless err is one.
+func toException(err error) *shared.Exception {
+	var ex *shared.Exception
+	if errors.As(err, &ex) {
+		return ex
+	}
+
+	return shared.InternalErrorException().Wrap(err)
+}
+
+// Get exception on field with err as reason.
+func fieldException(tag shared.ErrorTag, field string, err error) *shared.Exception {
+	ex := shared.FormException(tag, field)
+	ex.Reason = err.Error()
+	return ex
+}
+
+// Check actor may apply the planned import changes.
+func authorizeImport(actor *user.UserEntity, stored []*SystemEntity, variables []*Variable, changes []*ImportChange) *shared.Exception {
+	current := map[string]*SystemEntity{}
+	for _, entity := range stored {
+		current[entity.Key] = entity
+	}
+
+	imported := map[string]*Variable{}
+	for _, variable := range variables {
+		imported[variable.Key] = variable
+	}
+
+	for _, change := range changes {
+		if change.Action == UpdateAction || change.Action == DeleteAction {
+			if !current[change.Key].Writable(actor) {
+				return shared.FormException(shared.UNAUTHORIZED_EX, change.Key)
+			}
+		}
+
+		variable := imported[change.Key]
+		setsPolicies := change.Action == CreateAction && (variable.ReadPolicy != "" || variable.WritePolicy != "")
+		changesPolicies := change.Action == UpdateAction && policiesChanged(current[change.Key], variable)
+
+		if setsPolicies || changesPolicies {
+			if ex := authorizePolicies(actor, variable.ReadPolicy, variable.WritePolicy); ex != nil {
+				return ex
+			}
+		}
+	}
+
+	return nil
+}
+
+// Check actor can manage policies and both are well formed.
+func authorizePolicies(actor *user.UserEntity, read, write Policy) *shared.Exception {
+	if ex := user.Authorize(actor, user.ManagePoliciesPermission); ex != nil {
+		return ex
+	}
+
+	if !read.Valid() {
+		return shared.FormException(shared.APPLICATION_EX, "read_policy")
+	}
+
+	if !write.Valid() {
+		return shared.FormException(shared.APPLICATION_EX, "write_policy")
+	}
+
+	return nil
+}
@@ -1,19 +1,32 @@
 package system
 
 import (
+	"context"
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"msim/app/shared"
+	"msim/app/user"
 	"msim/db"
 )
 
+// Authenticated users of each role.
+var (
+	admin    = &user.UserEntity{ID: uuid.New(), Name: "admin", Role: user.AdminRole}
+	operator = &user.UserEntity{ID: uuid.New(), Name: "operator", Role: user.OperatorRole}
+	reader   = &user.UserEntity{ID: uuid.New(), Name: "reader", Role: user.ReaderRole}
+)
+
 // Test create.
 func TestCreateService(t *testing.T) {
 	t.Run("Should create a system env", func(t *testing.T) {
-		service, DB := CreateSystemService()
-		result, err := service.Create(&SystemEnvDTO{"test", "teste2", "string"})
+		service, DB := CreateSystemService(t)
+		result, err := service.Create(operator, &SystemEnvDTO{Key: "test", Value: "teste2", Type: "string"})
 
 		if err != nil {
 			t.Fatal(err)
@@ -28,10 +41,10 @@ func TestCreateService(t *testing.T) {
 	})
 
 	t.Run("Should not create a system env when already exists", func(t *testing.T) {
-		service, DB := CreateSystemService()
+		service, DB := CreateSystemService(t)
 
 		DB.Create(&System{Key: "test", Value: "12345", Type: "int"})
-		result, err := service.Create(&SystemEnvDTO{"test", "teste2", "string"})
+		result, err := service.Create(operator, &SystemEnvDTO{Key: "test", Value: "teste2", Type: "string"})
 
 		if err == nil {
 			t.Fatal("Should not create a system env")
@@ -41,17 +54,123 @@ func TestCreateService(t *testing.T) {
 			t.Fatal("Result should be nil")
 		}
 	})
+
+	t.Run("Should not create a system env without write permission", func(t *testing.T) {
+		service, DB := CreateSystemService(t)
+
+		for _, actor := range []*user.UserEntity{reader, nil} {
+			if _, err := service.Create(actor, &SystemEnvDTO{Key: "test", Value: "teste2", Type: "string"}); !errors.Is(err, shared.ErrUnauthorized) {
+				t.Fatal("Should throw an unauthorized exception")
+			}
+		}
+
+		var count int64
+		DB.Model(&System{}).Count(&count)
+		if count != 0 {
+			t.Fatal("Should not create a system env")
+		}
+	})
+}
+
+// Test value validation on create and update.
+func TestValueValidationService(t *testing.T) {
+	t.Run("Should not create a value not matching its type", func(t *testing.T) {
+		service, DB := CreateSystemService(t)
+
+		_, err := service.Create(operator, &SystemEnvDTO{Key: "test", Value: "hello", Type: "int"})
+		if !errors.Is(err, ErrInvalidValue) || err.Field != "value" {
+			t.Fatal("Should throw an invalid value exception on value")
+		}
+
+		var count int64
+		DB.Model(&System{}).Count(&count)
+		if count != 0 {
+			t.Fatal("Should not create a system env")
+		}
+	})
+
+	t.Run("Should not create a variable of an unsupported type", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+
+		_, err := service.Create(operator, &SystemEnvDTO{Key: "test", Value: "1", Type: "integer"})
+		if !errors.Is(err, ErrInvalidType) || err.Field != "type" {
+			t.Fatal("Should throw an invalid type exception on type")
+		}
+	})
+
+	t.Run("Should store the normalized type", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+
+		result, err := service.Create(operator, &SystemEnvDTO{Key: "color", Value: "red", Type: "Enum: red, green"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Type != "enum:red,green" {
+			t.Fatalf("Expected type enum:red,green, got %s", result.Type)
+		}
+	})
+
+	t.Run("Should not update a value not matching its type", func(t *testing.T) {
+		service, DB := CreateSystemService(t)
+		DB.Create(&System{ID: uuid.New(), Key: "color", Value: "red", Type: "enum:red,green"})
+
+		_, err := service.UpdateValueByKey(operator, &SystemKeyUpdateDTO{Key: "color", Value: "blue"})
+		if !errors.Is(err, ErrInvalidValue) || err.Reason != "expects one of red, green" {
+			t.Fatal("Should throw an invalid value exception with the allowed values")
+		}
+	})
+}
+
+// Test typed getters.
+func TestTypedGetters(t *testing.T) {
+	t.Run("Should return typed values", func(t *testing.T) {
+		number, err := (&SystemEntity{Value: "42", Type: "int"}).AsInt()
+		if err != nil || number != 42 {
+			t.Fatalf("AsInt() is %d, %v", number, err)
+		}
+
+		duration, err := (&SystemEntity{Value: "1m30s", Type: "duration"}).AsDuration()
+		if err != nil || duration.Seconds() != 90 {
+			t.Fatalf("AsDuration() is %s, %v", duration, err)
+		}
+
+		var list []int
+		if err := (&SystemEntity{Value: "[1, 2]", Type: "list:int"}).AsList(&list); err != nil || len(list) != 2 {
+			t.Fatalf("AsList() is %v, %v", list, err)
+		}
+	})
+
+	t.Run("Should return an error on type mismatch", func(t *testing.T) {
+		entity := &SystemEntity{Key: "test", Value: "hello", Type: "string"}
+
+		if _, err := entity.AsInt(); !errors.Is(err, ErrInvalidType) {
+			t.Fatal("AsInt() expects an invalid type exception")
+		}
+
+		if _, err := entity.AsBool(); !errors.Is(err, ErrInvalidType) {
+			t.Fatal("AsBool() expects an invalid type exception")
+		}
+	})
+
+	t.Run("Should return an error on a malformed stored value", func(t *testing.T) {
+		entity := &SystemEntity{Key: "test", Value: "hello", Type: "float"}
+
+		if _, err := entity.AsFloat(); !errors.Is(err, ErrInvalidValue) {
+			t.Fatal("AsFloat() expects an invalid value exception")
+		}
+	})
 }
 
 // Test GetByKey.
 func TestGetSystemByKeyService(t *testing.T) {
 	t.Run("Should get system variable by key when it exists", func(t *testing.T) {
-		service, DB := CreateSystemService()
+		service, DB := CreateSystemService(t)
 
 		created := System{ID: uuid.New(), Key: "test", Value: "123", Type: "string"}
 		DB.Create(&created)
 
-		result, _ := service.GetByKey(&SystemKeyDTO{Key: created.Key})
+		result, _ := service.GetByKey(reader, &SystemKeyDTO{Key: created.Key})
 
 		resultType := reflect.TypeOf(result)
 		expectedType := reflect.TypeOf((*SystemEntity)(nil))
@@ -67,8 +186,8 @@ func TestGetSystemByKeyService(t *testing.T) {
 	})
 
 	t.Run("Should not get system variable by key when it doesn't exist", func(t *testing.T) {
-		service, _ := CreateSystemService()
-		result, err := service.GetByKey(&SystemKeyDTO{Key: "NonExistentKey"})
+		service, _ := CreateSystemService(t)
+		result, err := service.GetByKey(reader, &SystemKeyDTO{Key: "NonExistentKey"})
 
 		if err == nil {
 			t.Fatal("Should throw error")
@@ -83,7 +202,7 @@ func TestGetSystemByKeyService(t *testing.T) {
 // Test GetAll
 func TestGetAllService(t *testing.T) {
 	t.Run("Should retrieve all system variables", func(t *testing.T) {
-		service, DB := CreateSystemService()
+		service, DB := CreateSystemService(t)
 
 		// Create some system variables
 		variables := []System{
@@ -93,7 +212,7 @@ func TestGetAllService(t *testing.T) {
 		}
 		DB.Create(&variables)
 
-		result, _ := service.GetAll()
+		result, _ := service.GetAll(reader)
 
 		expectedLength := len(variables)
 		if len(result) != expectedLength {
@@ -109,9 +228,9 @@ func TestGetAllService(t *testing.T) {
 	})
 
 	t.Run("Should retrieve an empty list of system variables", func(t *testing.T) {
-		service, _ := CreateSystemService()
+		service, _ := CreateSystemService(t)
 
-		result, _ := service.GetAll()
+		result, _ := service.GetAll(reader)
 
 		expectedLength := 0
 		if len(result) != expectedLength {
@@ -123,7 +242,7 @@ func TestGetAllService(t *testing.T) {
 // Test UpdateValueByKey.
 func TestUpdateValueByKeyService(t *testing.T) {
 	t.Run("Should update the value of an existing system variable", func(t *testing.T) {
-		service, DB := CreateSystemService()
+		service, DB := CreateSystemService(t)
 
 		initialVariable := System{ID: uuid.New(), Key: "key1", Value: "value1", Type: "string"}
 		DB.Create(&initialVariable)
@@ -133,7 +252,7 @@ func TestUpdateValueByKeyService(t *testing.T) {
 			Key:   initialVariable.Key,
 			Value: newValue,
 		}
-		result, err := service.UpdateValueByKey(dto)
+		result, err := service.UpdateValueByKey(operator, dto)
 
 		if err != nil {
 			t.Fatal(err)
@@ -151,23 +270,926 @@ func TestUpdateValueByKeyService(t *testing.T) {
 	})
 
 	t.Run("Should return an error if key does not exist", func(t *testing.T) {
-		service, _ := CreateSystemService()
+		service, _ := CreateSystemService(t)
 		dto := &SystemKeyUpdateDTO{
 			Key:   "NonExistentKey",
 			Value: "updatedValue",
 		}
 
-		_, err := service.UpdateValueByKey(dto)
+		_, err := service.UpdateValueByKey(operator, dto)
 
 		if err == nil {
 			t.Fatal("Expected an error, got nil")
 		}
 	})
+
+	t.Run("Should not update a system variable without write permission", func(t *testing.T) {
+		service, DB := CreateSystemService(t)
+		DB.Create(&System{ID: uuid.New(), Key: "key1", Value: "value1", Type: "string"})
+
+		dto := &SystemKeyUpdateDTO{Key: "key1", Value: "updatedValue"}
+		if _, err := service.UpdateValueByKey(reader, dto); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+
+		var find System
+		DB.Where("key = ?", "key1").First(&find)
+		if find.Value != "value1" {
+			t.Fatal("Should not update the value")
+		}
+	})
+}
+
+// Test read and write policies.
+func TestPoliciesService(t *testing.T) {
+	t.Run("Should filter out variables the caller cannot read", func(t *testing.T) {
+		service, DB := CreateSystemService(t)
+
+		DB.Create(&[]System{
+			{ID: uuid.New(), Key: "public", Value: "1", Type: "int", ReadPolicy: Everyone},
+			{ID: uuid.New(), Key: "default", Value: "2", Type: "int"},
+			{ID: uuid.New(), Key: "billing", Value: "3", Type: "int", ReadPolicy: "role:operator"},
+		})
+
+		cases := []struct {
+			actor    *user.UserEntity
+			expected []string
+		}{
+			{nil, []string{"public"}},
+			{reader, []string{"default", "public"}},
+			{operator, []string{"billing", "default", "public"}},
+			{admin, []string{"billing", "default", "public"}},
+		}
+
+		for _, c := range cases {
+			result, err := service.GetAll(c.actor)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var keys []string
+			for _, entity := range result {
+				keys = append(keys, entity.Key)
+			}
+
+			if !reflect.DeepEqual(keys, c.expected) {
+				t.Fatalf("Expected keys %v, got %v", c.expected, keys)
+			}
+		}
+	})
+
+	t.Run("Should not get a variable the caller cannot read", func(t *testing.T) {
+		service, DB := CreateSystemService(t)
+		DB.Create(&System{ID: uuid.New(), Key: "billing", Value: "3", Type: "int", ReadPolicy: "role:operator"})
+
+		if _, err := service.GetByKey(reader, &SystemKeyDTO{Key: "billing"}); !errors.Is(err, shared.ErrNotFound) {
+			t.Fatal("Should throw a not found exception")
+		}
+
+		if _, err := service.GetByKey(operator, &SystemKeyDTO{Key: "billing"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Should only let policy principals edit a variable", func(t *testing.T) {
+		service, DB := CreateSystemService(t)
+		owner := &user.UserEntity{ID: uuid.New(), Name: "owner", Role: user.ReaderRole}
+		DB.Create(&System{ID: uuid.New(), Key: "kill_switch", Value: "false", Type: "boolean", WritePolicy: "user:" + owner.ID.String()})
+
+		dto := &SystemKeyUpdateDTO{Key: "kill_switch", Value: "true"}
+		if _, err := service.UpdateValueByKey(operator, dto); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+
+		if _, err := service.UpdateValueByKey(owner, dto); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Should only let authenticated users edit world-writable variables", func(t *testing.T) {
+		service, DB := CreateSystemService(t)
+		DB.Create(&System{ID: uuid.New(), Key: "banner", Value: "hi", Type: "string", WritePolicy: Everyone})
+
+		dto := &SystemKeyUpdateDTO{Key: "banner", Value: "hello"}
+		if _, err := service.UpdateValueByKey(nil, dto); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+
+		if _, err := service.UpdateValueByKey(reader, dto); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Should set policies when caller manages them", func(t *testing.T) {
+		service, DB := CreateSystemService(t)
+		DB.Create(&System{ID: uuid.New(), Key: "billing", Value: "3", Type: "int"})
+
+		dto := &SystemPolicyDTO{Key: "billing", ReadPolicy: "role:operator, role:admin", WritePolicy: "role:admin"}
+		if _, err := service.UpdatePoliciesByKey(operator, dto); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+
+		result, err := service.UpdatePoliciesByKey(admin, dto)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.ReadPolicy != dto.ReadPolicy || result.WritePolicy != dto.WritePolicy {
+			t.Fatal("Should update both policies")
+		}
+	})
+
+	t.Run("Should not set malformed policies", func(t *testing.T) {
+		service, DB := CreateSystemService(t)
+		DB.Create(&System{ID: uuid.New(), Key: "billing", Value: "3", Type: "int"})
+
+		for _, policy := range []Policy{"role:root", "user:bob", "group:ops"} {
+			dto := &SystemPolicyDTO{Key: "billing", ReadPolicy: policy}
+			if _, err := service.UpdatePoliciesByKey(admin, dto); err == nil || err.Field != "read_policy" {
+				t.Fatalf("Should reject policy %q", policy)
+			}
+		}
+	})
+}
+
+// Test History and Rollback.
+func TestHistoryService(t *testing.T) {
+	t.Run("Should audit changes with their actor and reason", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+		service.UpdateValueByKey(operator, &SystemKeyUpdateDTO{Key: "rate", Value: "2", Reason: "promo"})
+
+		result, err := service.History(reader, &SystemKeyDTO{Key: "rate"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result) != 2 || result[1].ActorName != operator.Name || result[1].Reason != "promo" {
+			t.Fatal("Should return the audited changes")
+		}
+	})
+
+	t.Run("Should not return history the caller cannot read", func(t *testing.T) {
+		service, DB := CreateSystemService(t)
+		DB.Create(&System{ID: uuid.New(), Key: "billing", Value: "3", Type: "int", ReadPolicy: "role:operator"})
+
+		if _, err := service.History(reader, &SystemKeyDTO{Key: "billing"}); !errors.Is(err, shared.ErrNotFound) {
+			t.Fatal("Should throw a not found exception")
+		}
+	})
+
+	t.Run("Should roll back and audit the rollback", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+		service.UpdateValueByKey(operator, &SystemKeyUpdateDTO{Key: "rate", Value: "2"})
+
+		result, err := service.Rollback(admin, &SystemRollbackDTO{Key: "rate", Version: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Value != "1" {
+			t.Fatalf("Expected value to be 1, got %s", result.Value)
+		}
+
+		history, _ := service.History(admin, &SystemKeyDTO{Key: "rate"})
+		rollback := history[len(history)-1]
+		if rollback.Action != RollbackAction || rollback.ActorName != admin.Name || rollback.Reason != "rollback to version 1" {
+			t.Fatal("Should audit the rollback")
+		}
+	})
+
+	t.Run("Should not roll back without write permission", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+
+		if _, err := service.Rollback(reader, &SystemRollbackDTO{Key: "rate", Version: 1}); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+	})
+
+	t.Run("Should not roll back to an unknown version", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+
+		_, err := service.Rollback(operator, &SystemRollbackDTO{Key: "rate", Version: 9})
+		if !errors.Is(err, shared.ErrNotFound) || err.Field != "version" {
+			t.Fatal("Should throw a not found exception on version")
+		}
+	})
+}
+
+// Test UpdateByKey.
+func TestUpdateByKeyService(t *testing.T) {
+	t.Run("Should change type together with value", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "timeout", Value: "30", Type: "int"})
+
+		result, err := service.UpdateByKey(operator, &SystemUpdateDTO{Key: "timeout", Value: "30s", Type: "duration"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if duration, _ := result.AsDuration(); duration != 30*time.Second {
+			t.Fatalf("Expected 30s, got %s", duration)
+		}
+	})
+
+	t.Run("Should not change type when value doesn't match it", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "timeout", Value: "30", Type: "int"})
+
+		_, err := service.UpdateByKey(operator, &SystemUpdateDTO{Key: "timeout", Value: "30", Type: "duration"})
+		if !errors.Is(err, ErrInvalidValue) {
+			t.Fatal("Should throw an invalid value exception")
+		}
+
+		result, _ := service.GetByKey(reader, &SystemKeyDTO{Key: "timeout"})
+		if result.Type != "int" {
+			t.Fatalf("Expected type int, got %s", result.Type)
+		}
+	})
+
+	t.Run("Should not change to an unsupported type", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "timeout", Value: "30", Type: "int"})
+
+		_, err := service.UpdateByKey(operator, &SystemUpdateDTO{Key: "timeout", Value: "30", Type: "decimal"})
+		if !errors.Is(err, ErrInvalidType) {
+			t.Fatal("Should throw an invalid type exception")
+		}
+	})
+}
+
+// Test Delete, Restore and Purge.
+func TestDeleteService(t *testing.T) {
+	t.Run("Should delete and restore a variable", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+
+		if _, err := service.Delete(operator, &SystemAuditDTO{Key: "rate", Reason: "unused"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := service.GetByKey(reader, &SystemKeyDTO{Key: "rate"}); !errors.Is(err, shared.ErrNotFound) {
+			t.Fatal("Should not get a deleted variable")
+		}
+
+		if _, err := service.Restore(operator, &SystemAuditDTO{Key: "rate"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := service.GetByKey(reader, &SystemKeyDTO{Key: "rate"}); err != nil {
+			t.Fatal("Should get a restored variable")
+		}
+	})
+
+	t.Run("Should not delete when write policy denies actor", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(admin, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int", WritePolicy: "role:admin"})
+
+		if _, err := service.Delete(operator, &SystemAuditDTO{Key: "rate"}); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+	})
+
+	t.Run("Should not restore a key created again", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+		service.Delete(operator, &SystemAuditDTO{Key: "rate"})
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "2", Type: "int"})
+
+		if _, err := service.Restore(operator, &SystemAuditDTO{Key: "rate"}); !errors.Is(err, shared.ErrAlreadyCreated) {
+			t.Fatal("Should throw an already created exception")
+		}
+	})
+
+	t.Run("Should only let admins purge", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+
+		if _, err := service.Purge(operator, &SystemAuditDTO{Key: "rate"}); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+
+		if _, err := service.Purge(admin, &SystemAuditDTO{Key: "rate"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := service.Restore(admin, &SystemAuditDTO{Key: "rate"}); !errors.Is(err, shared.ErrNotFound) {
+			t.Fatal("Should not restore a purged variable")
+		}
+	})
+}
+
+// Test Export and Import.
+func TestImportService(t *testing.T) {
+	file := []byte(`[
+		{"key": "rate", "value": "2", "type": "int"},
+		{"key": "banner", "value": "hello", "type": "string"}
+	]`)
+
+	t.Run("Should import what another service exported", func(t *testing.T) {
+		staging, _ := CreateSystemService(t)
+		staging.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "INT"})
+		staging.Create(operator, &SystemEnvDTO{Key: "tags", Value: `["a"]`, Type: "list:string"})
+
+		data, err := staging.Export(reader, YAMLFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		production, _ := CreateSystemService(t)
+		report, err := production.Import(operator, &SystemImportDTO{Format: YAMLFormat, Mode: UpsertMode, Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if report.Count(CreateAction) != 2 {
+			t.Fatalf("Expected 2 created variables, got %d", report.Count(CreateAction))
+		}
+
+		result, _ := production.GetByKey(reader, &SystemKeyDTO{Key: "tags"})
+		if result.Type != "list:string" || result.Value != `["a"]` {
+			t.Fatal("Should import value and type")
+		}
+	})
+
+	t.Run("Should apply each mode", func(t *testing.T) {
+		cases := []struct {
+			mode     ImportMode
+			rate     string
+			actions  map[string]int
+			obsolete bool
+		}{
+			{CreateOnlyMode, "1", map[string]int{CreateAction: 1, SkipAction: 1}, true},
+			{UpsertMode, "2", map[string]int{CreateAction: 1, UpdateAction: 1}, true},
+			{ReplaceMode, "2", map[string]int{CreateAction: 1, UpdateAction: 1, DeleteAction: 1}, false},
+		}
+
+		for _, c := range cases {
+			service, _ := CreateSystemService(t)
+			service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+			service.Create(operator, &SystemEnvDTO{Key: "obsolete", Value: "x", Type: "string"})
+
+			report, err := service.Import(operator, &SystemImportDTO{Format: JSONFormat, Mode: c.mode, Data: file})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for action, count := range c.actions {
+				if report.Count(action) != count {
+					t.Fatalf("%s expected %d %s, got %d", c.mode, count, action, report.Count(action))
+				}
+			}
+
+			rate, _ := service.GetByKey(reader, &SystemKeyDTO{Key: "rate"})
+			if rate.Value != c.rate {
+				t.Fatalf("%s expected rate %s, got %s", c.mode, c.rate, rate.Value)
+			}
+
+			_, ex := service.GetByKey(reader, &SystemKeyDTO{Key: "obsolete"})
+			if (ex == nil) != c.obsolete {
+				t.Fatalf("%s expected obsolete to be kept: %t", c.mode, c.obsolete)
+			}
+		}
+	})
+
+	t.Run("Should only report changes on a dry run", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+
+		report, err := service.Import(operator, &SystemImportDTO{Format: JSONFormat, Mode: UpsertMode, DryRun: true, Data: file})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		update := report.Changes[1]
+		if update.Key != "rate" || update.Action != UpdateAction || update.OldValue != "1" || update.NewValue != "2" {
+			t.Fatalf("Expected the update of rate from 1 to 2, got %+v", update)
+		}
+
+		rate, _ := service.GetByKey(reader, &SystemKeyDTO{Key: "rate"})
+		if rate.Value != "1" {
+			t.Fatal("Should not apply a dry run")
+		}
+	})
+
+	t.Run("Should import nothing when a variable is invalid", func(t *testing.T) {
+		service, DB := CreateSystemService(t)
+		data := []byte(`[{"key": "rate", "value": "2", "type": "int"}, {"key": "timeout", "value": "soon", "type": "duration"}]`)
+
+		_, err := service.Import(operator, &SystemImportDTO{Format: JSONFormat, Mode: UpsertMode, Data: data})
+		if !errors.Is(err, ErrInvalidValue) || err.Field != "timeout" {
+			t.Fatal("Should throw an invalid value exception on timeout")
+		}
+
+		var count int64
+		DB.Model(&System{}).Count(&count)
+		if count != 0 {
+			t.Fatalf("Expected no variable imported, got %d", count)
+		}
+	})
+
+	t.Run("Should import nothing when the transaction fails", func(t *testing.T) {
+		service, DB := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+		DB.Callback().Create().Before("gorm:create").Register("test:fail_banner", func(tx *gorm.DB) {
+			if system, ok := tx.Statement.Dest.(*System); ok && system.Key == "banner" {
+				tx.AddError(errors.New("insert failed"))
+			}
+		})
+
+		if _, err := service.Import(operator, &SystemImportDTO{Format: JSONFormat, Mode: UpsertMode, Data: file}); err == nil {
+			t.Fatal("Should throw an exception")
+		}
+
+		rate, _ := service.GetByKey(reader, &SystemKeyDTO{Key: "rate"})
+		if rate.Value != "1" {
+			t.Fatal("Should roll back the applied changes")
+		}
+	})
+
+	t.Run("Should not import over variables actor can't write", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(admin, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int", WritePolicy: "role:admin"})
+
+		_, err := service.Import(operator, &SystemImportDTO{Format: JSONFormat, Mode: UpsertMode, Data: file})
+		if !errors.Is(err, shared.ErrUnauthorized) || err.Field != "rate" {
+			t.Fatal("Should throw an unauthorized exception on rate")
+		}
+	})
+
+	t.Run("Should require managing policies to import them", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		data := []byte(`[{"key": "rate", "value": "1", "type": "int", "read_policy": "*"}]`)
+
+		if _, err := service.Import(operator, &SystemImportDTO{Format: JSONFormat, Mode: UpsertMode, Data: data}); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+
+		if _, err := service.Import(admin, &SystemImportDTO{Format: JSONFormat, Mode: UpsertMode, Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// Test Watch.
+func TestWatchService(t *testing.T) {
+	t.Run("Should deliver committed changes of watched keys", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		events := service.Watch(ctx, reader, "rate")
+		service.Create(operator, &SystemEnvDTO{Key: "other", Value: "x", Type: "string"})
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+		service.UpdateValueByKey(operator, &SystemKeyUpdateDTO{Key: "rate", Value: "2"})
+		service.UpdateValueByKey(operator, &SystemKeyUpdateDTO{Key: "rate", Value: "nope"})
+
+		for _, expected := range []Event{{Key: "rate", Action: CreateAction, Value: "1"}, {Key: "rate", Action: UpdateAction, Value: "2"}} {
+			event := ReceiveEvent(t, events)
+			if event.Key != expected.Key || event.Action != expected.Action || event.Value != expected.Value {
+				t.Fatalf("Expected %s of %s to %s, got %s of %s to %s", expected.Action, expected.Key, expected.Value, event.Action, event.Key, event.Value)
+			}
+		}
+
+		select {
+		case event := <-events:
+			t.Fatalf("Expected no more events, got %s of %s", event.Action, event.Key)
+		default:
+		}
+	})
+
+	t.Run("Should not deliver changes the watcher can't read", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		events := service.Watch(ctx, reader)
+		service.Create(admin, &SystemEnvDTO{Key: "secret", Value: "x", Type: "string", ReadPolicy: "role:admin"})
+		service.Create(admin, &SystemEnvDTO{Key: "public", Value: "y", Type: "string"})
+
+		if event := ReceiveEvent(t, events); event.Key != "public" {
+			t.Fatalf("Expected change of public, got %s", event.Key)
+		}
+	})
+
+	t.Run("Should close the channel once the context is done", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		events := service.Watch(ctx, reader)
+		cancel()
+
+		select {
+		case _, open := <-events:
+			if open {
+				t.Fatal("Should not deliver events after cancel")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Should close the channel")
+		}
+	})
+}
+
+// Test GetByNamespace, GetTree and Move.
+func TestNamespaceService(t *testing.T) {
+	t.Run("Should reject malformed keys", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+
+		_, err := service.Create(operator, &SystemEnvDTO{Key: "billing..rate", Value: "1", Type: "int"})
+		if err == nil || err.Tag != INVALID_KEY_EX || err.Field != "key" {
+			t.Fatalf("Expected %s on key, got %v", INVALID_KEY_EX, err)
+		}
+	})
+
+	t.Run("Should list and nest readable variables of a namespace", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(admin, &SystemEnvDTO{Key: "billing.eu.rate", Value: "2", Type: "int"})
+		service.Create(admin, &SystemEnvDTO{Key: "billing.eu.key", Value: "x", Type: "string", ReadPolicy: "role:admin"})
+		service.Create(admin, &SystemEnvDTO{Key: "invoicing.rate", Value: "1", Type: "int"})
+
+		result, err := service.GetByNamespace(reader, &SystemNamespaceDTO{Namespace: "billing"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result) != 1 || result[0].Key != "billing.eu.rate" {
+			t.Fatal("Should only list readable variables of the namespace")
+		}
+
+		tree, err := service.GetTree(reader, &SystemNamespaceDTO{Namespace: "billing"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[string]any{"eu": map[string]any{"rate": 2}}
+		if !reflect.DeepEqual(tree, expected) {
+			t.Fatalf("Expected %v, got %v", expected, tree)
+		}
+	})
+
+	t.Run("Should move a namespace and notify watchers", func(t *testing.T) {
+		service, _ := CreateCachedSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "billing.rate", Value: "2", Type: "int"})
+		service.GetByKey(operator, &SystemKeyDTO{Key: "billing.rate"})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := service.Watch(ctx, reader)
+
+		result, err := service.Move(operator, &SystemMoveDTO{From: "billing", To: "invoicing"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result) != 1 || result[0].Key != "invoicing.rate" {
+			t.Fatal("Should return the moved variables")
+		}
+
+		if _, err := service.GetByKey(operator, &SystemKeyDTO{Key: "billing.rate"}); err == nil || err.Tag != shared.NOT_FOUND_EX {
+			t.Fatal("Should not get the old key from the cache")
+		}
+
+		for _, expected := range []Event{{Key: "billing.rate", Action: DeleteAction}, {Key: "invoicing.rate", Action: CreateAction}} {
+			event := ReceiveEvent(t, events)
+			if event.Key != expected.Key || event.Action != expected.Action {
+				t.Fatalf("Expected %s of %s, got %s of %s", expected.Action, expected.Key, event.Action, event.Key)
+			}
+		}
+	})
+
+	t.Run("Should not move a namespace onto existing keys", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "billing.rate", Value: "2", Type: "int"})
+		service.Create(operator, &SystemEnvDTO{Key: "invoicing.rate", Value: "1", Type: "int"})
+
+		_, err := service.Move(operator, &SystemMoveDTO{From: "billing", To: "invoicing"})
+		if err == nil || err.Tag != shared.ALREADY_CREATED_EX || err.Field != "invoicing.rate" {
+			t.Fatalf("Expected %s on invoicing.rate, got %v", shared.ALREADY_CREATED_EX, err)
+		}
+	})
+
+	t.Run("Should not move a namespace into itself", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "billing.rate", Value: "2", Type: "int"})
+
+		_, err := service.Move(operator, &SystemMoveDTO{From: "billing", To: "billing.old"})
+		if err == nil || err.Tag != INVALID_KEY_EX {
+			t.Fatalf("Expected %s, got %v", INVALID_KEY_EX, err)
+		}
+	})
+
+	t.Run("Should not move variables the actor can't write", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(admin, &SystemEnvDTO{Key: "billing.rate", Value: "2", Type: "int"})
+		service.Create(admin, &SystemEnvDTO{Key: "billing.key", Value: "x", Type: "string", WritePolicy: "role:admin"})
+
+		_, err := service.Move(operator, &SystemMoveDTO{From: "billing", To: "invoicing"})
+		if err == nil || err.Tag != shared.UNAUTHORIZED_EX {
+			t.Fatalf("Expected %s, got %v", shared.UNAUTHORIZED_EX, err)
+		}
+
+		if _, err := service.GetByKey(operator, &SystemKeyDTO{Key: "billing.rate"}); err != nil {
+			t.Fatal("Should not move any variable")
+		}
+	})
+}
+
+// Test List.
+func TestListService(t *testing.T) {
+	t.Run("Should fill pages with readable variables only", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		for _, key := range []string{"a", "b", "c", "d", "e"} {
+			policy := Policy("")
+			if key == "b" || key == "c" {
+				policy = "role:admin"
+			}
+			service.Create(admin, &SystemEnvDTO{Key: key, Value: "1", Type: "int", ReadPolicy: policy})
+		}
+
+		dto := &SystemListDTO{Page: db.PageQuery{Limit: 2, Sort: "key", Total: true}}
+		first, err := service.List(reader, dto)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(first.Items) != 2 || first.Items[1].Key != "d" || first.NextCursor == "" || *first.Total != 3 {
+			t.Fatal("Should return a, d, a cursor and 3 readable variables")
+		}
+
+		dto.Page.Cursor = first.NextCursor
+		last, _ := service.List(reader, dto)
+		if len(last.Items) != 1 || last.Items[0].Key != "e" || last.NextCursor != "" {
+			t.Fatal("Should return e without a cursor")
+		}
+	})
+
+	t.Run("Should reject unknown types", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+
+		_, err := service.List(reader, &SystemListDTO{SystemFilter: SystemFilter{Type: "money"}})
+		if err == nil || err.Tag != INVALID_TYPE_EX || err.Field != "type" {
+			t.Fatalf("Expected %s on type, got %v", INVALID_TYPE_EX, err)
+		}
+	})
+}
+
+// Test Evaluate and Flags.
+func TestFlagService(t *testing.T) {
+	t.Run("Should evaluate flags and boolean variables", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		rules := `{"enabled": true, "rollout": 0, "allow": ["` + reader.ID.String() + `"]}`
+		service.Create(operator, &SystemEnvDTO{Key: "beta", Value: rules, Type: "flag"})
+		service.Create(operator, &SystemEnvDTO{Key: "maintenance", Value: "false", Type: "boolean"})
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+
+		result, err := service.Evaluate(reader, &SystemKeyDTO{Key: "beta"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !result.Enabled || result.Reason != AllowedReason {
+			t.Fatalf("Expected beta allowed, got %+v", result)
+		}
+
+		flags, err := service.Flags(operator)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(flags) != 2 || flags[0].Key != "beta" || flags[0].Enabled || flags[1].Reason != BooleanReason {
+			t.Fatalf("Expected beta excluded and maintenance off, got %+v", flags)
+		}
+	})
+
+	t.Run("Should not evaluate other types", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "rate", Value: "1", Type: "int"})
+
+		if _, err := service.Evaluate(reader, &SystemKeyDTO{Key: "rate"}); err == nil || err.Tag != INVALID_TYPE_EX {
+			t.Fatalf("Expected %s, got %v", INVALID_TYPE_EX, err)
+		}
+	})
+
+	t.Run("Should not create flags with malformed rules", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+
+		_, err := service.Create(operator, &SystemEnvDTO{Key: "beta", Value: `{"rollout": -1}`, Type: "flag"})
+		if err == nil || err.Tag != INVALID_VALUE_EX {
+			t.Fatalf("Expected %s, got %v", INVALID_VALUE_EX, err)
+		}
+	})
+
+	t.Run("Should only evaluate flags actor can read", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+		service.Create(admin, &SystemEnvDTO{Key: "internal", Value: `{"enabled": true}`, Type: "flag", ReadPolicy: "role:admin"})
+
+		if flags, _ := service.Flags(reader); len(flags) != 0 {
+			t.Fatal("Should leave out flags reader can't read")
+		}
+
+		if _, err := service.Evaluate(reader, &SystemKeyDTO{Key: "internal"}); err == nil || err.Tag != shared.NOT_FOUND_EX {
+			t.Fatalf("Expected %s, got %v", shared.NOT_FOUND_EX, err)
+		}
+	})
+}
+
+// Test secret variables.
+func TestSecretService(t *testing.T) {
+	t.Run("Should store secrets encrypted and mask them", func(t *testing.T) {
+		service, DB := CreateSecretSystemService(t)
+
+		result, err := service.Create(operator, &SystemEnvDTO{Key: "api_key", Value: "s3cr3t", Type: "secret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Value != SecretMask {
+			t.Fatalf("Expected masked value, got %s", result.Value)
+		}
+
+		var model System
+		DB.First(&model)
+		if strings.Contains(model.Value, "s3cr3t") || !strings.HasPrefix(model.Value, "v1:") {
+			t.Fatalf("Expected a sealed value, got %s", model.Value)
+		}
+
+		entities, _ := service.GetAll(operator)
+		history, _ := service.History(operator, &SystemKeyDTO{Key: "api_key"})
+		data, _ := service.Export(operator, JSONFormat)
+		if entities[0].Value != SecretMask || history[0].NewValue != SecretMask || strings.Contains(string(data), "v1:") {
+			t.Fatal("Should mask secrets in lists, history and exports")
+		}
+	})
+
+	t.Run("Should reveal secrets and record it", func(t *testing.T) {
+		service, _ := CreateSecretSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "api_key", Value: "s3cr3t", Type: "secret"})
+		service.UpdateValueByKey(operator, &SystemKeyUpdateDTO{Key: "api_key", Value: "n3w"})
+
+		value, err := service.RevealSecret(operator, &SystemAuditDTO{Key: "api_key", Reason: "debug"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value != "n3w" {
+			t.Fatalf("Expected n3w, got %s", value)
+		}
+
+		history, _ := service.History(operator, &SystemKeyDTO{Key: "api_key"})
+		last := history[len(history)-1]
+		if last.Action != RevealAction || last.ActorName != operator.Name || last.Reason != "debug" {
+			t.Fatal("Should record who revealed the secret and why")
+		}
+	})
+
+	t.Run("Should not reveal secrets to readers", func(t *testing.T) {
+		service, _ := CreateSecretSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "api_key", Value: "s3cr3t", Type: "secret"})
+
+		if _, err := service.RevealSecret(reader, &SystemAuditDTO{Key: "api_key"}); err == nil || err.Tag != shared.UNAUTHORIZED_EX {
+			t.Fatalf("Expected %s, got %v", shared.UNAUTHORIZED_EX, err)
+		}
+
+		history, _ := service.History(operator, &SystemKeyDTO{Key: "api_key"})
+		if len(history) != 1 {
+			t.Fatal("Should not record refused reveals")
+		}
+	})
+
+	t.Run("Should not create secrets without master key", func(t *testing.T) {
+		service, _ := CreateSystemService(t)
+
+		_, err := service.Create(operator, &SystemEnvDTO{Key: "api_key", Value: "s3cr3t", Type: "secret"})
+		if err == nil || err.Tag != INVALID_TYPE_EX {
+			t.Fatalf("Expected %s, got %v", INVALID_TYPE_EX, err)
+		}
+	})
+
+	t.Run("Should keep secrets imported masked", func(t *testing.T) {
+		service, _ := CreateSecretSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "api_key", Value: "s3cr3t", Type: "secret"})
+		data, _ := service.Export(operator, JSONFormat)
+
+		report, err := service.Import(operator, &SystemImportDTO{Format: JSONFormat, Mode: UpsertMode, Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if report.Count(UnchangedAction) != 1 {
+			t.Fatal("Should leave the secret unchanged")
+		}
+
+		data = []byte(`[{"key": "api_key", "value": "n3w", "type": "secret"}, {"key": "token", "value": "t0k3n", "type": "secret"}]`)
+		report, err = service.Import(operator, &SystemImportDTO{Format: JSONFormat, Mode: UpsertMode, Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, change := range report.Changes {
+			if change.NewValue != SecretMask {
+				t.Fatalf("Should mask imported secrets, got %s", change.NewValue)
+			}
+		}
+
+		for key, expected := range map[string]string{"api_key": "n3w", "token": "t0k3n"} {
+			if value, _ := service.RevealSecret(operator, &SystemAuditDTO{Key: key}); value != expected {
+				t.Fatalf("Expected %s of %s, got %s", expected, key, value)
+			}
+		}
+	})
+
+	t.Run("Should not import masked secrets of new keys", func(t *testing.T) {
+		service, _ := CreateSecretSystemService(t)
+
+		data := []byte(`[{"key": "api_key", "value": "` + SecretMask + `", "type": "secret"}]`)
+		if _, err := service.Import(operator, &SystemImportDTO{Format: JSONFormat, Mode: UpsertMode, Data: data}); err == nil || err.Tag != INVALID_VALUE_EX {
+			t.Fatalf("Expected %s, got %v", INVALID_VALUE_EX, err)
+		}
+	})
+
+	t.Run("Should keep moved secrets sealed in history", func(t *testing.T) {
+		service, _ := CreateSecretSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "billing.api_key", Value: "s3cr3t", Type: "secret"})
+
+		if _, err := service.Move(operator, &SystemMoveDTO{From: "billing", To: "invoicing"}); err != nil {
+			t.Fatal(err)
+		}
+
+		current := service.keyring.keys["current"]
+		service.keyring = CreateKeyring("new")
+		service.keyring.keys["current"] = current
+
+		if _, err := service.RotateSecrets(); err != nil {
+			t.Fatal(err)
+		}
+		delete(service.keyring.keys, "current")
+
+		if _, err := service.Rollback(operator, &SystemRollbackDTO{Key: "invoicing.api_key", Version: 1}); err != nil {
+			t.Fatal(err)
+		}
+
+		value, err := service.RevealSecret(operator, &SystemAuditDTO{Key: "invoicing.api_key"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value != "s3cr3t" {
+			t.Fatalf("Expected s3cr3t, got %s", value)
+		}
+	})
+
+	t.Run("Should rotate secrets and their history to a new master key", func(t *testing.T) {
+		service, DB := CreateSecretSystemService(t)
+		service.Create(operator, &SystemEnvDTO{Key: "api_key", Value: "s3cr3t", Type: "secret"})
+		service.UpdateValueByKey(operator, &SystemKeyUpdateDTO{Key: "api_key", Value: "n3w"})
+		service.Create(operator, &SystemEnvDTO{Key: "old_key", Value: "0ld", Type: "secret"})
+		service.Delete(operator, &SystemAuditDTO{Key: "old_key"})
+
+		current := service.keyring.keys["current"]
+		service.keyring = CreateKeyring("new")
+		service.keyring.keys["current"] = current
+
+		count, err := service.RotateSecrets()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 2 variables, old and new values of 2 updates, new values of 2 creates and a delete.
+		if count != 8 {
+			t.Fatalf("Expected 8 values sealed again, got %d", count)
+		}
+
+		delete(service.keyring.keys, "current")
+		if value, err := service.RevealSecret(operator, &SystemAuditDTO{Key: "api_key"}); err != nil || value != "n3w" {
+			t.Fatalf("Expected n3w without the old master key, got %s, %v", value, err)
+		}
+
+		if _, err := service.Rollback(operator, &SystemRollbackDTO{Key: "api_key", Version: 1}); err != nil {
+			t.Fatal(err)
+		}
+
+		if value, _ := service.RevealSecret(operator, &SystemAuditDTO{Key: "api_key"}); value != "s3cr3t" {
+			t.Fatalf("Expected s3cr3t after rollback, got %s", value)
+		}
+
+		var model System
+		DB.Unscoped().Where("key = ?", "old_key").First(&model)
+		if !strings.HasPrefix(model.Value, "v1:new:") {
+			t.Fatal("Should seal deleted variables again")
+		}
+	})
 }
 
 // Create service and test database.
-func CreateSystemService() (*SystemService, *gorm.DB) {
-	DB, _ := db.InMemoryDB()
+func CreateSystemService(t testing.TB) (*SystemService, *gorm.DB) {
+	DB, cleanup, err := db.TestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
 
 	Drop(DB)
 	Migrate(DB)
@@ -175,3 +1197,33 @@ func CreateSystemService() (*SystemService, *gorm.DB) {
 	systemRepo := &SystemRepository{db: DB}
 	return &SystemService{systemRepository: systemRepo}, DB
 }
+
+// Create service sealing secrets and test database.
+func CreateSecretSystemService(t testing.TB) (*SystemService, *gorm.DB) {
+	service, DB := CreateSystemService(t)
+	service.keyring = CreateKeyring("current")
+
+	return service, DB
+}
+
+// Create service caching lookups and test database.
+func CreateCachedSystemService(t testing.TB) (*SystemService, *gorm.DB) {
+	service, DB := CreateSystemService(t)
+	service.cache = (&Cache{}).New(time.Minute)
+
+	return service, DB
+}
+
+// Receive next event or fail after a second.
+func ReceiveEvent(t *testing.T, events <-chan *Event) *Event {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("Expected an event")
+	}
+
+	return nil
+}
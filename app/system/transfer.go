@@ -0,0 +1,302 @@
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Format string
+
+// File formats of imports and exports.
+const (
+	JSONFormat   Format = "json"
+	YAMLFormat   Format = "yaml"
+	DotenvFormat Format = "env"
+)
+
+type ImportMode string
+
+// How an import treats variables already stored.
+const (
+	// Create new variables only, skipping existing keys.
+	CreateOnlyMode ImportMode = "create"
+	// Create new variables and update existing keys.
+	UpsertMode ImportMode = "upsert"
+	// Upsert, then delete variables missing from the file.
+	ReplaceMode ImportMode = "replace"
+)
+
+// Outcomes of an imported variable besides create, update and delete.
+const (
+	SkipAction      = "skip"
+	UnchangedAction = "unchanged"
+)
+
+// Comment giving the type of the next dotenv variable.
+const dotenvTypePrefix = "# type:"
+
+// System variable as written in import and export files.
+type Variable struct {
+	Key         string `json:"key" yaml:"key"`
+	Value       string `json:"value" yaml:"value"`
+	Type        string `json:"type" yaml:"type"`
+	ReadPolicy  Policy `json:"read_policy,omitempty" yaml:"read_policy,omitempty"`
+	WritePolicy Policy `json:"write_policy,omitempty" yaml:"write_policy,omitempty"`
+}
+
+// Parse format name, yml and dotenv are accepted as aliases.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "json":
+		return JSONFormat, nil
+	case "yaml", "yml":
+		return YAMLFormat, nil
+	case "env", "dotenv":
+		return DotenvFormat, nil
+	}
+
+	return "", fmt.Errorf("unsupported format %q, expects json, yaml or env", name)
+}
+
+// Check import mode is known.
+func (mode ImportMode) Valid() bool {
+	return mode == CreateOnlyMode || mode == UpsertMode || mode == ReplaceMode
+}
+
+// Encode variables in format. Dotenv files carry types in comments and
+// no policies.
+func Encode(format Format, variables []*Variable) ([]byte, error) {
+	switch format {
+	case JSONFormat:
+		return json.MarshalIndent(variables, "", "  ")
+	case YAMLFormat:
+		return yaml.Marshal(variables)
+	case DotenvFormat:
+		var buffer bytes.Buffer
+		for _, variable := range variables {
+			fmt.Fprintf(&buffer, "%s %s\n%s=%s\n", dotenvTypePrefix, variable.Type, variable.Key, quoteDotenv(variable.Value))
+		}
+		return buffer.Bytes(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// Decode variables in format, keys must be set and unique.
+func Decode(format Format, data []byte) ([]*Variable, error) {
+	var (
+		variables []*Variable
+		err       error
+	)
+
+	switch format {
+	case JSONFormat:
+		err = json.Unmarshal(data, &variables)
+	case YAMLFormat:
+		err = yaml.Unmarshal(data, &variables)
+	case DotenvFormat:
+		variables, err = decodeDotenv(data)
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for i, variable := range variables {
+		if variable == nil || variable.Key == "" {
+			return nil, fmt.Errorf("variable %d has no key", i+1)
+		}
+
+		if seen[variable.Key] {
+			return nil, fmt.Errorf("key %s is given twice", variable.Key)
+		}
+		seen[variable.Key] = true
+	}
+
+	return variables, nil
+}
+
+// Change an import makes, or would make on a dry run, to one variable.
+type ImportChange struct {
+	Key      string `json:"key"`
+	Action   string `json:"action"`
+	OldValue string `json:"old_value,omitempty"`
+	NewValue string `json:"new_value,omitempty"`
+	OldType  string `json:"old_type,omitempty"`
+	NewType  string `json:"new_type,omitempty"`
+	entity   *SystemEntity
+}
+
+// Changes of an import, ordered by key.
+type ImportReport struct {
+	DryRun  bool            `json:"dry_run"`
+	Changes []*ImportChange `json:"changes"`
+}
+
+// Count changes of report with action.
+func (report *ImportReport) Count(action string) int {
+	count := 0
+	for _, change := range report.Changes {
+		if change.Action == action {
+			count++
+		}
+	}
+
+	return count
+}
+
+// PRIVATE:
+
+// Plan changes turning stored variables into imported ones with mode.
+// Imported variables must be valid already.
+func plan(mode ImportMode, stored []*SystemEntity, imported []*Variable) []*ImportChange {
+	current := map[string]*SystemEntity{}
+	for _, entity := range stored {
+		current[entity.Key] = entity
+	}
+
+	var changes []*ImportChange
+	for _, variable := range imported {
+		entity := &SystemEntity{
+			Key:         variable.Key,
+			Value:       variable.Value,
+			Type:        variable.Type,
+			ReadPolicy:  variable.ReadPolicy,
+			WritePolicy: variable.WritePolicy,
+		}
+		change := &ImportChange{Key: variable.Key, NewValue: variable.Value, NewType: variable.Type, entity: entity}
+
+		old, exists := current[variable.Key]
+		delete(current, variable.Key)
+
+		switch {
+		case !exists:
+			change.Action = CreateAction
+		case mode == CreateOnlyMode:
+			change.Action = SkipAction
+		case old.Value == variable.Value && old.Type == variable.Type && !policiesChanged(old, variable):
+			change.Action = UnchangedAction
+		default:
+			change.Action = UpdateAction
+		}
+
+		if exists {
+			change.OldValue, change.OldType = old.Value, old.Type
+			entity.ID = old.ID
+			if entity.ReadPolicy == "" {
+				entity.ReadPolicy = old.ReadPolicy
+			}
+			if entity.WritePolicy == "" {
+				entity.WritePolicy = old.WritePolicy
+			}
+		}
+
+		changes = append(changes, change)
+	}
+
+	if mode == ReplaceMode {
+		for _, old := range current {
+			changes = append(changes, &ImportChange{
+				Key:      old.Key,
+				Action:   DeleteAction,
+				OldValue: old.Value,
+				OldType:  old.Type,
+				entity:   old,
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// Check imported variable sets policies other than the stored ones,
+// empty imported policies keep the stored ones.
+func policiesChanged(old *SystemEntity, variable *Variable) bool {
+	return (variable.ReadPolicy != "" && variable.ReadPolicy != old.ReadPolicy) ||
+		(variable.WritePolicy != "" && variable.WritePolicy != old.WritePolicy)
+}
+
+// Quote dotenv value when it holds spaces, quotes, comments or line breaks.
+func quoteDotenv(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\r\n\"'#\\=") {
+		return strconv.Quote(value)
+	}
+
+	return value
+}
+
+// Decode KEY=value lines, each optionally preceded by a "# type: <type>"
+// comment, values without type are strings.
+func decodeDotenv(data []byte) ([]*Variable, error) {
+	var (
+		variables []*Variable
+		valueType string
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if spec, ok := strings.CutPrefix(line, dotenvTypePrefix); ok {
+			valueType = strings.TrimSpace(spec)
+			continue
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, raw, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d expects KEY=value", number)
+		}
+
+		value, err := unquoteDotenv(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d %w", number, err)
+		}
+
+		if valueType == "" {
+			valueType = string(StringType)
+		}
+
+		variables = append(variables, &Variable{Key: strings.TrimSpace(key), Value: value, Type: valueType})
+		valueType = ""
+	}
+
+	return variables, scanner.Err()
+}
+
+// Unquote dotenv value, stripping comments after unquoted values.
+func unquoteDotenv(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("has a malformed quoted value")
+		}
+		return value, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("has an unterminated quoted value")
+		}
+		return raw[1 : len(raw)-1], nil
+	}
+
+	if value, _, ok := strings.Cut(raw, " #"); ok {
+		return strings.TrimSpace(value), nil
+	}
+
+	return raw, nil
+}
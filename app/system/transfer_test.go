@@ -0,0 +1,101 @@
+package system
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Test Encode and Decode.
+func TestTransferFormats(t *testing.T) {
+	variables := []*Variable{
+		{Key: "rate", Value: "1", Type: "int", ReadPolicy: "*"},
+		{Key: "banner", Value: "Hello, \"world\" # 1", Type: "string"},
+		{Key: "empty", Value: "", Type: "string"},
+	}
+
+	for _, format := range []Format{JSONFormat, YAMLFormat, DotenvFormat} {
+		t.Run("Should decode encoded "+string(format)+" variables", func(t *testing.T) {
+			data, err := Encode(format, variables)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := Decode(format, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := variables
+			if format == DotenvFormat {
+				expected = []*Variable{
+					{Key: "rate", Value: "1", Type: "int"},
+					{Key: "banner", Value: "Hello, \"world\" # 1", Type: "string"},
+					{Key: "empty", Value: "", Type: "string"},
+				}
+			}
+
+			if !reflect.DeepEqual(result, expected) {
+				t.Fatalf("Decode() returns %+v, expects %+v", result, expected)
+			}
+		})
+	}
+
+	t.Run("Should decode hand written dotenv files", func(t *testing.T) {
+		data := []byte("# promo settings\nexport RATE=1 # percent\n\n# type: boolean\nPROMO='on sale'\n")
+
+		result, err := Decode(DotenvFormat, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []*Variable{
+			{Key: "RATE", Value: "1", Type: "string"},
+			{Key: "PROMO", Value: "on sale", Type: "boolean"},
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("Decode() returns %+v, expects %+v", result, expected)
+		}
+	})
+
+	t.Run("Should decode yaml scalars as values", func(t *testing.T) {
+		result, err := Decode(YAMLFormat, []byte("- key: rate\n  value: 10\n  type: int\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result[0].Value != "10" {
+			t.Fatalf("Decode() returns value %s, expects 10", result[0].Value)
+		}
+	})
+
+	t.Run("Should reject duplicated and missing keys", func(t *testing.T) {
+		cases := []string{
+			`[{"key": "rate"}, {"key": "rate"}]`,
+			`[{"value": "1"}]`,
+		}
+
+		for _, data := range cases {
+			if _, err := Decode(JSONFormat, []byte(data)); err == nil {
+				t.Fatalf("Decode() expects error on %s", data)
+			}
+		}
+	})
+
+	t.Run("Should reject malformed dotenv lines", func(t *testing.T) {
+		if _, err := Decode(DotenvFormat, []byte("RATE\n")); err == nil {
+			t.Fatal("Decode() expects error")
+		}
+	})
+
+	t.Run("Should parse format aliases", func(t *testing.T) {
+		for name, expected := range map[string]Format{"yml": YAMLFormat, ".env": DotenvFormat, "JSON": JSONFormat} {
+			if format, err := ParseFormat(name); err != nil || format != expected {
+				t.Fatalf("ParseFormat(%s) returns %s, expects %s", name, format, expected)
+			}
+		}
+
+		if _, err := ParseFormat("xml"); err == nil {
+			t.Fatal("ParseFormat() expects error")
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package system
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ValueType string
+
+// Supported base types of system variables.
+const (
+	StringType   ValueType = "string"
+	IntType      ValueType = "int"
+	FloatType    ValueType = "float"
+	BooleanType  ValueType = "boolean"
+	DurationType ValueType = "duration"
+	JSONType     ValueType = "json"
+	EnumType     ValueType = "enum"
+	ListType     ValueType = "list"
+	FlagType     ValueType = "flag"
+	SecretType   ValueType = "secret"
+)
+
+// Parsed type of a system variable, written as "<base>",
+// "enum:<value>,<value>..." or "list:<element type>".
+// List values are JSON arrays of their element type, flag values
+// JSON rules (see Flag) and secret values any text, encrypted at rest.
+type TypeSpec struct {
+	Base    ValueType
+	Values  []string
+	Element *TypeSpec
+}
+
+// Parse type spec, an empty spec is a string.
+func ParseType(spec string) (*TypeSpec, error) {
+	base, argument, _ := strings.Cut(strings.TrimSpace(spec), ":")
+
+	switch ValueType(strings.ToLower(base)) {
+	case "", StringType:
+		return &TypeSpec{Base: StringType}, nil
+	case IntType, FloatType, BooleanType, DurationType, JSONType, FlagType, SecretType:
+		if argument != "" {
+			return nil, fmt.Errorf("type %s takes no argument", base)
+		}
+		return &TypeSpec{Base: ValueType(strings.ToLower(base))}, nil
+	case EnumType:
+		var values []string
+		for _, value := range strings.Split(argument, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+
+		if len(values) == 0 {
+			return nil, errors.New("enum expects its values, like enum:red,green")
+		}
+		return &TypeSpec{Base: EnumType, Values: values}, nil
+	case ListType:
+		element, err := ParseType(argument)
+		if err != nil {
+			return nil, err
+		}
+
+		if element.Base == ListType {
+			return nil, errors.New("lists can't be nested")
+		}
+		return &TypeSpec{Base: ListType, Element: element}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %q", base)
+}
+
+// Check base type is supported.
+func (t ValueType) Valid() bool {
+	switch t {
+	case StringType, IntType, FloatType, BooleanType, DurationType, JSONType, EnumType, ListType, FlagType, SecretType:
+		return true
+	}
+
+	return false
+}
+
+// Format type spec.
+func (t *TypeSpec) String() string {
+	switch t.Base {
+	case EnumType:
+		return string(EnumType) + ":" + strings.Join(t.Values, ",")
+	case ListType:
+		return string(ListType) + ":" + t.Element.String()
+	}
+
+	return string(t.Base)
+}
+
+// Check value matches type.
+func (t *TypeSpec) Validate(value string) error {
+	switch t.Base {
+	case IntType:
+		_, err := strconv.Atoi(value)
+		return typeError(err, "expects an integer")
+	case FloatType:
+		_, err := strconv.ParseFloat(value, 64)
+		return typeError(err, "expects a number")
+	case BooleanType:
+		_, err := strconv.ParseBool(value)
+		return typeError(err, "expects true or false")
+	case DurationType:
+		_, err := time.ParseDuration(value)
+		return typeError(err, "expects a duration like 1h30m")
+	case JSONType:
+		if !json.Valid([]byte(value)) {
+			return errors.New("expects a JSON document")
+		}
+	case FlagType:
+		_, err := ParseFlag(value)
+		return err
+	case EnumType:
+		for _, allowed := range t.Values {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("expects one of %s", strings.Join(t.Values, ", "))
+	case ListType:
+		var elements []json.RawMessage
+		if err := json.Unmarshal([]byte(value), &elements); err != nil {
+			return fmt.Errorf("expects a JSON array of %s", t.Element)
+		}
+
+		for i, element := range elements {
+			if err := t.Element.validateElement(element); err != nil {
+				return fmt.Errorf("element %d %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// PRIVATE:
+
+// Check JSON array element matches type, scalar types are JSON
+// numbers or booleans, the others JSON strings.
+func (t *TypeSpec) validateElement(element json.RawMessage) error {
+	switch t.Base {
+	case JSONType:
+		return nil
+	case IntType, FloatType, BooleanType:
+		if bytes.HasPrefix(element, []byte(`"`)) {
+			return fmt.Errorf("expects a JSON %s", t.Base)
+		}
+		return t.Validate(string(element))
+	}
+
+	var text string
+	if err := json.Unmarshal(element, &text); err != nil {
+		return errors.New("expects a JSON string")
+	}
+
+	return t.Validate(text)
+}
+
+// Describe validation error, nil when err is nil.
+func typeError(err error, description string) error {
+	if err != nil {
+		return errors.New(description)
+	}
+
+	return nil
+}
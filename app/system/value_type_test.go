@@ -0,0 +1,71 @@
+package system
+
+import "testing"
+
+// Test ParseType and Validate.
+func TestValueType(t *testing.T) {
+	t.Run("Should parse supported types", func(t *testing.T) {
+		cases := map[string]string{
+			"":                  "string",
+			"Int":               "int",
+			"duration":          "duration",
+			"enum: red, green ": "enum:red,green",
+			"list:int":          "list:int",
+			"list:enum:a,b":     "list:enum:a,b",
+		}
+
+		for spec, expected := range cases {
+			result, err := ParseType(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.String() != expected {
+				t.Fatalf("ParseType(%q) is %s, expects %s", spec, result, expected)
+			}
+		}
+	})
+
+	t.Run("Should not parse unsupported types", func(t *testing.T) {
+		for _, spec := range []string{"integer", "enum", "enum:", "list:list:int", "int:8"} {
+			if _, err := ParseType(spec); err == nil {
+				t.Fatalf("ParseType(%q) expects error", spec)
+			}
+		}
+	})
+
+	t.Run("Should validate values against their type", func(t *testing.T) {
+		cases := []struct {
+			spec  string
+			value string
+			valid bool
+		}{
+			{"string", "hello", true},
+			{"int", "42", true},
+			{"int", "hello", false},
+			{"float", "4.2", true},
+			{"float", "4,2", false},
+			{"boolean", "true", true},
+			{"boolean", "yes", false},
+			{"duration", "1h30m", true},
+			{"duration", "90", false},
+			{"json", `{"a": [1, 2]}`, true},
+			{"json", `{"a": `, false},
+			{"enum:red,green", "green", true},
+			{"enum:red,green", "blue", false},
+			{"list:int", "[1, 2, 3]", true},
+			{"list:int", `[1, "2"]`, false},
+			{"list:string", `["a", "b"]`, true},
+			{"list:string", "a,b", false},
+			{"list:duration", `["1m", "2h"]`, true},
+			{"list:enum:a,b", `["a", "c"]`, false},
+		}
+
+		for _, c := range cases {
+			spec, _ := ParseType(c.spec)
+			if err := spec.Validate(c.value); (err == nil) != c.valid {
+				t.Fatalf("%s.Validate(%q) valid is %t, expects %t: %v", c.spec, c.value, err == nil, c.valid, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package system
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"msim/app/user"
+)
+
+// Pending events kept per watcher, a watcher falling further behind misses events.
+const watchBuffer = 64
+
+// Change of a system variable delivered to watchers once committed.
+type Event struct {
+	Key    string    `json:"key"`
+	Action string    `json:"action"`
+	Value  string    `json:"value"`
+	Type   string    `json:"type"`
+	At     time.Time `json:"at"`
+	entity *SystemEntity
+}
+
+type watcher struct {
+	actor  *user.UserEntity
+	keys   map[string]bool
+	events chan *Event
+}
+
+// Fan out of committed changes to watchers of this process.
+// The zero value is ready to use.
+type Broker struct {
+	mutex    sync.Mutex
+	watchers map[*watcher]bool
+}
+
+// Subscribe to changes of keys, every key when none, readable by actor.
+// The channel is closed once ctx is done.
+func (broker *Broker) Subscribe(ctx context.Context, actor *user.UserEntity, keys ...string) <-chan *Event {
+	w := &watcher{actor: actor, keys: map[string]bool{}, events: make(chan *Event, watchBuffer)}
+	for _, key := range keys {
+		w.keys[key] = true
+	}
+
+	broker.mutex.Lock()
+	if broker.watchers == nil {
+		broker.watchers = map[*watcher]bool{}
+	}
+	broker.watchers[w] = true
+	broker.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		broker.mutex.Lock()
+		delete(broker.watchers, w)
+		close(w.events)
+		broker.mutex.Unlock()
+	}()
+
+	return w.events
+}
+
+// Deliver change of entity to its watchers without blocking.
+func (broker *Broker) Publish(action string, entity *SystemEntity) {
+	event := &Event{
+		Key:    entity.Key,
+		Action: action,
+		Value:  entity.Value,
+		Type:   entity.Type,
+		At:     time.Now(),
+		entity: entity,
+	}
+
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	for w := range broker.watchers {
+		if len(w.keys) > 0 && !w.keys[event.Key] {
+			continue
+		}
+
+		if !entity.Readable(w.actor) {
+			continue
+		}
+
+		select {
+		case w.events <- event:
+		default:
+		}
+	}
+}
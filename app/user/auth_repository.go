@@ -1,57 +1,237 @@
 package user
 
 import (
-	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"msim/app/shared"
+	"msim/db"
+)
+
+// Kinds of authentication codes.
+const (
+	AccessKind  = "access"
+	RefreshKind = "refresh"
 )
 
 type Auth struct {
 	gorm.Model
-	ID     uuid.UUID `gorm:"type:uuid;primaryKey"`
-	Code   uuid.UUID
-	UserID uuid.UUID
-	User   User
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Code       uuid.UUID
+	UserID     uuid.UUID
+	User       User
+	LastUsedAt *time.Time
+	Kind       string `gorm:"default:access"`
+	FamilyID   *uuid.UUID
+	UsedAt     *time.Time
+}
+
+// Lifetimes used when none is configured.
+const (
+	DefaultTokenLifetime   = 20 * time.Minute
+	DefaultRefreshLifetime = 30 * 24 * time.Hour
+)
+
+type AuthOptions struct {
+	// Lifetime of access codes, counted from their last use when
+	// Sliding, from their creation otherwise.
+	Lifetime time.Duration
+	Sliding  bool
+	// Lifetime of refresh tokens, counted from their creation.
+	RefreshLifetime time.Duration
 }
 
 type AuthRepository struct {
-	db *gorm.DB
+	db      *gorm.DB
+	options AuthOptions
+}
+
+// Refresh token with the user and token family it was issued to.
+type RefreshGrant struct {
+	UserID       uuid.UUID
+	FamilyID     uuid.UUID
+	RefreshToken uuid.UUID
 }
 
 // Create an AuthRepository instance.
-func (repository *AuthRepository) New(database *gorm.DB) *AuthRepository {
-	return &AuthRepository{db: database}
+func (repository *AuthRepository) New(database *gorm.DB, options AuthOptions) *AuthRepository {
+	return &AuthRepository{db: database, options: options}
 }
 
 // Create authentication token.
 func (repository *AuthRepository) Create(userId uuid.UUID) (uuid.UUID, error) {
 	code := uuid.New()
-	result := repository.db.Create(&Auth{ID: uuid.New(), Code: code, UserID: userId})
+	result := repository.db.Create(&Auth{ID: uuid.New(), Code: code, UserID: userId, Kind: AccessKind})
 
 	return code, result.Error
 }
 
+// Create an access code of token family.
+func (repository *AuthRepository) CreateAccess(userId uuid.UUID, familyId uuid.UUID) (uuid.UUID, error) {
+	code := uuid.New()
+	auth := &Auth{ID: uuid.New(), Code: code, UserID: userId, Kind: AccessKind, FamilyID: &familyId}
+
+	return code, repository.db.Create(auth).Error
+}
+
+// Create a refresh token starting a new token family.
+func (repository *AuthRepository) CreateRefresh(userId uuid.UUID) (*RefreshGrant, error) {
+	return createRefresh(repository.db, userId, uuid.New())
+}
+
+// Exchange an active refresh token for a new one of the same family.
+// A refresh token used twice revokes its whole family and returns
+// ErrTokenReused with the grant of the revoked family.
+func (repository *AuthRepository) Rotate(refreshToken uuid.UUID) (*RefreshGrant, error) {
+	var grant *RefreshGrant
+	reused := false
+
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		var auth Auth
+		result := tx.Where("code = ? AND kind = ?", refreshToken, RefreshKind).First(&auth)
+		if result.Error != nil {
+			return db.TranslateError(result.Error, "refresh_token")
+		}
+
+		if auth.UsedAt == nil && auth.CreatedAt.Before(time.Now().Add(-repository.refreshLifetime())) {
+			return shared.FormException(shared.UNAUTHORIZED_EX, "refresh_token")
+		}
+
+		// Only the first of concurrent exchanges marks the token used,
+		// the others are reuses.
+		result = tx.Model(&Auth{}).Where("id = ? AND used_at IS NULL", auth.ID).Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			reused = true
+			grant = &RefreshGrant{UserID: auth.UserID, FamilyID: *auth.FamilyID}
+			return tx.Where("family_id = ?", auth.FamilyID).Delete(&Auth{}).Error
+		}
+
+		var err error
+		grant, err = createRefresh(tx, auth.UserID, *auth.FamilyID)
+		return err
+	})
+
+	if reused && err == nil {
+		return grant, ErrTokenReused
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return grant, nil
+}
+
 // Check if authenticate code is active,
 // if is active return userId, otherwise returns an error.
 func (repository *AuthRepository) GetAuthUser(code uuid.UUID) (*UserEntity, error) {
 	var models []User
 
-	inTime := time.Now().Add(-20 * time.Minute)
-	result := repository.db.Raw(`
-		SELECT user.* FROM users as user 
-		LEFT JOIN auths as auth
-			ON user.id = auth.user_id
-		WHERE auth.code = ? AND auth.created_at >= ?
-		ORDER BY auth.created_at DESC
-		LIMIT 1
-	`, code, inTime).Find(&models)
+	now := time.Now()
+	result := repository.db.
+		Joins("JOIN auths ON auths.user_id = users.id AND auths.deleted_at IS NULL").
+		Where("auths.code = ? AND auths.kind = ?", code, AccessKind).
+		Where("COALESCE(auths.last_used_at, auths.created_at) >= ?", repository.cutoff(now)).
+		Order("auths.created_at DESC").
+		Limit(1).
+		Find(&models)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if len(models) == 0 {
+		return nil, shared.FormException(shared.NOT_FOUND_EX, "auth")
+	}
 
-	if len(models) == 0 || result.Error != nil {
-		return nil, errors.New("Record not found")
+	if repository.options.Sliding {
+		err := repository.db.Model(&Auth{}).Where("code = ?", code).Update("last_used_at", now).Error
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	model := models[0]
-	return &UserEntity{ID: model.ID, Name: model.Name}, nil
+	return &UserEntity{ID: model.ID, Name: model.Name, Role: Role(model.Role)}, nil
+}
+
+// Revoke authentication code, with every code of its family if it has one.
+func (repository *AuthRepository) Revoke(code uuid.UUID) error {
+	var auth Auth
+	if err := repository.db.Where("code = ?", code).First(&auth).Error; err != nil {
+		return db.TranslateError(err, "auth")
+	}
+
+	query := repository.db.Where("code = ?", code)
+	if auth.FamilyID != nil {
+		query = repository.db.Where("family_id = ?", auth.FamilyID)
+	}
+
+	return query.Delete(&Auth{}).Error
+}
+
+// Revoke every authentication code of token family.
+func (repository *AuthRepository) RevokeFamily(familyId uuid.UUID) error {
+	return repository.db.Where("family_id = ?", familyId).Delete(&Auth{}).Error
+}
+
+// Revoke every authentication code of user, return how many were revoked.
+func (repository *AuthRepository) RevokeAll(userId uuid.UUID) (int64, error) {
+	result := repository.db.Where("user_id = ?", userId).Delete(&Auth{})
+	return result.RowsAffected, result.Error
+}
+
+// Delete expired and revoked authentication codes, return how many were deleted.
+// Used refresh tokens are kept until they expire to detect their reuse.
+func (repository *AuthRepository) DeleteExpired() (int64, error) {
+	now := time.Now()
+	result := repository.db.Unscoped().
+		Where("deleted_at IS NOT NULL").
+		Or("kind = ? AND COALESCE(last_used_at, created_at) < ?", AccessKind, repository.cutoff(now)).
+		Or("kind = ? AND created_at < ?", RefreshKind, now.Add(-repository.refreshLifetime())).
+		Delete(&Auth{})
+
+	return result.RowsAffected, result.Error
+}
+
+// PRIVATE:
+
+// Get oldest creation or last use time of an active code.
+func (repository *AuthRepository) cutoff(now time.Time) time.Time {
+	return now.Add(-repository.tokenLifetime())
+}
+
+// Get configured token lifetime or the default one.
+func (repository *AuthRepository) tokenLifetime() time.Duration {
+	if repository.options.Lifetime <= 0 {
+		return DefaultTokenLifetime
+	}
+
+	return repository.options.Lifetime
+}
+
+// Get configured refresh token lifetime or the default one.
+func (repository *AuthRepository) refreshLifetime() time.Duration {
+	if repository.options.RefreshLifetime <= 0 {
+		return DefaultRefreshLifetime
+	}
+
+	return repository.options.RefreshLifetime
+}
+
+// Create a refresh token of family.
+func createRefresh(tx *gorm.DB, userId uuid.UUID, familyId uuid.UUID) (*RefreshGrant, error) {
+	grant := &RefreshGrant{UserID: userId, FamilyID: familyId, RefreshToken: uuid.New()}
+	auth := &Auth{ID: uuid.New(), Code: grant.RefreshToken, UserID: userId, Kind: RefreshKind, FamilyID: &familyId}
+
+	if err := tx.Create(auth).Error; err != nil {
+		return nil, err
+	}
+
+	return grant, nil
 }
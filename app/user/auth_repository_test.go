@@ -1,19 +1,21 @@
 package user
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"msim/app/shared"
 	"msim/db"
 )
 
 // Test create.
 func TestCreateAuth(t *testing.T) {
 	t.Run("Should create an auth and return a code when theres an user", func(t *testing.T) {
-		repository, DB := CreateAuthRepository()
+		repository, DB := CreateAuthRepository(t)
 
 		created := &User{Name: "test1", Password: "12345"}
 		DB.Create(&created)
@@ -33,11 +35,11 @@ func TestCreateAuth(t *testing.T) {
 	})
 
 	t.Run("Should not create an auth when theres no user", func(t *testing.T) {
-		repository, _ := CreateAuthRepository()
+		repository, _ := CreateAuthRepository(t)
 
 		_, err := repository.Create(uuid.Nil)
 
-		if err != nil {
+		if err == nil {
 			t.Fatal("Should return an error")
 		}
 	})
@@ -46,7 +48,7 @@ func TestCreateAuth(t *testing.T) {
 // Test getAuthUser.
 func TestGetAuthUser(t *testing.T) {
 	t.Run("Should get auth user when theres an user", func(t *testing.T) {
-		repository, DB := CreateAuthRepository()
+		repository, DB := CreateAuthRepository(t)
 
 		createdUser := User{Name: "test1a", Password: "12345"}
 		DB.Create(&createdUser)
@@ -74,7 +76,7 @@ func TestGetAuthUser(t *testing.T) {
 	})
 
 	t.Run("Should not get auth user when theres no auth code or user", func(t *testing.T) {
-		repository, _ := CreateAuthRepository()
+		repository, _ := CreateAuthRepository(t)
 
 		result, err := repository.GetAuthUser(uuid.New())
 
@@ -88,7 +90,7 @@ func TestGetAuthUser(t *testing.T) {
 	})
 
 	t.Run("Should not get auth user when auth code is expired", func(t *testing.T) {
-		repository, DB := CreateAuthRepository()
+		repository, DB := CreateAuthRepository(t)
 
 		createdUser := User{Name: "test1", Password: "12345"}
 		DB.Create(&createdUser)
@@ -109,11 +111,292 @@ func TestGetAuthUser(t *testing.T) {
 			t.Fatal("Should not find am user")
 		}
 	})
+
+	t.Run("Should expire auth code after the configured lifetime", func(t *testing.T) {
+		repository, DB := CreateAuthRepository(t)
+		repository.options.Lifetime = time.Minute
+
+		createdUser := User{Name: "test1", Password: "12345"}
+		DB.Create(&createdUser)
+
+		createdAuth := Auth{ID: uuid.New(), Code: uuid.New(), User: createdUser}
+		createdAuth.CreatedAt = time.Now().Add(-2 * time.Minute)
+
+		DB.Create(&createdAuth)
+
+		result, err := repository.GetAuthUser(createdAuth.Code)
+
+		if err == nil {
+			t.Fatal("Should throw error")
+		}
+
+		if result != nil {
+			t.Fatal("Should not find am user")
+		}
+	})
+}
+
+// Test sliding expiration.
+func TestSlidingExpiration(t *testing.T) {
+	t.Run("Should extend auth code lifetime on use when sliding", func(t *testing.T) {
+		repository, DB := CreateAuthRepository(t)
+		repository.options.Lifetime = time.Minute
+		repository.options.Sliding = true
+
+		createdUser := User{ID: uuid.New(), Name: "test1", Password: "12345"}
+		DB.Create(&createdUser)
+
+		lastUsed := time.Now().Add(-30 * time.Second)
+		createdAuth := Auth{ID: uuid.New(), Code: uuid.New(), User: createdUser, LastUsedAt: &lastUsed}
+		createdAuth.CreatedAt = time.Now().Add(-2 * time.Minute)
+		DB.Create(&createdAuth)
+
+		if _, err := repository.GetAuthUser(createdAuth.Code); err != nil {
+			t.Fatal(err)
+		}
+
+		var find Auth
+		DB.Where("code = ?", createdAuth.Code).First(&find)
+
+		if find.LastUsedAt == nil || !find.LastUsedAt.After(lastUsed) {
+			t.Fatal("Should update last use of auth code")
+		}
+	})
+
+	t.Run("Should not extend auth code lifetime when not sliding", func(t *testing.T) {
+		repository, DB := CreateAuthRepository(t)
+		repository.options.Lifetime = time.Minute
+
+		createdUser := User{ID: uuid.New(), Name: "test1", Password: "12345"}
+		DB.Create(&createdUser)
+
+		lastUsed := time.Now().Add(-30 * time.Second).Truncate(time.Second)
+		createdAuth := Auth{ID: uuid.New(), Code: uuid.New(), User: createdUser, LastUsedAt: &lastUsed}
+		createdAuth.CreatedAt = time.Now().Add(-2 * time.Minute)
+		DB.Create(&createdAuth)
+
+		if _, err := repository.GetAuthUser(createdAuth.Code); err != nil {
+			t.Fatal(err)
+		}
+
+		var find Auth
+		DB.Where("code = ?", createdAuth.Code).First(&find)
+
+		if !find.LastUsedAt.Equal(lastUsed) {
+			t.Fatal("Should not update last use of auth code")
+		}
+	})
+}
+
+// Test createRefresh, createAccess and rotate.
+func TestRotate(t *testing.T) {
+	t.Run("Should create an access code in the refresh token family", func(t *testing.T) {
+		repository, DB := CreateAuthRepository(t)
+
+		createdUser := User{ID: uuid.New(), Name: "test1", Password: "12345"}
+		DB.Create(&createdUser)
+
+		pair, err := repository.CreateRefresh(createdUser.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := repository.CreateAccess(createdUser.ID, pair.FamilyID); err != nil {
+			t.Fatal(err)
+		}
+
+		var auths []Auth
+		DB.Order("kind").Find(&auths)
+
+		if len(auths) != 2 || auths[0].Kind != AccessKind || auths[1].Kind != RefreshKind {
+			t.Fatal("Should create an access code and a refresh token")
+		}
+
+		if *auths[0].FamilyID != *auths[1].FamilyID || auths[1].Code != pair.RefreshToken {
+			t.Fatal("Should create both tokens in the same family")
+		}
+	})
+
+	t.Run("Should mark the rotated refresh token as used", func(t *testing.T) {
+		repository, DB := CreateAuthRepository(t)
+
+		createdUser := User{ID: uuid.New(), Name: "test1", Password: "12345"}
+		DB.Create(&createdUser)
+
+		pair, _ := repository.CreateRefresh(createdUser.ID)
+		if _, err := repository.Rotate(pair.RefreshToken); err != nil {
+			t.Fatal(err)
+		}
+
+		var find Auth
+		DB.Where("code = ?", pair.RefreshToken).First(&find)
+
+		if find.UsedAt == nil {
+			t.Fatal("Should mark refresh token as used")
+		}
+	})
+
+	t.Run("Should detect a reuse racing the exchange", func(t *testing.T) {
+		repository, DB := CreateAuthRepository(t)
+
+		createdUser := User{ID: uuid.New(), Name: "test1", Password: "12345"}
+		DB.Create(&createdUser)
+		pair, _ := repository.CreateRefresh(createdUser.ID)
+
+		// Another exchange marks the token used after this one read it.
+		raced := false
+		DB.Callback().Update().Before("gorm:update").Register("test:race", func(tx *gorm.DB) {
+			if !raced {
+				raced = true
+				tx.Session(&gorm.Session{NewDB: true}).Exec("UPDATE auths SET used_at = ? WHERE code = ?", time.Now(), pair.RefreshToken)
+			}
+		})
+
+		if _, err := repository.Rotate(pair.RefreshToken); !errors.Is(err, ErrTokenReused) {
+			t.Fatalf("Expected the token reused, got %v", err)
+		}
+
+		var count int64
+		DB.Model(&Auth{}).Where("user_id = ?", createdUser.ID).Count(&count)
+		if count != 0 {
+			t.Fatalf("Should revoke the family, %d codes left", count)
+		}
+	})
+
+	t.Run("Should not rotate an expired refresh token", func(t *testing.T) {
+		repository, DB := CreateAuthRepository(t)
+		repository.options.RefreshLifetime = time.Hour
+
+		createdUser := User{ID: uuid.New(), Name: "test1", Password: "12345"}
+		DB.Create(&createdUser)
+
+		pair, _ := repository.CreateRefresh(createdUser.ID)
+		DB.Model(&Auth{}).Where("code = ?", pair.RefreshToken).Update("created_at", time.Now().Add(-2*time.Hour))
+
+		if _, err := repository.Rotate(pair.RefreshToken); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+	})
+
+	t.Run("Should keep used refresh tokens until they expire", func(t *testing.T) {
+		repository, DB := CreateAuthRepository(t)
+
+		createdUser := User{ID: uuid.New(), Name: "test1", Password: "12345"}
+		DB.Create(&createdUser)
+
+		pair, _ := repository.CreateRefresh(createdUser.ID)
+		repository.Rotate(pair.RefreshToken)
+		repository.DeleteExpired()
+
+		if _, err := repository.Rotate(pair.RefreshToken); !errors.Is(err, ErrTokenReused) {
+			t.Fatal("Should still detect the reuse after sweeping")
+		}
+	})
+}
+
+// Test revoke.
+func TestRevoke(t *testing.T) {
+	t.Run("Should revoke an auth code", func(t *testing.T) {
+		repository, DB := CreateAuthRepository(t)
+
+		createdUser := User{ID: uuid.New(), Name: "test1", Password: "12345"}
+		DB.Create(&createdUser)
+
+		code, _ := repository.Create(createdUser.ID)
+
+		if err := repository.Revoke(code); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := repository.GetAuthUser(code); err == nil {
+			t.Fatal("Should not get auth user from a revoked code")
+		}
+	})
+
+	t.Run("Should not revoke an unknown auth code", func(t *testing.T) {
+		repository, _ := CreateAuthRepository(t)
+
+		if err := repository.Revoke(uuid.New()); !errors.Is(err, shared.ErrNotFound) {
+			t.Fatal("Should throw a not found exception")
+		}
+	})
+
+	t.Run("Should revoke every auth code of an user", func(t *testing.T) {
+		repository, DB := CreateAuthRepository(t)
+
+		createdUser := User{ID: uuid.New(), Name: "test1", Password: "12345"}
+		otherUser := User{ID: uuid.New(), Name: "test2", Password: "12345"}
+		DB.Create(&createdUser)
+		DB.Create(&otherUser)
+
+		first, _ := repository.Create(createdUser.ID)
+		second, _ := repository.Create(createdUser.ID)
+		other, _ := repository.Create(otherUser.ID)
+
+		count, err := repository.RevokeAll(createdUser.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count != 2 {
+			t.Fatalf("Expected 2 revoked codes, got %d", count)
+		}
+
+		for _, code := range []uuid.UUID{first, second} {
+			if _, err := repository.GetAuthUser(code); err == nil {
+				t.Fatal("Should not get auth user from a revoked code")
+			}
+		}
+
+		if _, err := repository.GetAuthUser(other); err != nil {
+			t.Fatal("Should keep codes of other users")
+		}
+	})
+}
+
+// Test deleteExpired.
+func TestDeleteExpired(t *testing.T) {
+	t.Run("Should delete expired and revoked auth codes", func(t *testing.T) {
+		repository, DB := CreateAuthRepository(t)
+		repository.options.Lifetime = time.Minute
+
+		createdUser := User{ID: uuid.New(), Name: "test1", Password: "12345"}
+		DB.Create(&createdUser)
+
+		expired := Auth{ID: uuid.New(), Code: uuid.New(), UserID: createdUser.ID}
+		expired.CreatedAt = time.Now().Add(-2 * time.Minute)
+		DB.Create(&expired)
+
+		revoked, _ := repository.Create(createdUser.ID)
+		repository.Revoke(revoked)
+
+		active, _ := repository.Create(createdUser.ID)
+
+		count, err := repository.DeleteExpired()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count != 2 {
+			t.Fatalf("Expected 2 deleted codes, got %d", count)
+		}
+
+		var remaining []Auth
+		DB.Unscoped().Find(&remaining)
+
+		if len(remaining) != 1 || remaining[0].Code != active {
+			t.Fatal("Should only keep the active code")
+		}
+	})
 }
 
 // Create repository and test database.
-func CreateAuthRepository() (*AuthRepository, *gorm.DB) {
-	DB, _ := db.InMemoryDB()
+func CreateAuthRepository(t *testing.T) (*AuthRepository, *gorm.DB) {
+	DB, cleanup, err := db.TestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
 
 	Drop(DB)
 	Migrate(DB)
@@ -0,0 +1,162 @@
+package user
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Kinds of deny-list entries.
+const (
+	denyToken  = "token"
+	denyFamily = "family"
+	denyUser   = "user"
+)
+
+type RevokedToken struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Kind      string
+	Subject   string
+	RevokedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Revoked stateless tokens, token families and users, kept in memory so
+// checks don't hit the database and persisted so they survive restarts.
+// Lookup also asks the database about entries missing in memory.
+type DenyList struct {
+	db       *gorm.DB
+	lifetime time.Duration
+	mutex    sync.RWMutex
+	entries  map[string]time.Time
+}
+
+// Create a DenyList instance, entries expire after the token lifetime.
+func (list *DenyList) New(database *gorm.DB, lifetime time.Duration) *DenyList {
+	return &DenyList{db: database, lifetime: lifetime, entries: map[string]time.Time{}}
+}
+
+// Reload active entries from database, picking up revocations of other instances.
+func (list *DenyList) Load() error {
+	var models []RevokedToken
+	if err := list.db.Where("expires_at > ?", time.Now()).Find(&models).Error; err != nil {
+		return err
+	}
+
+	entries := map[string]time.Time{}
+	for _, model := range models {
+		remember(entries, model)
+	}
+
+	list.mutex.Lock()
+	list.entries = entries
+	list.mutex.Unlock()
+
+	return nil
+}
+
+// Deny token id.
+func (list *DenyList) DenyToken(tokenId uuid.UUID) error {
+	return list.add(denyToken, tokenId.String())
+}
+
+// Deny every token of family.
+func (list *DenyList) DenyFamily(familyId uuid.UUID) error {
+	return list.add(denyFamily, familyId.String())
+}
+
+// Deny every token issued to user until now.
+func (list *DenyList) DenyUser(userId uuid.UUID) error {
+	return list.add(denyUser, userId.String())
+}
+
+// Check if the token of claims is denied by entries in memory.
+func (list *DenyList) Denied(claims *Claims) bool {
+	list.mutex.RLock()
+	defer list.mutex.RUnlock()
+
+	if _, ok := list.entries[denyKey(denyToken, claims.ID.String())]; ok {
+		return true
+	}
+
+	if _, ok := list.entries[denyKey(denyFamily, claims.FamilyID.String())]; ok {
+		return true
+	}
+
+	revokedAt, ok := list.entries[denyKey(denyUser, claims.Subject.String())]
+	return ok && !claims.issuedAt().After(revokedAt)
+}
+
+// Check if the token of claims is denied, looking it up in the database when
+// not denied in memory so revocations of other instances apply at once.
+func (list *DenyList) Lookup(claims *Claims) (bool, error) {
+	if list.Denied(claims) {
+		return true, nil
+	}
+
+	var models []RevokedToken
+	err := list.db.Where("expires_at > ?", time.Now()).
+		Where("(kind = ? AND subject = ?) OR (kind = ? AND subject = ?) OR (kind = ? AND subject = ?)",
+			denyToken, claims.ID.String(), denyFamily, claims.FamilyID.String(), denyUser, claims.Subject.String()).
+		Find(&models).Error
+	if err != nil {
+		return false, err
+	}
+
+	if len(models) == 0 {
+		return false, nil
+	}
+
+	list.mutex.Lock()
+	for _, model := range models {
+		remember(list.entries, model)
+	}
+	list.mutex.Unlock()
+
+	return list.Denied(claims), nil
+}
+
+// Delete expired entries, return how many were deleted.
+func (list *DenyList) DeleteExpired() (int64, error) {
+	result := list.db.Where("expires_at <= ?", time.Now()).Delete(&RevokedToken{})
+	return result.RowsAffected, result.Error
+}
+
+// PRIVATE:
+
+// Persist and cache entry.
+func (list *DenyList) add(kind, subject string) error {
+	now := time.Now()
+	model := &RevokedToken{
+		ID:        uuid.New(),
+		Kind:      kind,
+		Subject:   subject,
+		RevokedAt: now,
+		ExpiresAt: now.Add(list.lifetime),
+	}
+
+	if err := list.db.Create(model).Error; err != nil {
+		return err
+	}
+
+	list.mutex.Lock()
+	list.entries[denyKey(kind, subject)] = now
+	list.mutex.Unlock()
+
+	return nil
+}
+
+// Add entry of model to entries, keeping the latest revocation of a subject.
+func remember(entries map[string]time.Time, model RevokedToken) {
+	key := denyKey(model.Kind, model.Subject)
+	if revokedAt, ok := entries[key]; !ok || model.RevokedAt.After(revokedAt) {
+		entries[key] = model.RevokedAt
+	}
+}
+
+// Get cache key of entry.
+func denyKey(kind, subject string) string {
+	return kind + ":" + subject
+}
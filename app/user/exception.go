@@ -0,0 +1,23 @@
+package user
+
+import (
+	"net/http"
+
+	"msim/app/shared"
+)
+
+// Error tags of the user module.
+var (
+	TOKEN_REUSED_EX        = shared.MustRegisterTag("TOKEN_REUSED", "refresh token reused, its session was revoked", http.StatusUnauthorized)
+	PASSWORD_CHARACTERS_EX = shared.MustRegisterTag("PASSWORD_CHARACTERS", "password lacks a required character class", http.StatusUnprocessableEntity)
+	PASSWORD_NAME_EX       = shared.MustRegisterTag("PASSWORD_NAME", "password holds the user name", http.StatusUnprocessableEntity)
+	PASSWORD_COMMON_EX     = shared.MustRegisterTag("PASSWORD_COMMON", "password is common or breached", http.StatusUnprocessableEntity)
+)
+
+// Sentinel exceptions of the user module.
+var (
+	ErrTokenReused        = &shared.Exception{Tag: TOKEN_REUSED_EX}
+	ErrPasswordCharacters = &shared.Exception{Tag: PASSWORD_CHARACTERS_EX}
+	ErrPasswordName       = &shared.Exception{Tag: PASSWORD_NAME_EX}
+	ErrPasswordCommon     = &shared.Exception{Tag: PASSWORD_COMMON_EX}
+)
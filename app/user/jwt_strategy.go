@@ -0,0 +1,240 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"msim/app/shared"
+)
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Claims of access codes issued by JWTStrategy.
+type Claims struct {
+	Subject  uuid.UUID `json:"sub"`
+	Name     string    `json:"name"`
+	Role     Role      `json:"role"`
+	FamilyID uuid.UUID `json:"fid"`
+	ID       uuid.UUID `json:"jti"`
+	IssuedAt float64   `json:"iat"`
+	Expiry   int64     `json:"exp"`
+}
+
+// Signed JWT access codes, authenticated without database queries.
+// Revoked codes are checked against a DenyList, refresh tokens are
+// still stored through AuthRepository. In strict mode, with a
+// UserRepository, missed revocations and the user are read from the
+// database so changes of other instances apply at once.
+type JWTStrategy struct {
+	keys           *KeySet
+	denyList       *DenyList
+	authRepository *AuthRepository
+	userRepository *UserRepository
+	lifetime       time.Duration
+}
+
+// Create a JWTStrategy instance, codes expire after lifetime. A nil
+// userRepository keeps authentication stateless.
+func (strategy *JWTStrategy) New(keys *KeySet, denyList *DenyList, authRepository *AuthRepository, userRepository *UserRepository, lifetime time.Duration) *JWTStrategy {
+	if lifetime <= 0 {
+		lifetime = DefaultTokenLifetime
+	}
+
+	return &JWTStrategy{keys: keys, denyList: denyList, authRepository: authRepository, userRepository: userRepository, lifetime: lifetime}
+}
+
+// Issue a code signed with the signing key.
+func (strategy *JWTStrategy) Issue(user *UserEntity, familyId uuid.UUID) (string, error) {
+	now := time.Now()
+	key := strategy.keys.Signing()
+
+	header := jwtHeader{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID}
+	claims := Claims{
+		Subject:  user.ID,
+		Name:     user.Name,
+		Role:     user.Role,
+		FamilyID: familyId,
+		ID:       uuid.New(),
+		IssuedAt: float64(now.UnixMicro()) / 1e6,
+		Expiry:   now.Add(strategy.lifetime).Unix(),
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	payload := encodeSegment(headerJSON) + "." + encodeSegment(claimsJSON)
+	return payload + "." + encodeSegment(key.Sign([]byte(payload))), nil
+}
+
+// Get the user of a valid, unexpired and not revoked code.
+func (strategy *JWTStrategy) Authenticate(code string) (*UserEntity, error) {
+	claims, err := strategy.verify(code)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().Unix() >= claims.Expiry {
+		return nil, shared.FormException(shared.UNAUTHORIZED_EX, "code")
+	}
+
+	if strategy.userRepository == nil {
+		if strategy.denyList.Denied(claims) {
+			return nil, shared.FormException(shared.UNAUTHORIZED_EX, "code")
+		}
+
+		return &UserEntity{ID: claims.Subject, Name: claims.Name, Role: claims.Role}, nil
+	}
+
+	denied, err := strategy.denyList.Lookup(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if denied {
+		return nil, shared.FormException(shared.UNAUTHORIZED_EX, "code")
+	}
+
+	user, err := strategy.userRepository.GetById(claims.Subject)
+	if errors.Is(err, shared.ErrNotFound) {
+		return nil, shared.FormException(shared.UNAUTHORIZED_EX, "code").Wrap(err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Deny code and its family, revoking the stored refresh token.
+func (strategy *JWTStrategy) Revoke(code string) error {
+	claims, err := strategy.verify(code)
+	if err != nil {
+		return err
+	}
+
+	if err := strategy.denyList.DenyToken(claims.ID); err != nil {
+		return err
+	}
+
+	return strategy.RevokeFamily(claims.FamilyID)
+}
+
+// Deny every code of family, revoking the stored refresh token.
+func (strategy *JWTStrategy) RevokeFamily(familyId uuid.UUID) error {
+	if err := strategy.denyList.DenyFamily(familyId); err != nil {
+		return err
+	}
+
+	return strategy.authRepository.RevokeFamily(familyId)
+}
+
+// Deny every code issued to user until now, revoking stored refresh tokens.
+func (strategy *JWTStrategy) RevokeUser(userId uuid.UUID) error {
+	if err := strategy.denyList.DenyUser(userId); err != nil {
+		return err
+	}
+
+	_, err := strategy.authRepository.RevokeAll(userId)
+	return err
+}
+
+// Delete expired deny-list entries and reload the active ones.
+func (strategy *JWTStrategy) Sweep() error {
+	if _, err := strategy.denyList.DeleteExpired(); err != nil {
+		return err
+	}
+
+	return strategy.denyList.Load()
+}
+
+// PRIVATE:
+
+// Verify code signature and decode its claims, expiry isn't checked.
+func (strategy *JWTStrategy) verify(code string) (*Claims, error) {
+	invalid := func(err error) error {
+		return shared.FormException(shared.UNAUTHORIZED_EX, "code").Wrap(err)
+	}
+
+	segments := strings.Split(code, ".")
+	if len(segments) != 3 {
+		return nil, invalid(errors.New("malformed token"))
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(segments[0], &header); err != nil {
+		return nil, invalid(err)
+	}
+
+	key, ok := strategy.keys.Get(header.KeyID)
+	if !ok || key.Algorithm != header.Algorithm {
+		return nil, invalid(errors.New("unknown signing key"))
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return nil, invalid(err)
+	}
+
+	if !key.Verify([]byte(segments[0]+"."+segments[1]), signature) {
+		return nil, invalid(errors.New("invalid signature"))
+	}
+
+	var claims Claims
+	if err := decodeSegment(segments[1], &claims); err != nil {
+		return nil, invalid(err)
+	}
+
+	return &claims, nil
+}
+
+// Get issue time of claims.
+func (claims *Claims) issuedAt() time.Time {
+	seconds, fraction := math.Modf(claims.IssuedAt)
+	return time.Unix(int64(seconds), int64(math.Round(fraction*1e6))*1e3)
+}
+
+// Encode JWT segment.
+func encodeSegment(content []byte) string {
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+// Decode JWT segment into value.
+func decodeSegment(segment string, value any) error {
+	content, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(content, value)
+}
+
+// Get HMAC SHA-256 of payload.
+func hmacSHA256(secret, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// Compare MACs in constant time.
+func hmacEqual(expected, actual []byte) bool {
+	return hmac.Equal(expected, actual)
+}
@@ -0,0 +1,284 @@
+package user
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"msim/app/shared"
+)
+
+// Test issue and authenticate.
+func TestJWTAuthenticate(t *testing.T) {
+	for _, algorithm := range []string{HS256, EdDSA} {
+		t.Run("Should authenticate a code signed with "+algorithm, func(t *testing.T) {
+			strategy, DB := CreateJWTStrategy(t, algorithm)
+			user := CreateJWTUser(DB, "test1")
+
+			code, err := strategy.Issue(user, uuid.New())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := strategy.Authenticate(code)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.ID != user.ID || result.Name != user.Name {
+				t.Fatal("Should return the user the code was issued to")
+			}
+		})
+	}
+
+	t.Run("Should not authenticate a tampered code", func(t *testing.T) {
+		strategy, _ := CreateJWTStrategy(t, HS256)
+		code, _ := strategy.Issue(&UserEntity{ID: uuid.New(), Name: "test1"}, uuid.New())
+
+		forged, _ := strategy.Issue(&UserEntity{ID: uuid.New(), Name: "admin"}, uuid.New())
+		segments, forgedSegments := strings.Split(code, "."), strings.Split(forged, ".")
+		tampered := segments[0] + "." + forgedSegments[1] + "." + segments[2]
+
+		if _, err := strategy.Authenticate(tampered); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+	})
+
+	t.Run("Should not authenticate an expired code", func(t *testing.T) {
+		strategy, _ := CreateJWTStrategy(t, HS256)
+		strategy.lifetime = -time.Second
+
+		code, _ := strategy.Issue(&UserEntity{ID: uuid.New(), Name: "test1"}, uuid.New())
+
+		if _, err := strategy.Authenticate(code); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+	})
+
+	t.Run("Should verify codes of a rotated key", func(t *testing.T) {
+		strategy, DB := CreateJWTStrategy(t, HS256)
+		code, _ := strategy.Issue(CreateJWTUser(DB, "test1"), uuid.New())
+
+		dir := t.TempDir()
+		previous := strategy.keys.Signing()
+		if err := os.WriteFile(filepath.Join(dir, previous.ID+hs256Extension), previous.secret, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := GenerateKey(dir, "next", EdDSA); err != nil {
+			t.Fatal(err)
+		}
+
+		keys, err := LoadKeySet(dir, "next")
+		if err != nil {
+			t.Fatal(err)
+		}
+		strategy.keys = keys
+
+		if _, err := strategy.Authenticate(code); err != nil {
+			t.Fatal("Should authenticate codes signed before rotation", err)
+		}
+
+		rotated, _ := strategy.Issue(&UserEntity{ID: uuid.New(), Name: "test1"}, uuid.New())
+		var header jwtHeader
+		decodeSegment(strings.Split(rotated, ".")[0], &header)
+
+		if header.KeyID != "next" || header.Algorithm != EdDSA {
+			t.Fatal("Should sign new codes with the new key")
+		}
+	})
+
+	t.Run("Should take name and role from the claims", func(t *testing.T) {
+		strategy, DB := CreateJWTStrategy(t, HS256)
+		user := CreateJWTUser(DB, "test1")
+		code, _ := strategy.Issue(user, uuid.New())
+
+		DB.Where("id = ?", user.ID).Delete(&User{})
+		result, err := strategy.Authenticate(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Name != "test1" || result.Role != ReaderRole {
+			t.Fatalf("Expected test1 as reader, got %s as %s", result.Name, result.Role)
+		}
+	})
+
+	t.Run("Should take name and role from the user row in strict mode", func(t *testing.T) {
+		strategy, DB := CreateJWTStrategy(t, HS256)
+		strategy.userRepository = &UserRepository{db: DB}
+		user := CreateJWTUser(DB, "test1")
+		code, _ := strategy.Issue(user, uuid.New())
+
+		DB.Model(&User{}).Where("id = ?", user.ID).Updates(map[string]any{"name": "test2", "role": string(AdminRole)})
+		result, err := strategy.Authenticate(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Name != "test2" || result.Role != AdminRole {
+			t.Fatalf("Expected test2 as admin, got %s as %s", result.Name, result.Role)
+		}
+
+		DB.Where("id = ?", user.ID).Delete(&User{})
+		if _, err := strategy.Authenticate(code); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should not authenticate codes of deleted users")
+		}
+	})
+
+	t.Run("Should not load keys without the signing key", func(t *testing.T) {
+		dir := t.TempDir()
+		GenerateKey(dir, "current", HS256)
+
+		if _, err := LoadKeySet(dir, "missing"); err == nil {
+			t.Fatal("LoadKeySet() expects error")
+		}
+	})
+}
+
+// Test revoke, revokeFamily and revokeUser.
+func TestJWTRevoke(t *testing.T) {
+	t.Run("Should deny a revoked code with its family", func(t *testing.T) {
+		strategy, DB := CreateJWTStrategy(t, HS256)
+		user, familyId := CreateJWTUser(DB, "test1"), uuid.New()
+
+		code, _ := strategy.Issue(user, familyId)
+		sibling, _ := strategy.Issue(user, familyId)
+		other, _ := strategy.Issue(user, uuid.New())
+
+		if err := strategy.Revoke(code); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, revoked := range []string{code, sibling} {
+			if _, err := strategy.Authenticate(revoked); err == nil {
+				t.Fatal("Should not authenticate a revoked code")
+			}
+		}
+
+		if _, err := strategy.Authenticate(other); err != nil {
+			t.Fatal("Should authenticate codes of other families", err)
+		}
+	})
+
+	t.Run("Should deny codes issued before the user was revoked", func(t *testing.T) {
+		strategy, DB := CreateJWTStrategy(t, HS256)
+		user := CreateJWTUser(DB, "test1")
+
+		code, _ := strategy.Issue(user, uuid.New())
+		if err := strategy.RevokeUser(user.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(time.Millisecond)
+		later, _ := strategy.Issue(user, uuid.New())
+
+		if _, err := strategy.Authenticate(code); err == nil {
+			t.Fatal("Should not authenticate a code issued before revocation")
+		}
+
+		if _, err := strategy.Authenticate(later); err != nil {
+			t.Fatal("Should authenticate a code issued after revocation", err)
+		}
+	})
+
+	t.Run("Should deny codes revoked by another instance after a sweep", func(t *testing.T) {
+		strategy, DB := CreateJWTStrategy(t, HS256)
+		code, _ := strategy.Issue(CreateJWTUser(DB, "test1"), uuid.New())
+		other := *strategy
+		other.denyList = (&DenyList{}).New(DB, time.Hour)
+
+		strategy.Revoke(code)
+		if _, err := other.Authenticate(code); err != nil {
+			t.Fatal("Should check codes in memory only until a sweep", err)
+		}
+
+		if err := other.Sweep(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := other.Authenticate(code); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should not authenticate a code revoked elsewhere after a sweep")
+		}
+	})
+
+	t.Run("Should deny codes revoked by another instance in strict mode", func(t *testing.T) {
+		strategy, DB := CreateJWTStrategy(t, HS256)
+		user := CreateJWTUser(DB, "test1")
+		code, _ := strategy.Issue(user, uuid.New())
+		other := *strategy
+		other.denyList = (&DenyList{}).New(DB, time.Hour)
+		other.userRepository = &UserRepository{db: DB}
+
+		if _, err := other.Authenticate(code); err != nil {
+			t.Fatal(err)
+		}
+
+		strategy.Revoke(code)
+		if _, err := other.Authenticate(code); !errors.Is(err, shared.ErrUnauthorized) {
+			t.Fatal("Should not authenticate a code revoked elsewhere before a sweep")
+		}
+	})
+
+	t.Run("Should restore revocations from database", func(t *testing.T) {
+		strategy, DB := CreateJWTStrategy(t, HS256)
+		code, _ := strategy.Issue(CreateJWTUser(DB, "test1"), uuid.New())
+		strategy.Revoke(code)
+
+		strategy.denyList = (&DenyList{}).New(DB, time.Hour)
+		if err := strategy.denyList.Load(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := strategy.Authenticate(code); err == nil {
+			t.Fatal("Should not authenticate a revoked code after reload")
+		}
+	})
+
+	t.Run("Should sweep expired revocations", func(t *testing.T) {
+		strategy, DB := CreateJWTStrategy(t, HS256)
+		strategy.denyList.DenyFamily(uuid.New())
+		DB.Model(&RevokedToken{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute))
+
+		if err := strategy.Sweep(); err != nil {
+			t.Fatal(err)
+		}
+
+		var count int64
+		DB.Model(&RevokedToken{}).Count(&count)
+		if count != 0 {
+			t.Fatalf("Expected expired revocations to be deleted, %d left", count)
+		}
+	})
+}
+
+// Create JWT strategy signing with a new key of algorithm and test database.
+func CreateJWTStrategy(t *testing.T, algorithm string) (*JWTStrategy, *gorm.DB) {
+	repository, DB := CreateAuthRepository(t)
+
+	dir := t.TempDir()
+	if _, err := GenerateKey(dir, "current", algorithm); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadKeySet(dir, "current")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	denyList := (&DenyList{}).New(DB, time.Hour)
+	return (&JWTStrategy{}).New(keys, denyList, repository, nil, time.Hour), DB
+}
+
+// Create user of name to issue codes to.
+func CreateJWTUser(DB *gorm.DB, name string) *UserEntity {
+	model := &User{ID: uuid.New(), Name: name, Password: "12345", Role: string(ReaderRole)}
+	DB.Create(model)
+
+	return toEntity(model)
+}
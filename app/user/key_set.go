@@ -0,0 +1,181 @@
+package user
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Signing algorithms of key files, by file extension.
+const (
+	HS256 = "HS256"
+	EdDSA = "EdDSA"
+
+	hs256Extension   = ".hs256"
+	ed25519Extension = ".pem"
+)
+
+// Minimum size of HS256 secrets.
+const minSecretSize = 32
+
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	secret    []byte
+	private   ed25519.PrivateKey
+	public    ed25519.PublicKey
+}
+
+// Keys able to verify tokens by key id, one of them signs new tokens.
+type KeySet struct {
+	signing string
+	keys    map[string]*SigningKey
+}
+
+// Load every key file of dir: "<kid>.hs256" raw secrets and "<kid>.pem"
+// PKCS #8 Ed25519 private keys. New tokens are signed with signingKid,
+// keys left in dir keep verifying tokens they signed before a rotation.
+func LoadKeySet(dir, signingKid string) (*KeySet, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read keys folder: %w", err)
+	}
+
+	set := &KeySet{signing: signingKid, keys: map[string]*SigningKey{}}
+	for _, file := range files {
+		extension := filepath.Ext(file.Name())
+		if file.IsDir() || (extension != hs256Extension && extension != ed25519Extension) {
+			continue
+		}
+
+		key, err := loadKey(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		set.keys[key.ID] = key
+	}
+
+	if _, ok := set.keys[signingKid]; !ok {
+		return nil, fmt.Errorf("signing key %q not found in %s", signingKid, dir)
+	}
+
+	return set, nil
+}
+
+// Generate a key file for algorithm in dir.
+func GenerateKey(dir, kid, algorithm string) (string, error) {
+	var (
+		path    string
+		content []byte
+	)
+
+	switch algorithm {
+	case HS256:
+		path = filepath.Join(dir, kid+hs256Extension)
+		content = make([]byte, minSecretSize)
+		if _, err := rand.Read(content); err != nil {
+			return "", err
+		}
+	case EdDSA:
+		path = filepath.Join(dir, kid+ed25519Extension)
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			return "", err
+		}
+		content = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	default:
+		return "", fmt.Errorf("unsupported algorithm %q, expects %s or %s", algorithm, HS256, EdDSA)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	_, err = file.Write(content)
+	return path, err
+}
+
+// Get the key signing new tokens.
+func (set *KeySet) Signing() *SigningKey {
+	return set.keys[set.signing]
+}
+
+// Get key by id.
+func (set *KeySet) Get(kid string) (*SigningKey, bool) {
+	key, ok := set.keys[kid]
+	return key, ok
+}
+
+// Sign payload.
+func (key *SigningKey) Sign(payload []byte) []byte {
+	if key.Algorithm == EdDSA {
+		return ed25519.Sign(key.private, payload)
+	}
+
+	return hmacSHA256(key.secret, payload)
+}
+
+// Verify signature of payload.
+func (key *SigningKey) Verify(payload, signature []byte) bool {
+	if key.Algorithm == EdDSA {
+		return ed25519.Verify(key.public, payload, signature)
+	}
+
+	return hmacEqual(hmacSHA256(key.secret, payload), signature)
+}
+
+// PRIVATE:
+
+// Load key file, its name without extension is the key id.
+func loadKey(path string) (*SigningKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	extension := filepath.Ext(path)
+	key := &SigningKey{ID: strings.TrimSuffix(filepath.Base(path), extension)}
+
+	if extension == hs256Extension {
+		if len(content) < minSecretSize {
+			return nil, fmt.Errorf("key %s must have at least %d bytes", path, minSecretSize)
+		}
+
+		key.Algorithm = HS256
+		key.secret = content
+		return key, nil
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("key %s is not PEM encoded", path)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse key %s: %w", path, err)
+	}
+
+	private, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key %s is not an Ed25519 private key", path)
+	}
+
+	key.Algorithm = EdDSA
+	key.private = private
+	key.public = private.Public().(ed25519.PublicKey)
+	return key, nil
+}
@@ -1,13 +1,166 @@
 package user
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"msim/db"
+)
 
-func Migrate(db *gorm.DB) {
-	db.AutoMigrate(&User{})
-	db.AutoMigrate(&Auth{})
+// Schema migrations of the user module.
+var Migrations = []db.Migration{
+	{
+		Version: 2023090101,
+		Name:    "create_users",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS users (
+				id uuid PRIMARY KEY,
+				created_at timestamp,
+				updated_at timestamp,
+				deleted_at timestamp,
+				name text,
+				password text
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users (name)`,
+			`CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS users`,
+		},
+	},
+	{
+		Version: 2023090102,
+		Name:    "create_auths",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS auths (
+				id uuid PRIMARY KEY,
+				created_at timestamp,
+				updated_at timestamp,
+				deleted_at timestamp,
+				code uuid,
+				user_id uuid,
+				CONSTRAINT fk_auths_user FOREIGN KEY (user_id) REFERENCES users (id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_auths_deleted_at ON auths (deleted_at)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS auths`,
+		},
+	},
+	{
+		Version: 2026101801,
+		Name:    "add_auths_last_used_at",
+		Up: []string{
+			`ALTER TABLE auths ADD COLUMN last_used_at timestamp`,
+		},
+		Down: []string{
+			`ALTER TABLE auths DROP COLUMN last_used_at`,
+		},
+	},
+	{
+		Version: 2026101802,
+		Name:    "add_auths_refresh_tokens",
+		Up: []string{
+			`ALTER TABLE auths ADD COLUMN kind text NOT NULL DEFAULT 'access'`,
+			`ALTER TABLE auths ADD COLUMN family_id uuid`,
+			`ALTER TABLE auths ADD COLUMN used_at timestamp`,
+			`CREATE INDEX IF NOT EXISTS idx_auths_family_id ON auths (family_id)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_auths_family_id`,
+			`ALTER TABLE auths DROP COLUMN used_at`,
+			`ALTER TABLE auths DROP COLUMN family_id`,
+			`ALTER TABLE auths DROP COLUMN kind`,
+		},
+	},
+	{
+		Version: 2026101803,
+		Name:    "create_revoked_tokens",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS revoked_tokens (
+				id uuid PRIMARY KEY,
+				kind text NOT NULL,
+				subject text NOT NULL,
+				revoked_at timestamp NOT NULL,
+				expires_at timestamp NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS revoked_tokens`,
+		},
+	},
+	{
+		Version: 2026101804,
+		Name:    "add_users_role",
+		Up: []string{
+			`ALTER TABLE users ADD COLUMN role text NOT NULL DEFAULT 'reader'`,
+		},
+		Down: []string{
+			`ALTER TABLE users DROP COLUMN role`,
+		},
+	},
+	{
+		Version: 2026101810,
+		Name:    "unique_live_users_name",
+		// Databases created by AutoMigrate hold an inline UNIQUE on name, kept
+		// by sqlite until the table is rebuilt and named users_name_key on
+		// PostgreSQL. Checks of auths referencing users are deferred while
+		// the table is rebuilt, its rows are inserted back before commit.
+		DialectUp: map[string][]string{
+			db.Sqlite: {
+				`PRAGMA defer_foreign_keys = ON`,
+				`CREATE TABLE users_rebuild AS SELECT * FROM users`,
+				`DROP TABLE users`,
+				`CREATE TABLE users (
+					id uuid PRIMARY KEY,
+					created_at timestamp,
+					updated_at timestamp,
+					deleted_at timestamp,
+					name text,
+					password text,
+					role text NOT NULL DEFAULT 'reader'
+				)`,
+				`INSERT INTO users (id, created_at, updated_at, deleted_at, name, password, role)
+					SELECT id, created_at, updated_at, deleted_at, name, password, role FROM users_rebuild`,
+				`DROP TABLE users_rebuild`,
+				`CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at)`,
+			},
+			db.Postgres: {
+				`ALTER TABLE users DROP CONSTRAINT IF EXISTS users_name_key`,
+			},
+		},
+		Up: []string{
+			`DROP INDEX IF EXISTS idx_users_name`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users (name) WHERE deleted_at IS NULL`,
+		},
+		// Deleted users sharing a name get their id appended on down, as the
+		// name index covers them again.
+		Down: []string{
+			`UPDATE users SET name = name || '#' || id
+				WHERE deleted_at IS NOT NULL AND name IN (SELECT name FROM users GROUP BY name HAVING count(*) > 1)`,
+			`DROP INDEX IF EXISTS idx_users_name`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users (name)`,
+		},
+	},
+	{
+		Version: 2026101811,
+		Name:    "add_users_created_at_index",
+		Up: []string{
+			`CREATE INDEX IF NOT EXISTS idx_users_created_at_id ON users (created_at, id)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_users_created_at_id`,
+		},
+	},
 }
 
-func Drop(db *gorm.DB) {
-	db.Migrator().DropTable(&Auth{})
-	db.Migrator().DropTable(&User{})
+// Apply pending user migrations.
+func Migrate(database *gorm.DB) error {
+	_, err := (&db.Migrator{}).New(database, Migrations).Up(false)
+	return err
+}
+
+// Revert every applied user migration.
+func Drop(database *gorm.DB) error {
+	_, err := (&db.Migrator{}).New(database, Migrations).Down(len(Migrations), false)
+	return err
 }
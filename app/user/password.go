@@ -0,0 +1,140 @@
+package user
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"msim/app/shared"
+)
+
+// Longest password bcrypt hashes, in bytes.
+const MaxPasswordBytes = 72
+
+// Shortest name rejected inside passwords, shorter names match by chance.
+const minRejectedNameLength = 3
+
+// Character classes a policy may require.
+type CharacterClass string
+
+const (
+	LowerClass  CharacterClass = "lower"
+	UpperClass  CharacterClass = "upper"
+	DigitClass  CharacterClass = "digit"
+	SymbolClass CharacterClass = "symbol"
+)
+
+// Rules passwords are checked against on register and change.
+type PasswordPolicy struct {
+	// Characters at least.
+	MinLength int
+	// Bytes at most, up to MaxPasswordBytes.
+	MaxLength int
+	// Classes of characters every password must hold.
+	Require []CharacterClass
+	// Reject passwords holding the user name, ignoring case.
+	RejectName bool
+	// Lowercased passwords rejected as common or breached.
+	common map[string]struct{}
+}
+
+// Get the policy applied without configuration.
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{MinLength: 3, MaxLength: MaxPasswordBytes, RejectName: true}
+}
+
+// Check character class is supported.
+func (c CharacterClass) Valid() bool {
+	switch c {
+	case LowerClass, UpperClass, DigitClass, SymbolClass:
+		return true
+	}
+
+	return false
+}
+
+// Load common or breached passwords to reject from a file with one password
+// per line, ignoring case, empty lines and "#" comments.
+func (policy *PasswordPolicy) LoadCommon(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("can't read common passwords list: %w", err)
+	}
+	defer file.Close()
+
+	common := map[string]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		common[strings.ToLower(line)] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("can't read common passwords list: %w", err)
+	}
+
+	policy.common = common
+	return nil
+}
+
+// Check password of user name against every rule, returning a "password"
+// form exception per violated rule.
+func (policy *PasswordPolicy) Check(name, password string) []*shared.Exception {
+	var exceptions []*shared.Exception
+
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		ex := shared.FormException(shared.MIN_LENGTH_EX, "password")
+		ex.Reason = fmt.Sprintf("at least %d characters", policy.MinLength)
+		exceptions = append(exceptions, ex)
+	}
+
+	if len(password) > policy.MaxLength {
+		ex := shared.FormException(shared.MAX_LENGTH_EX, "password")
+		ex.Reason = fmt.Sprintf("at most %d bytes", policy.MaxLength)
+		exceptions = append(exceptions, ex)
+	}
+
+	for _, class := range policy.Require {
+		if !strings.ContainsFunc(password, class.matches) {
+			ex := shared.FormException(PASSWORD_CHARACTERS_EX, "password")
+			ex.Reason = string(class)
+			exceptions = append(exceptions, ex)
+		}
+	}
+
+	lowered := strings.ToLower(password)
+	if policy.RejectName && utf8.RuneCountInString(name) >= minRejectedNameLength && strings.Contains(lowered, strings.ToLower(name)) {
+		exceptions = append(exceptions, shared.FormException(PASSWORD_NAME_EX, "password"))
+	}
+
+	if _, ok := policy.common[lowered]; ok {
+		exceptions = append(exceptions, shared.FormException(PASSWORD_COMMON_EX, "password"))
+	}
+
+	return exceptions
+}
+
+// PRIVATE:
+
+// Report whether r belongs to character class.
+func (c CharacterClass) matches(r rune) bool {
+	switch c {
+	case LowerClass:
+		return unicode.IsLower(r)
+	case UpperClass:
+		return unicode.IsUpper(r)
+	case DigitClass:
+		return unicode.IsDigit(r)
+	case SymbolClass:
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+	}
+
+	return false
+}
@@ -0,0 +1,93 @@
+package user
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"msim/app/shared"
+)
+
+// Test PasswordPolicy.Check.
+func TestPasswordPolicy(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 8, MaxLength: MaxPasswordBytes, Require: []CharacterClass{UpperClass, DigitClass, SymbolClass}, RejectName: true}
+
+	t.Run("Should accept a password following every rule", func(t *testing.T) {
+		if exceptions := policy.Check("alice", "Tr0ub4dor&3"); len(exceptions) != 0 {
+			t.Fatalf("Check() returns %v, expects none", exceptions)
+		}
+	})
+
+	t.Run("Should return an exception per violated rule", func(t *testing.T) {
+		exceptions := policy.Check("alice", "alice")
+
+		expected := []struct {
+			sentinel *shared.Exception
+			reason   string
+		}{
+			{shared.ErrMinLength, "at least 8 characters"},
+			{ErrPasswordCharacters, "upper"},
+			{ErrPasswordCharacters, "digit"},
+			{ErrPasswordCharacters, "symbol"},
+			{ErrPasswordName, ""},
+		}
+
+		if len(exceptions) != len(expected) {
+			t.Fatalf("Check() returns %v, expects %d exceptions", exceptions, len(expected))
+		}
+
+		for i, e := range expected {
+			if !errors.Is(exceptions[i], e.sentinel) || exceptions[i].Reason != e.reason || exceptions[i].Field != "password" {
+				t.Fatalf("Check() returns %v at %d, expects %s %s", exceptions[i], i, e.sentinel.Tag, e.reason)
+			}
+		}
+	})
+
+	t.Run("Should reject passwords bcrypt would truncate", func(t *testing.T) {
+		password := "A1&" + string(make([]byte, MaxPasswordBytes))
+
+		exceptions := policy.Check("alice", password)
+		if len(exceptions) != 1 || !errors.Is(exceptions[0], shared.ErrMaxLength) {
+			t.Fatalf("Check() returns %v, expects a max length exception", exceptions)
+		}
+	})
+
+	t.Run("Should count characters rather than bytes for the minimum", func(t *testing.T) {
+		short := &PasswordPolicy{MinLength: 4, MaxLength: MaxPasswordBytes}
+
+		if exceptions := short.Check("", "ééé"); len(exceptions) != 1 {
+			t.Fatalf("Check() returns %v, expects a min length exception", exceptions)
+		}
+	})
+}
+
+// Test PasswordPolicy.LoadCommon.
+func TestLoadCommon(t *testing.T) {
+	t.Run("Should reject listed passwords ignoring case", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "common.txt")
+		os.WriteFile(path, []byte("# top passwords\nPassword1\n\nqwerty\n"), 0o644)
+
+		policy := DefaultPasswordPolicy()
+		if err := policy.LoadCommon(path); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, password := range []string{"password1", "QWERTY"} {
+			exceptions := policy.Check("alice", password)
+			if len(exceptions) != 1 || !errors.Is(exceptions[0], ErrPasswordCommon) {
+				t.Fatalf("Check(%s) returns %v, expects a common password exception", password, exceptions)
+			}
+		}
+
+		if exceptions := policy.Check("alice", "# top passwords"); len(exceptions) != 0 {
+			t.Fatal("Check() must ignore comments of the list")
+		}
+	})
+
+	t.Run("Should fail on a missing list", func(t *testing.T) {
+		if err := DefaultPasswordPolicy().LoadCommon(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+			t.Fatal("LoadCommon() expects error")
+		}
+	})
+}
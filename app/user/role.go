@@ -0,0 +1,63 @@
+package user
+
+import (
+	"slices"
+
+	"msim/app/shared"
+)
+
+type Role string
+
+// Roles granted to users, new users are readers.
+const (
+	AdminRole    Role = "admin"
+	OperatorRole Role = "operator"
+	ReaderRole   Role = "reader"
+)
+
+type Permission string
+
+// Permissions checked by services.
+const (
+	ReadSystemPermission  Permission = "system:read"
+	WriteSystemPermission Permission = "system:write"
+	// Set access policies of system variables, bypassing them.
+	ManagePoliciesPermission Permission = "system:policy"
+	// Permanently delete system variables.
+	PurgeSystemPermission Permission = "system:purge"
+	// Decrypt values of secret variables.
+	RevealSecretPermission Permission = "system:reveal"
+	ManageUsersPermission  Permission = "users:manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	AdminRole:    {ReadSystemPermission, WriteSystemPermission, ManagePoliciesPermission, PurgeSystemPermission, RevealSecretPermission, ManageUsersPermission},
+	OperatorRole: {ReadSystemPermission, WriteSystemPermission, RevealSecretPermission},
+	ReaderRole:   {ReadSystemPermission},
+}
+
+// Check if role is known.
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Check if role grants permission.
+func (r Role) Can(permission Permission) bool {
+	return slices.Contains(rolePermissions[r], permission)
+}
+
+// Check if user role grants permission.
+func (u *UserEntity) Can(permission Permission) bool {
+	return u != nil && u.Role.Can(permission)
+}
+
+// Check user is authenticated and allowed to permission,
+// otherwise return an UNAUTHORIZED_EX exception on the permission.
+func Authorize(user *UserEntity, permission Permission) *shared.Exception {
+	if !user.Can(permission) {
+		return shared.FormException(shared.UNAUTHORIZED_EX, string(permission))
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package user
+
+import (
+	"errors"
+	"testing"
+
+	"msim/app/shared"
+)
+
+// Test role permissions.
+func TestRole(t *testing.T) {
+	t.Run("Should grant permissions by role", func(t *testing.T) {
+		cases := []struct {
+			role       Role
+			permission Permission
+			expected   bool
+		}{
+			{AdminRole, ManageUsersPermission, true},
+			{AdminRole, WriteSystemPermission, true},
+			{OperatorRole, WriteSystemPermission, true},
+			{OperatorRole, ManageUsersPermission, false},
+			{ReaderRole, ReadSystemPermission, true},
+			{ReaderRole, WriteSystemPermission, false},
+			{"root", ReadSystemPermission, false},
+		}
+
+		for _, c := range cases {
+			if c.role.Can(c.permission) != c.expected {
+				t.Fatalf("%s.Can(%s) expects %t", c.role, c.permission, c.expected)
+			}
+		}
+	})
+
+	t.Run("Should not authorize anonymous users", func(t *testing.T) {
+		if ex := Authorize(nil, ReadSystemPermission); !errors.Is(ex, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package user
+
+import (
+	"github.com/google/uuid"
+	"msim/app/shared"
+)
+
+// Issues, authenticates and revokes access codes.
+// Refresh tokens are always stored through AuthRepository,
+// access codes are issued to the token family of their refresh token.
+type TokenStrategy interface {
+	// Issue an access code to user within token family.
+	Issue(user *UserEntity, familyId uuid.UUID) (string, error)
+	// Get the user an active access code was issued to.
+	Authenticate(code string) (*UserEntity, error)
+	// Revoke access code with its token family.
+	Revoke(code string) error
+	// Revoke every access code of token family.
+	RevokeFamily(familyId uuid.UUID) error
+	// Revoke every access code of user.
+	RevokeUser(userId uuid.UUID) error
+}
+
+// Opaque uuid access codes stored in the auths table.
+type CodeStrategy struct {
+	authRepository *AuthRepository
+}
+
+// Create a CodeStrategy instance.
+func (strategy *CodeStrategy) New(authRepository *AuthRepository) *CodeStrategy {
+	return &CodeStrategy{authRepository: authRepository}
+}
+
+// Issue an access code stored with its family.
+func (strategy *CodeStrategy) Issue(user *UserEntity, familyId uuid.UUID) (string, error) {
+	code, err := strategy.authRepository.CreateAccess(user.ID, familyId)
+	return code.String(), err
+}
+
+// Get the user of a stored, active access code.
+func (strategy *CodeStrategy) Authenticate(code string) (*UserEntity, error) {
+	parsed, err := parseCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	return strategy.authRepository.GetAuthUser(parsed)
+}
+
+// Revoke stored access code with its family.
+func (strategy *CodeStrategy) Revoke(code string) error {
+	parsed, err := parseCode(code)
+	if err != nil {
+		return err
+	}
+
+	return strategy.authRepository.Revoke(parsed)
+}
+
+// Revoke stored codes of family.
+func (strategy *CodeStrategy) RevokeFamily(familyId uuid.UUID) error {
+	return strategy.authRepository.RevokeFamily(familyId)
+}
+
+// Revoke stored codes of user.
+func (strategy *CodeStrategy) RevokeUser(userId uuid.UUID) error {
+	_, err := strategy.authRepository.RevokeAll(userId)
+	return err
+}
+
+// PRIVATE:
+
+// Parse opaque access code.
+func parseCode(code string) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(code)
+	if err != nil {
+		return uuid.Nil, shared.FormException(shared.UNAUTHORIZED_EX, "code").Wrap(err)
+	}
+
+	return parsed, nil
+}
@@ -2,16 +2,20 @@ package user
 
 import (
 	"fmt"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"msim/db"
 )
 
 type User struct {
 	gorm.Model
 	ID       uuid.UUID `gorm:"type:uuid;primaryKey"`
-	Name     string    `gorm:"unique"`
+	Name     string
 	Password string
+	Role     string `gorm:"default:reader"`
 }
 
 type UserRepository struct {
@@ -25,7 +29,7 @@ func (repository *UserRepository) New(database *gorm.DB) *UserRepository {
 
 // Create an user in database
 func (repository *UserRepository) Create(u *UserEntity) (*UserEntity, error) {
-	userModel := &User{ID: u.ID, Name: u.Name, Password: u.password}
+	userModel := &User{ID: u.ID, Name: u.Name, Password: u.password, Role: string(u.Role)}
 	result := repository.db.Create(&userModel)
 
 	if result.Error != nil {
@@ -33,6 +37,7 @@ func (repository *UserRepository) Create(u *UserEntity) (*UserEntity, error) {
 		return nil, result.Error
 	}
 
+	u.CreatedAt = userModel.CreatedAt
 	return u, nil
 }
 
@@ -50,23 +55,93 @@ func (repository *UserRepository) GetAll() ([]*UserEntity, error) {
 		return empty, result.Error
 	}
 
-	for _, model := range userModels {
-		users = append(users, &UserEntity{ID: model.ID, Name: model.Name})
+	for i := range userModels {
+		users = append(users, toEntity(&userModels[i]))
 	}
 
 	return users, nil
 }
 
+// Filters of user lists, zero values match every user.
+type UserFilter struct {
+	NamePrefix    string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// Columns user lists sort on, the first by default.
+var UserSorts = []string{"created_at", "name"}
+
+// Get a page of users matching filter.
+func (repository *UserRepository) List(filter *UserFilter, page *db.PageQuery) (*db.Page[*UserEntity], error) {
+	query := repository.db.Model(&User{})
+	if filter.NamePrefix != "" {
+		query = query.Where("substr(name, 1, ?) = ?", utf8.RuneCountInString(filter.NamePrefix), filter.NamePrefix)
+	}
+
+	if !filter.CreatedAfter.IsZero() {
+		query = query.Where("created_at >= ?", filter.CreatedAfter)
+	}
+
+	if !filter.CreatedBefore.IsZero() {
+		query = query.Where("created_at < ?", filter.CreatedBefore)
+	}
+
+	var total int64
+	if page.Total {
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	paginated, err := db.Paginate(query.Session(&gorm.Session{}), page)
+	if err != nil {
+		return nil, err
+	}
+
+	var models []*User
+	if err := paginated.Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	result := db.MapPage(db.Cut(models, page, func(model *User) (any, uuid.UUID) {
+		if page.Sort == "name" {
+			return model.Name, model.ID
+		}
+		return model.CreatedAt, model.ID
+	}), toEntity)
+
+	if page.Total {
+		result.Total = &total
+	}
+
+	return result, nil
+}
+
 // Get an user by id
 func (repository *UserRepository) GetById(id uuid.UUID) (*UserEntity, error) {
 	var model User
 
 	result := repository.db.Where("id = ?", id).First(&model)
 	if result.Error != nil {
-		return nil, result.Error
+		return nil, db.TranslateError(result.Error, "user")
+	}
+
+	return toEntity(&model), nil
+}
+
+// Get an user by id with its password hash, to check a password against.
+func (repository *UserRepository) GetWithPassword(id uuid.UUID) (*UserEntity, error) {
+	var model User
+
+	result := repository.db.Where("id = ?", id).First(&model)
+	if result.Error != nil {
+		return nil, db.TranslateError(result.Error, "user")
 	}
 
-	return &UserEntity{ID: model.ID, Name: model.Name}, nil
+	entity := toEntity(&model)
+	entity.password = model.Password
+	return entity, nil
 }
 
 // Get an user by name
@@ -74,9 +149,159 @@ func (repository *UserRepository) GetByName(name string) (*UserEntity, error) {
 	var model User
 
 	result := repository.db.Where("name = ?", name).First(&model)
+	if result.Error != nil {
+		return nil, db.TranslateError(result.Error, "user")
+	}
+
+	entity := toEntity(&model)
+	entity.password = model.Password
+	return entity, nil
+}
+
+// Set role of user by name.
+func (repository *UserRepository) UpdateRole(name string, role Role) (*UserEntity, error) {
+	result := repository.db.Model(&User{}).Where("name = ?", name).Update("role", string(role))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, db.TranslateError(gorm.ErrRecordNotFound, "user")
+	}
+
+	return repository.GetByName(name)
+}
+
+// Set password hash of user by id.
+func (repository *UserRepository) UpdatePassword(id uuid.UUID, password string) error {
+	result := repository.db.Model(&User{}).Where("id = ?", id).Update("password", password)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return db.TranslateError(gorm.ErrRecordNotFound, "user")
+	}
+
+	return nil
+}
+
+// Set name of user by id.
+func (repository *UserRepository) Rename(id uuid.UUID, name string) (*UserEntity, error) {
+	result := repository.db.Model(&User{}).Where("id = ?", id).Update("name", name)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
-	return &UserEntity{ID: model.ID, Name: model.Name, password: model.Password}, nil
+	if result.RowsAffected == 0 {
+		return nil, db.TranslateError(gorm.ErrRecordNotFound, "user")
+	}
+
+	return repository.GetById(id)
+}
+
+// Permanently delete user by id with its codes.
+func (repository *UserRepository) DeleteAccount(id uuid.UUID) (*UserEntity, error) {
+	var model User
+
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", id).First(&model).Error; err != nil {
+			return db.TranslateError(err, "user")
+		}
+
+		if err := tx.Unscoped().Where("user_id = ?", id).Delete(&Auth{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&model).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return toEntity(&model), nil
+}
+
+// Soft delete user by name, freeing the name for a new user.
+func (repository *UserRepository) Delete(name string) (*UserEntity, error) {
+	var model User
+
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("name = ?", name).First(&model).Error; err != nil {
+			return db.TranslateError(err, "user")
+		}
+
+		return tx.Delete(&model).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return toEntity(&model), nil
+}
+
+// Restore the last deleted user of name.
+func (repository *UserRepository) Restore(name string) (*UserEntity, error) {
+	var model User
+
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("name = ? AND deleted_at IS NOT NULL", name).
+			Order("deleted_at DESC").First(&model)
+		if result.Error != nil {
+			return db.TranslateError(result.Error, "user")
+		}
+
+		return tx.Unscoped().Model(&model).Update("deleted_at", nil).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return toEntity(&model), nil
+}
+
+// Permanently delete every user of name, live or deleted, with their codes.
+func (repository *UserRepository) Purge(name string) ([]*UserEntity, error) {
+	var (
+		models []User
+		users  []*UserEntity
+	)
+
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("name = ?", name).Find(&models).Error; err != nil {
+			return err
+		}
+
+		if len(models) == 0 {
+			return db.TranslateError(gorm.ErrRecordNotFound, "user")
+		}
+
+		var ids []uuid.UUID
+		for i := range models {
+			ids = append(ids, models[i].ID)
+			users = append(users, toEntity(&models[i]))
+		}
+
+		if err := tx.Unscoped().Where("user_id IN ?", ids).Delete(&Auth{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&User{}).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// PRIVATE:
+
+// Map user model to entity, without its password.
+func toEntity(model *User) *UserEntity {
+	return &UserEntity{ID: model.ID, Name: model.Name, Role: Role(model.Role), CreatedAt: model.CreatedAt}
 }
@@ -1,18 +1,21 @@
 package user
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"msim/app/shared"
 	"msim/db"
 )
 
 // Test create.
 func TestCreate(t *testing.T) {
 	t.Run("Should create an user and return an user entity", func(t *testing.T) {
-		repository, DB := CreateUserRepository()
+		repository, DB := CreateUserRepository(t)
 		result, err := repository.Create(&UserEntity{Name: "test", password: "12345"})
 
 		if err != nil {
@@ -37,7 +40,7 @@ func TestCreate(t *testing.T) {
 	})
 
 	t.Run("Should not create an user when user name already exists", func(t *testing.T) {
-		repository, DB := CreateUserRepository()
+		repository, DB := CreateUserRepository(t)
 
 		DB.Create(&User{Name: "test", Password: "12345"})
 		_, err := repository.Create(&UserEntity{Name: "test", password: "12345"})
@@ -51,7 +54,7 @@ func TestCreate(t *testing.T) {
 // Test getAll.
 func TestGetAll(t *testing.T) {
 	t.Run("Should get all users when theres users", func(t *testing.T) {
-		repository, DB := CreateUserRepository()
+		repository, DB := CreateUserRepository(t)
 
 		DB.Create(&User{ID: uuid.New(), Name: "Test", Password: "12345"})
 		DB.Create(&User{Name: "test2", Password: "12345"})
@@ -80,7 +83,7 @@ func TestGetAll(t *testing.T) {
 	})
 
 	t.Run("Should get an empty array when theres no user", func(t *testing.T) {
-		repository, _ := CreateUserRepository()
+		repository, _ := CreateUserRepository(t)
 
 		result, err := repository.GetAll()
 
@@ -105,7 +108,7 @@ func TestGetAll(t *testing.T) {
 // Test getById.
 func TestGetById(t *testing.T) {
 	t.Run("Should get an user by id when exists", func(t *testing.T) {
-		repository, DB := CreateUserRepository()
+		repository, DB := CreateUserRepository(t)
 
 		created := User{ID: uuid.New(), Name: "Testll", Password: "12345"}
 		DB.Create(&created)
@@ -127,10 +130,18 @@ func TestGetById(t *testing.T) {
 		if result.Name != created.Name {
 			t.Fatal("User name should match should match")
 		}
+
+		if result.password != "" {
+			t.Fatal("Should not load the password")
+		}
+
+		if result, _ = repository.GetWithPassword(created.ID); result.password != created.Password {
+			t.Fatal("Should load the password when asked for")
+		}
 	})
 
 	t.Run("Should not get an user by id when doesnt exists", func(t *testing.T) {
-		repository, _ := CreateUserRepository()
+		repository, _ := CreateUserRepository(t)
 
 		result, err := repository.GetById(uuid.New())
 
@@ -138,16 +149,81 @@ func TestGetById(t *testing.T) {
 			t.Fatal("Should throw error")
 		}
 
+		if !errors.Is(err, shared.ErrNotFound) || !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatal("Should throw a not found exception wrapping the ORM error")
+		}
+
 		if result != nil {
 			t.Fatal("User should be nil")
 		}
 	})
 }
 
+// Models of users and auths as created by AutoMigrate before migrations.
+type autoMigratedUser struct {
+	gorm.Model
+	ID       uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Name     string    `gorm:"unique"`
+	Password string
+}
+
+type autoMigratedAuth struct {
+	gorm.Model
+	ID     uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Code   uuid.UUID
+	UserID uuid.UUID
+	User   autoMigratedUser
+}
+
+// Table name of autoMigratedUser.
+func (autoMigratedUser) TableName() string {
+	return "users"
+}
+
+// Table name of autoMigratedAuth.
+func (autoMigratedAuth) TableName() string {
+	return "auths"
+}
+
+// Test migration unique_live_users_name.
+func TestUniqueNameMigration(t *testing.T) {
+	t.Run("Should free names of deleted users on databases created by AutoMigrate", func(t *testing.T) {
+		DB, cleanup, err := db.TestDB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(cleanup)
+
+		DB.AutoMigrate(&autoMigratedUser{}, &autoMigratedAuth{})
+		bob := autoMigratedUser{ID: uuid.New(), Name: "bob", Password: "12345"}
+		DB.Create(&bob)
+		DB.Omit("User").Create(&autoMigratedAuth{ID: uuid.New(), Code: uuid.New(), UserID: bob.ID})
+
+		if err := Migrate(DB); err != nil {
+			t.Fatal(err)
+		}
+
+		var codes int64
+		DB.Model(&Auth{}).Where("user_id = ?", bob.ID).Count(&codes)
+		if codes != 1 {
+			t.Fatal("Should keep the codes of migrated users")
+		}
+
+		repository := &UserRepository{db: DB}
+		if _, err := repository.Delete("bob"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := repository.Create(&UserEntity{ID: uuid.New(), Name: "bob"}); err != nil {
+			t.Fatal("Should register the name of a deleted user again", err)
+		}
+	})
+}
+
 // Test getByName.
 func TestGetByName(t *testing.T) {
 	t.Run("Should get an user by name when exists", func(t *testing.T) {
-		repository, DB := CreateUserRepository()
+		repository, DB := CreateUserRepository(t)
 
 		created := User{ID: uuid.New(), Name: "Test867", Password: "12345"}
 		DB.Create(&created)
@@ -172,7 +248,7 @@ func TestGetByName(t *testing.T) {
 	})
 
 	t.Run("Should not get an user by name when doesnt exists", func(t *testing.T) {
-		repository, _ := CreateUserRepository()
+		repository, _ := CreateUserRepository(t)
 		result, err := repository.GetByName("Test2")
 
 		if err == nil {
@@ -185,12 +261,218 @@ func TestGetByName(t *testing.T) {
 	})
 }
 
+// Test Delete, Restore and Purge.
+func TestDelete(t *testing.T) {
+	t.Run("Should soft delete an user and free its name", func(t *testing.T) {
+		repository, DB := CreateUserRepository(t)
+		DB.Create(&User{ID: uuid.New(), Name: "Test", Password: "12345"})
+
+		if _, err := repository.Delete("Test"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := repository.GetByName("Test"); err == nil {
+			t.Fatal("Should not get a deleted user")
+		}
+
+		if _, err := repository.Create(&UserEntity{ID: uuid.New(), Name: "Test"}); err != nil {
+			t.Fatal("Should register the name of a deleted user again")
+		}
+	})
+
+	t.Run("Should restore a deleted user", func(t *testing.T) {
+		repository, DB := CreateUserRepository(t)
+		created := User{ID: uuid.New(), Name: "Test", Password: "12345"}
+		DB.Create(&created)
+		repository.Delete("Test")
+
+		result, err := repository.Restore("Test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.ID != created.ID {
+			t.Fatal("Should restore the deleted user")
+		}
+	})
+
+	t.Run("Should rename deleted users sharing a name to revert the name index", func(t *testing.T) {
+		repository, DB := CreateUserRepository(t)
+		deleted := User{ID: uuid.New(), Name: "Test", Password: "12345"}
+		DB.Create(&deleted)
+		repository.Delete("Test")
+		DB.Create(&User{ID: uuid.New(), Name: "Test", Password: "12345"})
+
+		if _, err := (&db.Migrator{}).New(DB, Migrations).Down(2, false); err != nil {
+			t.Fatal(err)
+		}
+
+		var result User
+		DB.Unscoped().Where("id = ?", deleted.ID).First(&result)
+		if result.Name != "Test#"+deleted.ID.String() {
+			t.Fatalf("Expected the deleted user renamed, got %s", result.Name)
+		}
+	})
+
+	t.Run("Should purge every user of a name with their codes", func(t *testing.T) {
+		repository, DB := CreateUserRepository(t)
+		deleted := User{ID: uuid.New(), Name: "Test", Password: "12345"}
+		DB.Create(&deleted)
+		DB.Omit("User").Create(&Auth{ID: uuid.New(), Code: uuid.New(), UserID: deleted.ID})
+		repository.Delete("Test")
+		DB.Create(&User{ID: uuid.New(), Name: "Test", Password: "12345"})
+
+		result, err := repository.Purge("Test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var count int64
+		DB.Unscoped().Model(&User{}).Count(&count)
+		if len(result) != 2 || count != 0 {
+			t.Fatalf("Expected 2 purged users and none left, got %d and %d", len(result), count)
+		}
+
+		if _, err := repository.Purge("Test"); !errors.Is(err, shared.ErrNotFound) {
+			t.Fatal("Should throw a not found exception")
+		}
+	})
+}
+
+// Test UpdatePassword, Rename and DeleteAccount.
+func TestAccount(t *testing.T) {
+	t.Run("Should update the password of an user", func(t *testing.T) {
+		repository, DB := CreateUserRepository(t)
+		created := User{ID: uuid.New(), Name: "Test", Password: "12345"}
+		DB.Create(&created)
+
+		if err := repository.UpdatePassword(created.ID, "hash"); err != nil {
+			t.Fatal(err)
+		}
+
+		result, _ := repository.GetWithPassword(created.ID)
+		if result.password != "hash" {
+			t.Fatal("Should store the new password")
+		}
+
+		if err := repository.UpdatePassword(uuid.New(), "hash"); !errors.Is(err, shared.ErrNotFound) {
+			t.Fatal("Should throw a not found exception")
+		}
+	})
+
+	t.Run("Should rename an user unless the name is taken", func(t *testing.T) {
+		repository, DB := CreateUserRepository(t)
+		created := User{ID: uuid.New(), Name: "Test", Password: "12345"}
+		DB.Create(&created)
+		DB.Create(&User{ID: uuid.New(), Name: "Taken", Password: "12345"})
+
+		result, err := repository.Rename(created.ID, "Renamed")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Name != "Renamed" || result.ID != created.ID {
+			t.Fatal("Should return the renamed user")
+		}
+
+		if _, err := repository.Rename(created.ID, "Taken"); err == nil {
+			t.Fatal("Should not rename an user to a taken name")
+		}
+	})
+
+	t.Run("Should permanently delete an user with its codes", func(t *testing.T) {
+		repository, DB := CreateUserRepository(t)
+		created := User{ID: uuid.New(), Name: "Test", Password: "12345"}
+		DB.Create(&created)
+		DB.Omit("User").Create(&Auth{ID: uuid.New(), Code: uuid.New(), UserID: created.ID})
+
+		if _, err := repository.DeleteAccount(created.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		var users, codes int64
+		DB.Unscoped().Model(&User{}).Count(&users)
+		DB.Unscoped().Model(&Auth{}).Count(&codes)
+		if users != 0 || codes != 0 {
+			t.Fatalf("Expected no user and no code left, got %d and %d", users, codes)
+		}
+
+		if _, err := repository.DeleteAccount(created.ID); !errors.Is(err, shared.ErrNotFound) {
+			t.Fatal("Should throw a not found exception")
+		}
+	})
+}
+
+// Test List.
+func TestList(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Should page users by creation date", func(t *testing.T) {
+		repository, _ := CreateUsers(t, start, "carol", "alice", "bob")
+
+		first, err := repository.List(&UserFilter{}, &db.PageQuery{Limit: 2, Sort: "created_at", Order: db.Ascending})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(first.Items) != 2 || first.Items[0].Name != "carol" || first.NextCursor == "" {
+			t.Fatal("Should return the 2 oldest users and a cursor")
+		}
+
+		last, _ := repository.List(&UserFilter{}, &db.PageQuery{Limit: 2, Cursor: first.NextCursor, Sort: "created_at", Order: db.Ascending})
+		if len(last.Items) != 1 || last.Items[0].Name != "bob" || last.NextCursor != "" {
+			t.Fatal("Should return the last user without a cursor")
+		}
+	})
+
+	t.Run("Should sort users by name descending", func(t *testing.T) {
+		repository, _ := CreateUsers(t, start, "carol", "alice", "bob")
+
+		result, err := repository.List(&UserFilter{}, &db.PageQuery{Limit: 10, Sort: "name", Order: db.Descending})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Items) != 3 || result.Items[0].Name != "carol" || result.Items[2].Name != "alice" {
+			t.Fatal("Should return users from carol to alice")
+		}
+	})
+
+	t.Run("Should filter users by name prefix and creation date", func(t *testing.T) {
+		repository, _ := CreateUsers(t, start, "alice", "albert", "bob", "alfred")
+		filter := &UserFilter{NamePrefix: "al", CreatedAfter: start.Add(time.Hour), CreatedBefore: start.Add(3 * time.Hour)}
+
+		result, err := repository.List(filter, &db.PageQuery{Limit: 10, Sort: "name", Order: db.Ascending, Total: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Items) != 1 || result.Items[0].Name != "albert" || *result.Total != 1 {
+			t.Fatal("Should only return albert")
+		}
+	})
+}
+
 // Create repository and test database.
-func CreateUserRepository() (*UserRepository, *gorm.DB) {
-	DB, _ := db.InMemoryDB()
+func CreateUserRepository(t *testing.T) (*UserRepository, *gorm.DB) {
+	DB, cleanup, err := db.TestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
 
 	Drop(DB)
 	Migrate(DB)
 
 	return &UserRepository{db: DB}, DB
 }
+
+// Create repository with users of names, created an hour apart from start.
+func CreateUsers(t *testing.T, start time.Time, names ...string) (*UserRepository, *gorm.DB) {
+	repository, DB := CreateUserRepository(t)
+	for i, name := range names {
+		DB.Create(&User{Model: gorm.Model{CreatedAt: start.Add(time.Duration(i) * time.Hour)}, ID: uuid.New(), Name: name, Password: "12345"})
+	}
+
+	return repository, DB
+}
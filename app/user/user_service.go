@@ -1,28 +1,33 @@
 package user
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"msim/app/shared"
+	"msim/db"
 )
 
 type UserEntity struct {
-	ID       uuid.UUID
-	Name     string
-	password string
+	ID        uuid.UUID
+	Name      string
+	Role      Role
+	CreatedAt time.Time
+	password  string
 }
 
-// Validade new User.
-func (u *UserEntity) validate() *shared.Exception {
-	if len(u.password) < 3 {
-		return shared.FormException(shared.MIN_LENGTH_EX, "password")
-	}
-
-	if len(u.Name) < 3 {
-		return shared.FormException(shared.MIN_LENGTH_EX, "name")
+// Validade new User against the password policy, reporting every violation.
+func (u *UserEntity) validate(policy *PasswordPolicy) *shared.Exception {
+	exceptions := policy.Check(u.Name, u.password)
+	if ex := validateName(u.Name); ex != nil {
+		exceptions = append(exceptions, ex)
 	}
 
-	return nil
+	return shared.JoinExceptions(exceptions...)
 }
 
 // Verify user password.
@@ -34,74 +39,459 @@ func (u *UserEntity) verifyPassword(password string) bool {
 type UserService struct {
 	userRepository *UserRepository
 	authRepository *AuthRepository
+	bcryptCost     int
+	tokenStrategy  TokenStrategy
+	passwordPolicy *PasswordPolicy
+}
+
+// Create an UserService instance, passwords are checked against
+// passwordPolicy, DefaultPasswordPolicy when nil, and hashed with bcryptCost.
+// Access codes are issued by tokenStrategy, stored uuid codes when nil.
+func (service *UserService) New(userRepository *UserRepository, authRepository *AuthRepository, bcryptCost int, tokenStrategy TokenStrategy, passwordPolicy *PasswordPolicy) *UserService {
+	return &UserService{
+		userRepository: userRepository,
+		authRepository: authRepository,
+		bcryptCost:     bcryptCost,
+		tokenStrategy:  tokenStrategy,
+		passwordPolicy: passwordPolicy,
+	}
+}
+
+// Access code with the refresh token exchanging it for a new one.
+type TokenPair struct {
+	Code         string    `json:"code"`
+	RefreshToken uuid.UUID `json:"refresh_token"`
 }
 
 type UserAuthDTO struct {
-	Name     string
-	Password string
+	Name     string `json:"name"`
+	Password string `json:"password"`
 }
 
 // Register user with a password.
 func (service *UserService) Register(u *UserAuthDTO) (*UserEntity, *shared.Exception) {
-	user, ex := new(u.Name, u.Password)
+	user, ex := new(u.Name, u.Password, service.bcryptCost, service.policy())
 	if ex != nil {
 		return nil, ex
 	}
 
 	result, err := service.userRepository.Create(user)
 	if err != nil {
-		return nil, shared.DefaultException(shared.ALREADY_CREATED_EX, "user")
+		return nil, shared.DefaultException(shared.ALREADY_CREATED_EX, "user").Wrap(err)
 	}
 
 	return result, nil
 }
 
 // Login user, if user exists and password is correct
-// return the authentication token.
-func (service *UserService) Login(u *UserAuthDTO) (uuid.UUID, *shared.Exception) {
+// return the authentication code and its refresh token.
+func (service *UserService) Login(u *UserAuthDTO) (*TokenPair, *shared.Exception) {
 	user, err := service.userRepository.GetByName(u.Name)
 
 	if err != nil {
-		return uuid.Nil, shared.FormException(shared.NOT_FOUND_EX, "user")
+		return nil, shared.FormException(shared.NOT_FOUND_EX, "user").Wrap(err)
 	}
 
 	if !user.verifyPassword(u.Password) {
-		return uuid.Nil, shared.FormException(shared.UNAUTHORIZED_EX, "password")
+		return nil, shared.FormException(shared.UNAUTHORIZED_EX, "password")
+	}
+
+	grant, err := service.authRepository.CreateRefresh(user.ID)
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	return service.issue(user, grant)
+}
+
+type RefreshDTO struct {
+	RefreshToken uuid.UUID `json:"refresh_token"`
+}
+
+// Exchange a refresh token for a new authentication code and refresh token,
+// reusing a refresh token revokes every token issued from the same login.
+func (service *UserService) Refresh(dto *RefreshDTO) (*TokenPair, *shared.Exception) {
+	grant, err := service.authRepository.Rotate(dto.RefreshToken)
+
+	if errors.Is(err, ErrTokenReused) {
+		if err := service.tokens().RevokeFamily(grant.FamilyID); err != nil {
+			return nil, shared.InternalErrorException().Wrap(err)
+		}
+
+		return nil, shared.FormException(TOKEN_REUSED_EX, "refresh_token").Wrap(ErrTokenReused)
+	}
+
+	if err != nil {
+		msg := "Expired or revoked refresh token"
+		return nil, shared.DefaultException(shared.UNAUTHORIZED_EX, msg).Wrap(err)
+	}
+
+	user, err := service.userRepository.GetById(grant.UserID)
+	if err != nil {
+		return nil, shared.FormException(shared.NOT_FOUND_EX, "user").Wrap(err)
+	}
+
+	return service.issue(user, grant)
+}
+
+type UserRoleDTO struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+}
+
+// Set role of an user, actor must be allowed to manage users.
+// Codes of the user are revoked so the new role applies on next login.
+func (service *UserService) SetRole(actor *UserEntity, dto *UserRoleDTO) (*UserEntity, *shared.Exception) {
+	if ex := Authorize(actor, ManageUsersPermission); ex != nil {
+		return nil, ex
+	}
+
+	return service.AssignRole(dto)
+}
+
+// Set role of an user without authorization, for trusted callers like the command line.
+func (service *UserService) AssignRole(dto *UserRoleDTO) (*UserEntity, *shared.Exception) {
+	if !dto.Role.Valid() {
+		return nil, shared.FormException(shared.APPLICATION_EX, "role")
+	}
+
+	user, err := service.userRepository.UpdateRole(dto.Name, dto.Role)
+	if errors.Is(err, shared.ErrNotFound) {
+		return nil, shared.FormException(shared.NOT_FOUND_EX, "user").Wrap(err)
+	}
+
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	if err := service.tokens().RevokeUser(user.ID); err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	return user, nil
+}
+
+type UserListDTO struct {
+	UserFilter
+	Page db.PageQuery
+}
+
+// List a page of users matching the filter, actor must be allowed to manage users.
+func (service *UserService) List(actor *UserEntity, dto *UserListDTO) (*db.Page[*UserEntity], *shared.Exception) {
+	if ex := Authorize(actor, ManageUsersPermission); ex != nil {
+		return nil, ex
+	}
+
+	page := dto.Page
+	if ex := page.Validate(UserSorts...); ex != nil {
+		return nil, ex
 	}
 
-	code, err := service.authRepository.Create(user.ID)
+	result, err := service.userRepository.List(&dto.UserFilter, &page)
 	if err != nil {
-		return uuid.Nil, shared.InternalErrorException()
+		return nil, shared.InternalErrorException().Wrap(err)
 	}
 
-	return code, nil
+	return result, nil
+}
+
+type UserNameDTO struct {
+	Name string `json:"name"`
+}
+
+// Soft delete an user and revoke its codes, its name can be registered again.
+// Actor must be allowed to manage users.
+func (service *UserService) Delete(actor *UserEntity, dto *UserNameDTO) (*UserEntity, *shared.Exception) {
+	if ex := Authorize(actor, ManageUsersPermission); ex != nil {
+		return nil, ex
+	}
+
+	user, err := service.userRepository.Delete(dto.Name)
+	if errors.Is(err, shared.ErrNotFound) {
+		return nil, shared.FormException(shared.NOT_FOUND_EX, "user").Wrap(err)
+	}
+
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	if err := service.tokens().RevokeUser(user.ID); err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	return user, nil
+}
+
+// Restore the last deleted user of a name that is free again.
+// Actor must be allowed to manage users.
+func (service *UserService) Restore(actor *UserEntity, dto *UserNameDTO) (*UserEntity, *shared.Exception) {
+	if ex := Authorize(actor, ManageUsersPermission); ex != nil {
+		return nil, ex
+	}
+
+	if _, err := service.userRepository.GetByName(dto.Name); err == nil {
+		return nil, shared.FormException(shared.ALREADY_CREATED_EX, "user")
+	}
+
+	user, err := service.userRepository.Restore(dto.Name)
+	if errors.Is(err, shared.ErrNotFound) {
+		return nil, shared.FormException(shared.NOT_FOUND_EX, "user").Wrap(err)
+	}
+
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	return user, nil
+}
+
+// Permanently delete every user of a name, deleted or not, with their codes.
+// Actor must be allowed to manage users.
+func (service *UserService) Purge(actor *UserEntity, dto *UserNameDTO) *shared.Exception {
+	if ex := Authorize(actor, ManageUsersPermission); ex != nil {
+		return ex
+	}
+
+	users, err := service.userRepository.Purge(dto.Name)
+	if errors.Is(err, shared.ErrNotFound) {
+		return shared.FormException(shared.NOT_FOUND_EX, "user").Wrap(err)
+	}
+
+	if err != nil {
+		return shared.InternalErrorException().Wrap(err)
+	}
+
+	for _, user := range users {
+		if err := service.tokens().RevokeUser(user.ID); err != nil {
+			return shared.InternalErrorException().Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+type UserPasswordDTO struct {
+	Password    string `json:"password"`
+	NewPassword string `json:"new_password"`
+}
+
+// Change password of actor, who must send the current one.
+// Codes of actor are revoked so every session logs in again.
+func (service *UserService) ChangePassword(actor *UserEntity, dto *UserPasswordDTO) *shared.Exception {
+	user, ex := service.confirm(actor, dto.Password)
+	if ex != nil {
+		return ex
+	}
+
+	exceptions := service.policy().Check(user.Name, dto.NewPassword)
+	for _, ex := range exceptions {
+		ex.Field = "new_password"
+	}
+
+	if ex := shared.JoinExceptions(exceptions...); ex != nil {
+		return ex
+	}
+
+	hashPassword, ex := getPasswordHash(dto.NewPassword, service.bcryptCost)
+	if ex != nil {
+		return ex
+	}
+
+	if err := service.userRepository.UpdatePassword(user.ID, hashPassword); err != nil {
+		return shared.InternalErrorException().Wrap(err)
+	}
+
+	if err := service.tokens().RevokeUser(user.ID); err != nil {
+		return shared.InternalErrorException().Wrap(err)
+	}
+
+	return nil
+}
+
+// Rename actor, the name must be free. Codes of actor are revoked
+// so the new name applies on next login.
+func (service *UserService) Rename(actor *UserEntity, dto *UserNameDTO) (*UserEntity, *shared.Exception) {
+	if actor == nil {
+		return nil, shared.DefaultException(shared.UNAUTHORIZED_EX, "authentication required")
+	}
+
+	if ex := validateName(dto.Name); ex != nil {
+		return nil, ex
+	}
+
+	if found, err := service.userRepository.GetByName(dto.Name); err == nil && found.ID != actor.ID {
+		return nil, shared.FormException(shared.ALREADY_CREATED_EX, "name")
+	}
+
+	user, err := service.userRepository.Rename(actor.ID, dto.Name)
+	if errors.Is(err, shared.ErrNotFound) {
+		return nil, shared.FormException(shared.NOT_FOUND_EX, "user").Wrap(err)
+	}
+
+	if err != nil {
+		return nil, shared.FormException(shared.ALREADY_CREATED_EX, "name").Wrap(err)
+	}
+
+	if err := service.tokens().RevokeUser(user.ID); err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	return user, nil
+}
+
+type UserConfirmDTO struct {
+	Password string `json:"password"`
+}
+
+// Permanently delete the account of actor with its codes, actor must send
+// its password. Admins remove other accounts with Delete and Purge.
+func (service *UserService) DeleteAccount(actor *UserEntity, dto *UserConfirmDTO) *shared.Exception {
+	user, ex := service.confirm(actor, dto.Password)
+	if ex != nil {
+		return ex
+	}
+
+	if err := service.tokens().RevokeUser(user.ID); err != nil {
+		return shared.InternalErrorException().Wrap(err)
+	}
+
+	if _, err := service.userRepository.DeleteAccount(user.ID); err != nil {
+		return shared.InternalErrorException().Wrap(err)
+	}
+
+	return nil
 }
 
 type AuthDTO struct {
-	Code uuid.UUID
+	Code string `json:"code"`
 }
 
 // Return authenticated user by authentication code.
 func (service *UserService) GetAuthUser(auth *AuthDTO) (*UserEntity, *shared.Exception) {
-	user, err := service.authRepository.GetAuthUser(auth.Code)
+	user, err := service.tokens().Authenticate(auth.Code)
 	if err != nil || user.ID == uuid.Nil {
 		msg := "Expired token or user doesnt exists"
-		return nil, shared.DefaultException(shared.UNAUTHORIZED_EX, msg)
+		return nil, shared.DefaultException(shared.UNAUTHORIZED_EX, msg).Wrap(err)
 	}
 
 	return user, nil
 }
 
+// Revoke authentication code.
+func (service *UserService) Logout(auth *AuthDTO) *shared.Exception {
+	if _, ex := service.GetAuthUser(auth); ex != nil {
+		return ex
+	}
+
+	if err := service.tokens().Revoke(auth.Code); err != nil {
+		return shared.InternalErrorException().Wrap(err)
+	}
+
+	return nil
+}
+
+// Revoke every authentication code of the authenticated user.
+func (service *UserService) LogoutAll(auth *AuthDTO) *shared.Exception {
+	user, ex := service.GetAuthUser(auth)
+	if ex != nil {
+		return ex
+	}
+
+	if err := service.tokens().RevokeUser(user.ID); err != nil {
+		return shared.InternalErrorException().Wrap(err)
+	}
+
+	return nil
+}
+
+// Delete expired and revoked authentication codes every interval until ctx is done.
+func (service *UserService) SweepExpired(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := service.authRepository.DeleteExpired(); err != nil {
+				fmt.Println("Error deleting expired authentication codes", err)
+			}
+
+			if sweeper, ok := service.tokens().(interface{ Sweep() error }); ok {
+				if err := sweeper.Sweep(); err != nil {
+					fmt.Println("Error sweeping revoked access codes", err)
+				}
+			}
+		}
+	}
+}
+
 // PRIVATE:
 
+// Get configured token strategy or the stored uuid codes one.
+func (service *UserService) tokens() TokenStrategy {
+	if service.tokenStrategy == nil {
+		return (&CodeStrategy{}).New(service.authRepository)
+	}
+
+	return service.tokenStrategy
+}
+
+// Get configured password policy or the default one.
+func (service *UserService) policy() *PasswordPolicy {
+	if service.passwordPolicy == nil {
+		return DefaultPasswordPolicy()
+	}
+
+	return service.passwordPolicy
+}
+
+// Issue an access code to user within the family of grant.
+func (service *UserService) issue(user *UserEntity, grant *RefreshGrant) (*TokenPair, *shared.Exception) {
+	code, err := service.tokens().Issue(user, grant.FamilyID)
+	if err != nil {
+		return nil, shared.InternalErrorException().Wrap(err)
+	}
+
+	return &TokenPair{Code: code, RefreshToken: grant.RefreshToken}, nil
+}
+
+// Get actor with its password hash, checking password matches it.
+func (service *UserService) confirm(actor *UserEntity, password string) (*UserEntity, *shared.Exception) {
+	if actor == nil {
+		return nil, shared.DefaultException(shared.UNAUTHORIZED_EX, "authentication required")
+	}
+
+	user, err := service.userRepository.GetWithPassword(actor.ID)
+	if err != nil {
+		return nil, shared.FormException(shared.NOT_FOUND_EX, "user").Wrap(err)
+	}
+
+	if !user.verifyPassword(password) {
+		return nil, shared.FormException(shared.UNAUTHORIZED_EX, "password")
+	}
+
+	return user, nil
+}
+
+// Check name is long enough.
+func validateName(name string) *shared.Exception {
+	if len(name) < 3 {
+		return shared.FormException(shared.MIN_LENGTH_EX, "name")
+	}
+
+	return nil
+}
+
 // Create a new User.
-func new(name, passwd string) (*UserEntity, *shared.Exception) {
-	user := UserEntity{ID: uuid.New(), Name: name, password: passwd}
-	if ex := user.validate(); ex != nil {
+func new(name, passwd string, cost int, policy *PasswordPolicy) (*UserEntity, *shared.Exception) {
+	user := UserEntity{ID: uuid.New(), Name: name, Role: ReaderRole, password: passwd}
+	if ex := user.validate(policy); ex != nil {
 		return nil, ex
 	}
 
-	hashPassword, ex := getPasswordHash(passwd)
+	hashPassword, ex := getPasswordHash(passwd, cost)
 	if ex != nil {
 		return nil, ex
 	}
@@ -111,10 +501,8 @@ func new(name, passwd string) (*UserEntity, *shared.Exception) {
 	return &user, nil
 }
 
-// Get password hash
-func getPasswordHash(password string) (string, *shared.Exception) {
-	cost := bcrypt.DefaultCost
-
+// Get password hash, costs below bcrypt.MinCost use bcrypt.DefaultCost
+func getPasswordHash(password string, cost int) (string, *shared.Exception) {
 	if hashByte, err := bcrypt.GenerateFromPassword([]byte(password), cost); err == nil {
 		return string(hashByte), nil
 	}
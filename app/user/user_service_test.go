@@ -1,19 +1,23 @@
 package user
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"msim/app/shared"
 	"msim/db"
 )
 
 // Test register.
 func TestRegister(t *testing.T) {
 	t.Run("Should register an user", func(t *testing.T) {
-		service, DB := CreateUserService()
+		service, DB := CreateUserService(t)
 		result, err := service.Register(&UserAuthDTO{"Test", "passwd"})
 
 		if err != nil {
@@ -29,7 +33,7 @@ func TestRegister(t *testing.T) {
 	})
 
 	t.Run("Should not register an user when already exists", func(t *testing.T) {
-		service, DB := CreateUserService()
+		service, DB := CreateUserService(t)
 
 		DB.Create(&User{Name: "Test", Password: "12345"})
 		result, err := service.Register(&UserAuthDTO{"Test", "passwd"})
@@ -38,16 +42,52 @@ func TestRegister(t *testing.T) {
 			t.Fatal("Should not create an user")
 		}
 
+		if !errors.Is(err, shared.ErrAlreadyCreated) || err.Cause == nil {
+			t.Fatal("Should throw an already created exception with its cause")
+		}
+
 		if result != nil {
 			t.Fatal("Result should be nil")
 		}
 	})
 }
 
+// Test register against the password policy.
+func TestRegisterPasswordPolicy(t *testing.T) {
+	t.Run("Should report every violated rule at once", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		service.passwordPolicy = &PasswordPolicy{MinLength: 8, MaxLength: MaxPasswordBytes, Require: []CharacterClass{DigitClass}, RejectName: true}
+
+		_, ex := service.Register(&UserAuthDTO{"Te", "test"})
+		if ex == nil {
+			t.Fatal("Should not register an user")
+		}
+
+		if !errors.Is(ex, shared.ErrMinLength) || ex.Field != "password" || len(ex.Errors) != 3 {
+			t.Fatalf("Expected min length, digit and name exceptions, got %v", ex.Errors)
+		}
+
+		if last := ex.Errors[2]; last.Tag != shared.MIN_LENGTH_EX || last.Field != "name" {
+			t.Fatal("Should report the short name last")
+		}
+	})
+
+	t.Run("Should check new passwords against the policy", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		registered, _ := service.Register(&UserAuthDTO{"Test", "passwd"})
+		service.passwordPolicy = &PasswordPolicy{MinLength: 3, MaxLength: MaxPasswordBytes, RejectName: true}
+
+		ex := service.ChangePassword(registered, &UserPasswordDTO{"passwd", "my-test-pw"})
+		if !errors.Is(ex, ErrPasswordName) || ex.Field != "new_password" {
+			t.Fatalf("Expected a password name exception on new_password, got %v", ex)
+		}
+	})
+}
+
 // Test login.
 func TestLogin(t *testing.T) {
 	t.Run("Should login an user when exists and password match", func(t *testing.T) {
-		service, DB := CreateUserService()
+		service, DB := CreateUserService(t)
 
 		cost := bcrypt.DefaultCost
 		bytePassword := []byte("passwd")
@@ -62,13 +102,13 @@ func TestLogin(t *testing.T) {
 			t.Fatal(ex)
 		}
 
-		if result == uuid.Nil {
+		if result == nil || result.Code == "" || result.RefreshToken == uuid.Nil {
 			t.Fatal("Should return a code")
 		}
 	})
 
 	t.Run("Should not login an user when password doesnt match", func(t *testing.T) {
-		service, DB := CreateUserService()
+		service, DB := CreateUserService(t)
 
 		cost := bcrypt.DefaultCost
 		bytePassword := []byte("passwd")
@@ -83,20 +123,20 @@ func TestLogin(t *testing.T) {
 			t.Fatal(ex)
 		}
 
-		if result != uuid.Nil {
+		if result != nil {
 			t.Fatal("Should return a code")
 		}
 	})
 
 	t.Run("Should not login an user when doesnt exists", func(t *testing.T) {
-		service, _ := CreateUserService()
+		service, _ := CreateUserService(t)
 		result, err := service.Login(&UserAuthDTO{"Test", "passwd"})
 
 		if err == nil {
 			t.Fatal(err)
 		}
 
-		if result != uuid.Nil {
+		if result != nil {
 			t.Fatal("Should return a code")
 		}
 	})
@@ -105,7 +145,7 @@ func TestLogin(t *testing.T) {
 // Test GetAuthUser.
 func TestGetAuthUserService(t *testing.T) {
 	t.Run("Should get auth user when theres one", func(t *testing.T) {
-		service, DB := CreateUserService()
+		service, DB := CreateUserService(t)
 
 		createdUser := User{ID: uuid.New(), Name: "test15", Password: "12345"}
 		DB.Create(&createdUser)
@@ -113,7 +153,7 @@ func TestGetAuthUserService(t *testing.T) {
 		createdAuth := Auth{Code: uuid.New(), User: createdUser}
 		DB.Create(&createdAuth)
 
-		result, _ := service.GetAuthUser(&AuthDTO{createdAuth.Code})
+		result, _ := service.GetAuthUser(&AuthDTO{createdAuth.Code.String()})
 
 		resultType := reflect.TypeOf(result)
 		expectedType := reflect.TypeOf((*UserEntity)(nil))
@@ -125,8 +165,8 @@ func TestGetAuthUserService(t *testing.T) {
 	})
 
 	t.Run("Should not get auth user when doesnt have one", func(t *testing.T) {
-		service, _ := CreateUserService()
-		result, err := service.GetAuthUser(&AuthDTO{uuid.New()})
+		service, _ := CreateUserService(t)
+		result, err := service.GetAuthUser(&AuthDTO{uuid.NewString()})
 
 		if err == nil {
 			t.Fatal("Should throw error")
@@ -138,9 +178,415 @@ func TestGetAuthUserService(t *testing.T) {
 	})
 }
 
+// Test refresh.
+func TestRefresh(t *testing.T) {
+	t.Run("Should rotate the refresh token", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		service.Register(&UserAuthDTO{"Test", "passwd"})
+		pair, _ := service.Login(&UserAuthDTO{"Test", "passwd"})
+
+		result, ex := service.Refresh(&RefreshDTO{pair.RefreshToken})
+		if ex != nil {
+			t.Fatal(ex)
+		}
+
+		if result.RefreshToken == pair.RefreshToken || result.Code == pair.Code {
+			t.Fatal("Should return a new code and refresh token")
+		}
+
+		user, ex := service.GetAuthUser(&AuthDTO{result.Code})
+		if ex != nil {
+			t.Fatal(ex)
+		}
+
+		if user.Name != "Test" {
+			t.Fatal("New code should authenticate the same user")
+		}
+	})
+
+	t.Run("Should revoke the token family when a refresh token is reused", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		service.Register(&UserAuthDTO{"Test", "passwd"})
+		pair, _ := service.Login(&UserAuthDTO{"Test", "passwd"})
+		rotated, _ := service.Refresh(&RefreshDTO{pair.RefreshToken})
+
+		_, ex := service.Refresh(&RefreshDTO{pair.RefreshToken})
+		if !errors.Is(ex, ErrTokenReused) {
+			t.Fatalf("Should throw a token reused exception, got %v", ex)
+		}
+
+		if _, ex := service.GetAuthUser(&AuthDTO{rotated.Code}); ex == nil {
+			t.Fatal("Should revoke codes issued from the reused token")
+		}
+
+		if _, ex := service.Refresh(&RefreshDTO{rotated.RefreshToken}); ex == nil {
+			t.Fatal("Should revoke refresh tokens issued from the reused token")
+		}
+	})
+
+	t.Run("Should not refresh with an unknown token", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+
+		if _, ex := service.Refresh(&RefreshDTO{uuid.New()}); !errors.Is(ex, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+	})
+
+	t.Run("Should not authenticate with a refresh token", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		service.Register(&UserAuthDTO{"Test", "passwd"})
+		pair, _ := service.Login(&UserAuthDTO{"Test", "passwd"})
+
+		if _, ex := service.GetAuthUser(&AuthDTO{pair.RefreshToken.String()}); ex == nil {
+			t.Fatal("Should only authenticate access codes")
+		}
+	})
+}
+
+// Test logout.
+func TestLogout(t *testing.T) {
+	t.Run("Should revoke the authentication code", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		service.Register(&UserAuthDTO{"Test", "passwd"})
+		pair, _ := service.Login(&UserAuthDTO{"Test", "passwd"})
+
+		if ex := service.Logout(&AuthDTO{pair.Code}); ex != nil {
+			t.Fatal(ex)
+		}
+
+		if _, ex := service.GetAuthUser(&AuthDTO{pair.Code}); ex == nil {
+			t.Fatal("Should not authenticate a revoked code")
+		}
+
+		if _, ex := service.Refresh(&RefreshDTO{pair.RefreshToken}); ex == nil {
+			t.Fatal("Should not refresh a revoked session")
+		}
+	})
+
+	t.Run("Should not logout an unknown code", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+
+		if ex := service.Logout(&AuthDTO{uuid.NewString()}); !errors.Is(ex, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+	})
+
+	t.Run("Should revoke every authentication code of the user", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		service.Register(&UserAuthDTO{"Test", "passwd"})
+		first, _ := service.Login(&UserAuthDTO{"Test", "passwd"})
+		second, _ := service.Login(&UserAuthDTO{"Test", "passwd"})
+
+		if ex := service.LogoutAll(&AuthDTO{first.Code}); ex != nil {
+			t.Fatal(ex)
+		}
+
+		for _, code := range []string{first.Code, second.Code} {
+			if _, ex := service.GetAuthUser(&AuthDTO{code}); ex == nil {
+				t.Fatal("Should not authenticate a revoked code")
+			}
+		}
+	})
+}
+
+// Test SetRole.
+func TestSetRole(t *testing.T) {
+	t.Run("Should set role when actor manages users", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		service.Register(&UserAuthDTO{"Test", "passwd"})
+		pair, _ := service.Login(&UserAuthDTO{"Test", "passwd"})
+
+		admin := &UserEntity{ID: uuid.New(), Name: "admin", Role: AdminRole}
+		result, ex := service.SetRole(admin, &UserRoleDTO{"Test", OperatorRole})
+		if ex != nil {
+			t.Fatal(ex)
+		}
+
+		if result.Role != OperatorRole {
+			t.Fatalf("Expected role %s, got %s", OperatorRole, result.Role)
+		}
+
+		if _, ex := service.GetAuthUser(&AuthDTO{pair.Code}); ex == nil {
+			t.Fatal("Should revoke codes issued with the previous role")
+		}
+	})
+
+	t.Run("Should not set role when actor can't manage users", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		registered, _ := service.Register(&UserAuthDTO{"Test", "passwd"})
+
+		if _, ex := service.SetRole(registered, &UserRoleDTO{"Test", AdminRole}); !errors.Is(ex, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+	})
+
+	t.Run("Should not set an unknown role", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		service.Register(&UserAuthDTO{"Test", "passwd"})
+
+		if _, ex := service.AssignRole(&UserRoleDTO{"Test", "root"}); ex == nil || ex.Field != "role" {
+			t.Fatal("Should throw a role exception")
+		}
+	})
+
+	t.Run("Should not set role of an unknown user", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+
+		if _, ex := service.AssignRole(&UserRoleDTO{"Test", AdminRole}); !errors.Is(ex, shared.ErrNotFound) {
+			t.Fatal("Should throw a not found exception")
+		}
+	})
+}
+
+// Test Delete, Restore and Purge.
+func TestDeleteUser(t *testing.T) {
+	admin := &UserEntity{ID: uuid.New(), Name: "admin", Role: AdminRole}
+
+	t.Run("Should delete an user and revoke its codes", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		service.Register(&UserAuthDTO{"Test", "passwd"})
+		pair, _ := service.Login(&UserAuthDTO{"Test", "passwd"})
+
+		if _, ex := service.Delete(admin, &UserNameDTO{"Test"}); ex != nil {
+			t.Fatal(ex)
+		}
+
+		if _, ex := service.GetAuthUser(&AuthDTO{pair.Code}); ex == nil {
+			t.Fatal("Should revoke codes of the deleted user")
+		}
+
+		if _, ex := service.Login(&UserAuthDTO{"Test", "passwd"}); ex == nil {
+			t.Fatal("Should not login a deleted user")
+		}
+
+		if _, ex := service.Register(&UserAuthDTO{"Test", "passwd"}); ex != nil {
+			t.Fatal("Should register the name of a deleted user again")
+		}
+	})
+
+	t.Run("Should not delete when actor can't manage users", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		registered, _ := service.Register(&UserAuthDTO{"Test", "passwd"})
+
+		if _, ex := service.Delete(registered, &UserNameDTO{"Test"}); !errors.Is(ex, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+	})
+
+	t.Run("Should restore a deleted user unless its name is taken", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		service.Register(&UserAuthDTO{"Test", "passwd"})
+		service.Delete(admin, &UserNameDTO{"Test"})
+
+		if _, ex := service.Restore(admin, &UserNameDTO{"Test"}); ex != nil {
+			t.Fatal(ex)
+		}
+
+		if _, ex := service.Login(&UserAuthDTO{"Test", "passwd"}); ex != nil {
+			t.Fatal("Should login a restored user")
+		}
+
+		service.Delete(admin, &UserNameDTO{"Test"})
+		service.Register(&UserAuthDTO{"Test", "other"})
+
+		if _, ex := service.Restore(admin, &UserNameDTO{"Test"}); !errors.Is(ex, shared.ErrAlreadyCreated) {
+			t.Fatal("Should throw an already created exception")
+		}
+	})
+
+	t.Run("Should purge an user", func(t *testing.T) {
+		service, DB := CreateUserService(t)
+		service.Register(&UserAuthDTO{"Test", "passwd"})
+		service.Login(&UserAuthDTO{"Test", "passwd"})
+
+		if ex := service.Purge(admin, &UserNameDTO{"Test"}); ex != nil {
+			t.Fatal(ex)
+		}
+
+		var count int64
+		DB.Unscoped().Model(&User{}).Where("name = ?", "Test").Count(&count)
+		if count != 0 {
+			t.Fatal("Should permanently delete the user")
+		}
+	})
+}
+
+// Test ChangePassword, Rename and DeleteAccount.
+func TestAccountService(t *testing.T) {
+	t.Run("Should change the password and revoke codes", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		registered, _ := service.Register(&UserAuthDTO{"Test", "passwd"})
+		pair, _ := service.Login(&UserAuthDTO{"Test", "passwd"})
+
+		if ex := service.ChangePassword(registered, &UserPasswordDTO{"passwd", "secret"}); ex != nil {
+			t.Fatal(ex)
+		}
+
+		if _, ex := service.GetAuthUser(&AuthDTO{pair.Code}); ex == nil {
+			t.Fatal("Should revoke codes issued before the change")
+		}
+
+		if _, ex := service.Login(&UserAuthDTO{"Test", "passwd"}); ex == nil {
+			t.Fatal("Should not login with the old password")
+		}
+
+		if _, ex := service.Login(&UserAuthDTO{"Test", "secret"}); ex != nil {
+			t.Fatal("Should login with the new password")
+		}
+	})
+
+	t.Run("Should not change the password without the current one", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		registered, _ := service.Register(&UserAuthDTO{"Test", "passwd"})
+
+		ex := service.ChangePassword(registered, &UserPasswordDTO{"wrong", "secret"})
+		if !errors.Is(ex, shared.ErrUnauthorized) || ex.Field != "password" {
+			t.Fatal("Should throw an unauthorized exception on password")
+		}
+
+		ex = service.ChangePassword(registered, &UserPasswordDTO{"passwd", "s"})
+		if ex == nil || ex.Tag != shared.MIN_LENGTH_EX || ex.Field != "new_password" {
+			t.Fatal("Should throw a min length exception on new_password")
+		}
+	})
+
+	t.Run("Should rename and revoke codes", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		registered, _ := service.Register(&UserAuthDTO{"Test", "passwd"})
+		pair, _ := service.Login(&UserAuthDTO{"Test", "passwd"})
+
+		result, ex := service.Rename(registered, &UserNameDTO{"Renamed"})
+		if ex != nil {
+			t.Fatal(ex)
+		}
+
+		if result.Name != "Renamed" {
+			t.Fatal("Should return the renamed user")
+		}
+
+		if _, ex := service.GetAuthUser(&AuthDTO{pair.Code}); ex == nil {
+			t.Fatal("Should revoke codes issued before the rename")
+		}
+
+		if _, ex := service.Login(&UserAuthDTO{"Renamed", "passwd"}); ex != nil {
+			t.Fatal("Should login with the new name")
+		}
+	})
+
+	t.Run("Should not rename to a taken or short name", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		registered, _ := service.Register(&UserAuthDTO{"Test", "passwd"})
+		service.Register(&UserAuthDTO{"Taken", "passwd"})
+
+		if _, ex := service.Rename(registered, &UserNameDTO{"Taken"}); ex == nil || ex.Tag != shared.ALREADY_CREATED_EX {
+			t.Fatal("Should throw an already created exception")
+		}
+
+		if _, ex := service.Rename(registered, &UserNameDTO{"T"}); ex == nil || ex.Tag != shared.MIN_LENGTH_EX {
+			t.Fatal("Should throw a min length exception")
+		}
+	})
+
+	t.Run("Should delete the account with its codes", func(t *testing.T) {
+		service, DB := CreateUserService(t)
+		registered, _ := service.Register(&UserAuthDTO{"Test", "passwd"})
+		pair, _ := service.Login(&UserAuthDTO{"Test", "passwd"})
+
+		if ex := service.DeleteAccount(registered, &UserConfirmDTO{"wrong"}); !errors.Is(ex, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+
+		if ex := service.DeleteAccount(registered, &UserConfirmDTO{"passwd"}); ex != nil {
+			t.Fatal(ex)
+		}
+
+		if _, ex := service.GetAuthUser(&AuthDTO{pair.Code}); ex == nil {
+			t.Fatal("Should revoke codes of the deleted account")
+		}
+
+		var codes int64
+		DB.Unscoped().Model(&Auth{}).Count(&codes)
+		if codes != 0 {
+			t.Fatalf("Expected no code left, got %d", codes)
+		}
+
+		if _, ex := service.Register(&UserAuthDTO{"Test", "passwd"}); ex != nil {
+			t.Fatal("Should register the name of a deleted account again")
+		}
+	})
+}
+
+// Test List.
+func TestListUsers(t *testing.T) {
+	admin := &UserEntity{ID: uuid.New(), Name: "admin", Role: AdminRole}
+
+	t.Run("Should list users a page at a time", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		for _, name := range []string{"alice", "bob", "carol"} {
+			service.Register(&UserAuthDTO{name, "passwd"})
+		}
+
+		result, ex := service.List(admin, &UserListDTO{Page: db.PageQuery{Limit: 2, Sort: "name", Total: true}})
+		if ex != nil {
+			t.Fatal(ex)
+		}
+
+		if len(result.Items) != 2 || result.NextCursor == "" || *result.Total != 3 {
+			t.Fatal("Should return 2 users, a cursor and the total")
+		}
+	})
+
+	t.Run("Should not list when actor can't manage users", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+		registered, _ := service.Register(&UserAuthDTO{"Test", "passwd"})
+
+		if _, ex := service.List(registered, &UserListDTO{}); !errors.Is(ex, shared.ErrUnauthorized) {
+			t.Fatal("Should throw an unauthorized exception")
+		}
+	})
+
+	t.Run("Should not list on an unknown sort", func(t *testing.T) {
+		service, _ := CreateUserService(t)
+
+		_, ex := service.List(admin, &UserListDTO{Page: db.PageQuery{Sort: "password"}})
+		if !errors.Is(ex, shared.ErrApplication) || ex.Field != "sort" {
+			t.Fatal("Should throw an application exception on sort")
+		}
+	})
+}
+
+// Test SweepExpired.
+func TestSweepExpired(t *testing.T) {
+	t.Run("Should delete expired codes until cancelled", func(t *testing.T) {
+		service, DB := CreateUserService(t)
+
+		createdUser := User{ID: uuid.New(), Name: "test1", Password: "12345"}
+		DB.Create(&createdUser)
+
+		expired := Auth{ID: uuid.New(), Code: uuid.New(), UserID: createdUser.ID}
+		expired.CreatedAt = time.Now().Add(-time.Hour)
+		DB.Create(&expired)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		service.SweepExpired(ctx, 10*time.Millisecond)
+
+		var count int64
+		DB.Unscoped().Model(&Auth{}).Count(&count)
+
+		if count != 0 {
+			t.Fatalf("Expected expired codes to be deleted, %d left", count)
+		}
+	})
+}
+
 // Create service and test database.
-func CreateUserService() (*UserService, *gorm.DB) {
-	DB, _ := db.InMemoryDB()
+func CreateUserService(t *testing.T) (*UserService, *gorm.DB) {
+	DB, cleanup, err := db.TestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
 
 	Drop(DB)
 	Migrate(DB)
@@ -0,0 +1,381 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Variable holding the configuration file path.
+const ConfigVariable = "MSIM_CONFIG"
+
+// Access code strategies.
+const (
+	CodeStrategy = "code"
+	JWTStrategy  = "jwt"
+)
+
+// Lowest and highest bcrypt costs accepted.
+const (
+	minBcryptCost = 4
+	maxBcryptCost = 31
+)
+
+// Longest password bcrypt hashes, in bytes.
+const maxPasswordLength = 72
+
+// Character classes passwords may be required to hold.
+var passwordClasses = []string{"lower", "upper", "digit", "symbol"}
+
+type Config struct {
+	Environment Environment    `json:"environment" yaml:"environment" toml:"environment"`
+	Storage     StorageConfig  `json:"storage" yaml:"storage" toml:"storage"`
+	Database    DatabaseConfig `json:"database" yaml:"database" toml:"database"`
+	Auth        AuthConfig     `json:"auth" yaml:"auth" toml:"auth"`
+	Server      ServerConfig   `json:"server" yaml:"server" toml:"server"`
+	System      SystemConfig   `json:"system" yaml:"system" toml:"system"`
+}
+
+type StorageConfig struct {
+	Folder   string `json:"folder" yaml:"folder" toml:"folder"`
+	Filename string `json:"filename" yaml:"filename" toml:"filename"`
+}
+
+type DatabaseConfig struct {
+	URL string `json:"url" yaml:"url" toml:"url"`
+}
+
+type AuthConfig struct {
+	TokenLifetime     Duration       `json:"token_lifetime" yaml:"token_lifetime" toml:"token_lifetime"`
+	SlidingExpiration bool           `json:"sliding_expiration" yaml:"sliding_expiration" toml:"sliding_expiration"`
+	SweepInterval     Duration       `json:"sweep_interval" yaml:"sweep_interval" toml:"sweep_interval"`
+	RefreshLifetime   Duration       `json:"refresh_lifetime" yaml:"refresh_lifetime" toml:"refresh_lifetime"`
+	BcryptCost        int            `json:"bcrypt_cost" yaml:"bcrypt_cost" toml:"bcrypt_cost"`
+	Strategy          string         `json:"strategy" yaml:"strategy" toml:"strategy"`
+	JWT               JWTConfig      `json:"jwt" yaml:"jwt" toml:"jwt"`
+	Password          PasswordConfig `json:"password" yaml:"password" toml:"password"`
+}
+
+type JWTConfig struct {
+	KeysDir    string `json:"keys_dir" yaml:"keys_dir" toml:"keys_dir"`
+	SigningKey string `json:"signing_key" yaml:"signing_key" toml:"signing_key"`
+	Strict     bool   `json:"strict" yaml:"strict" toml:"strict"`
+}
+
+type PasswordConfig struct {
+	MinLength  int      `json:"min_length" yaml:"min_length" toml:"min_length"`
+	MaxLength  int      `json:"max_length" yaml:"max_length" toml:"max_length"`
+	Require    []string `json:"require" yaml:"require" toml:"require"`
+	RejectName bool     `json:"reject_name" yaml:"reject_name" toml:"reject_name"`
+	CommonList string   `json:"common_list" yaml:"common_list" toml:"common_list"`
+}
+
+type SystemConfig struct {
+	CacheTTL Duration      `json:"cache_ttl" yaml:"cache_ttl" toml:"cache_ttl"`
+	Secrets  SecretsConfig `json:"secrets" yaml:"secrets" toml:"secrets"`
+}
+
+type SecretsConfig struct {
+	KeysDir   string `json:"keys_dir" yaml:"keys_dir" toml:"keys_dir"`
+	MasterKey string `json:"master_key" yaml:"master_key" toml:"master_key"`
+}
+
+type ServerConfig struct {
+	Addr        string `json:"addr" yaml:"addr" toml:"addr"`
+	ImportLimit int64  `json:"import_limit" yaml:"import_limit" toml:"import_limit"`
+}
+
+// Duration decoded from strings like "20m" or "1h30m".
+type Duration struct {
+	time.Duration
+}
+
+// Parse duration from text.
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	d.Duration = duration
+	return nil
+}
+
+// Format duration as text.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Get default configuration.
+func Default() *Config {
+	return &Config{
+		Environment: Local,
+		Storage:     StorageConfig{Folder: "storage", Filename: "db.sqlite"},
+		Auth: AuthConfig{
+			TokenLifetime:   Duration{20 * time.Minute},
+			SweepInterval:   Duration{10 * time.Minute},
+			RefreshLifetime: Duration{30 * 24 * time.Hour},
+			BcryptCost:      10,
+			Strategy:        CodeStrategy,
+			Password:        PasswordConfig{MinLength: 3, MaxLength: maxPasswordLength, RejectName: true},
+		},
+		Server: ServerConfig{Addr: ":8080", ImportLimit: 10 << 20},
+	}
+}
+
+// Load configuration from file at path (JSON, YAML or TOML by extension),
+// apply MSIM_* variable overrides and validate it.
+// An empty path loads the defaults, the path defaults to MSIM_CONFIG.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path == "" {
+		path = os.Getenv(ConfigVariable)
+	}
+
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate configuration, reporting every invalid field.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if !c.Environment.Valid() {
+		errs = append(errs, fmt.Errorf("environment must be one of %s, %s or %s, got %q", Local, Server, Test, c.Environment))
+	}
+
+	if c.Storage.Folder == "" {
+		errs = append(errs, errors.New("storage.folder must not be empty"))
+	}
+
+	if c.Storage.Filename == "" {
+		errs = append(errs, errors.New("storage.filename must not be empty"))
+	}
+
+	if c.Environment == Server && c.Database.URL == "" {
+		errs = append(errs, fmt.Errorf("database.url must be set in %s environment", Server))
+	}
+
+	if c.Auth.TokenLifetime.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("auth.token_lifetime must be positive, got %s", c.Auth.TokenLifetime))
+	}
+
+	if c.Auth.RefreshLifetime.Duration <= c.Auth.TokenLifetime.Duration {
+		errs = append(errs, fmt.Errorf("auth.refresh_lifetime must be longer than auth.token_lifetime, got %s", c.Auth.RefreshLifetime))
+	}
+
+	if c.Auth.SweepInterval.Duration < 0 {
+		errs = append(errs, fmt.Errorf("auth.sweep_interval must not be negative, got %s", c.Auth.SweepInterval))
+	}
+
+	if c.Auth.BcryptCost < minBcryptCost || c.Auth.BcryptCost > maxBcryptCost {
+		errs = append(errs, fmt.Errorf("auth.bcrypt_cost must be between %d and %d, got %d", minBcryptCost, maxBcryptCost, c.Auth.BcryptCost))
+	}
+
+	if c.Auth.Strategy != CodeStrategy && c.Auth.Strategy != JWTStrategy {
+		errs = append(errs, fmt.Errorf("auth.strategy must be %s or %s, got %q", CodeStrategy, JWTStrategy, c.Auth.Strategy))
+	}
+
+	if c.Auth.Strategy == JWTStrategy && (c.Auth.JWT.KeysDir == "" || c.Auth.JWT.SigningKey == "") {
+		errs = append(errs, fmt.Errorf("auth.jwt.keys_dir and auth.jwt.signing_key must be set with %s strategy", JWTStrategy))
+	}
+
+	if c.Auth.Password.MinLength < 1 {
+		errs = append(errs, fmt.Errorf("auth.password.min_length must be positive, got %d", c.Auth.Password.MinLength))
+	}
+
+	if c.Auth.Password.MaxLength < c.Auth.Password.MinLength || c.Auth.Password.MaxLength > maxPasswordLength {
+		errs = append(errs, fmt.Errorf("auth.password.max_length must be between min_length and %d, got %d", maxPasswordLength, c.Auth.Password.MaxLength))
+	}
+
+	for _, class := range c.Auth.Password.Require {
+		if !slices.Contains(passwordClasses, class) {
+			errs = append(errs, fmt.Errorf("auth.password.require must hold %s, got %q", strings.Join(passwordClasses, ", "), class))
+		}
+	}
+
+	if c.System.CacheTTL.Duration < 0 {
+		errs = append(errs, fmt.Errorf("system.cache_ttl must not be negative, got %s", c.System.CacheTTL))
+	}
+
+	if (c.System.Secrets.KeysDir == "") != (c.System.Secrets.MasterKey == "") {
+		errs = append(errs, errors.New("system.secrets.keys_dir and system.secrets.master_key must be set together"))
+	}
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr must not be empty"))
+	}
+
+	if c.Server.ImportLimit <= 0 {
+		errs = append(errs, fmt.Errorf("server.import_limit must be positive, got %d", c.Server.ImportLimit))
+	}
+
+	return errors.Join(errs...)
+}
+
+// PRIVATE:
+
+// Decode configuration file over current values.
+func (c *Config) readFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("can't read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(content, c)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, c)
+	case ".toml":
+		err = toml.Unmarshal(content, c)
+	default:
+		return fmt.Errorf("unsupported config file format %q", filepath.Ext(path))
+	}
+
+	if err != nil {
+		return fmt.Errorf("can't parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Override values with MSIM_* environment variables.
+func (c *Config) applyEnv() error {
+	overrides := map[string]*string{
+		"MSIM_STORAGE_FOLDER":       &c.Storage.Folder,
+		"MSIM_STORAGE_FILENAME":     &c.Storage.Filename,
+		DatabaseVariable:            &c.Database.URL,
+		"MSIM_ADDR":                 &c.Server.Addr,
+		"MSIM_TOKEN_STRATEGY":       &c.Auth.Strategy,
+		"MSIM_JWT_KEYS_DIR":         &c.Auth.JWT.KeysDir,
+		"MSIM_JWT_SIGNING_KEY":      &c.Auth.JWT.SigningKey,
+		"MSIM_SECRETS_KEYS_DIR":     &c.System.Secrets.KeysDir,
+		"MSIM_SECRETS_MASTER_KEY":   &c.System.Secrets.MasterKey,
+		"MSIM_PASSWORD_COMMON_LIST": &c.Auth.Password.CommonList,
+	}
+
+	for name, field := range overrides {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	if value := os.Getenv(EnvironmentVariable); value != "" {
+		c.Environment = Environment(value)
+	}
+
+	if value, ok := os.LookupEnv("MSIM_TOKEN_LIFETIME"); ok {
+		if err := c.Auth.TokenLifetime.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("MSIM_TOKEN_LIFETIME must be a duration like 20m: %w", err)
+		}
+	}
+
+	if value, ok := os.LookupEnv("MSIM_SLIDING_EXPIRATION"); ok {
+		sliding, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("MSIM_SLIDING_EXPIRATION must be a boolean, got %q", value)
+		}
+		c.Auth.SlidingExpiration = sliding
+	}
+
+	if value, ok := os.LookupEnv("MSIM_JWT_STRICT"); ok {
+		strict, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("MSIM_JWT_STRICT must be a boolean, got %q", value)
+		}
+		c.Auth.JWT.Strict = strict
+	}
+
+	if value, ok := os.LookupEnv("MSIM_REFRESH_LIFETIME"); ok {
+		if err := c.Auth.RefreshLifetime.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("MSIM_REFRESH_LIFETIME must be a duration like 720h: %w", err)
+		}
+	}
+
+	if value, ok := os.LookupEnv("MSIM_SWEEP_INTERVAL"); ok {
+		if err := c.Auth.SweepInterval.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("MSIM_SWEEP_INTERVAL must be a duration like 10m: %w", err)
+		}
+	}
+
+	if value, ok := os.LookupEnv("MSIM_CACHE_TTL"); ok {
+		if err := c.System.CacheTTL.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("MSIM_CACHE_TTL must be a duration like 5s: %w", err)
+		}
+	}
+
+	if value, ok := os.LookupEnv("MSIM_BCRYPT_COST"); ok {
+		cost, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("MSIM_BCRYPT_COST must be an integer, got %q", value)
+		}
+		c.Auth.BcryptCost = cost
+	}
+
+	if value, ok := os.LookupEnv("MSIM_PASSWORD_MIN_LENGTH"); ok {
+		length, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("MSIM_PASSWORD_MIN_LENGTH must be an integer, got %q", value)
+		}
+		c.Auth.Password.MinLength = length
+	}
+
+	if value, ok := os.LookupEnv("MSIM_PASSWORD_MAX_LENGTH"); ok {
+		length, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("MSIM_PASSWORD_MAX_LENGTH must be an integer, got %q", value)
+		}
+		c.Auth.Password.MaxLength = length
+	}
+
+	if value, ok := os.LookupEnv("MSIM_PASSWORD_REJECT_NAME"); ok {
+		reject, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("MSIM_PASSWORD_REJECT_NAME must be a boolean, got %q", value)
+		}
+		c.Auth.Password.RejectName = reject
+	}
+
+	if value, ok := os.LookupEnv("MSIM_IMPORT_LIMIT"); ok {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("MSIM_IMPORT_LIMIT must be an integer, got %q", value)
+		}
+		c.Server.ImportLimit = limit
+	}
+
+	if value, ok := os.LookupEnv("MSIM_PASSWORD_REQUIRE"); ok {
+		c.Auth.Password.Require = nil
+		for _, class := range strings.Split(value, ",") {
+			if class = strings.TrimSpace(class); class != "" {
+				c.Auth.Password.Require = append(c.Auth.Password.Require, class)
+			}
+		}
+	}
+
+	return nil
+}
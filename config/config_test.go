@@ -0,0 +1,308 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test Load
+func TestLoad(t *testing.T) {
+	t.Run("Should load defaults without a file", func(t *testing.T) {
+		t.Setenv(ConfigVariable, "")
+
+		result, err := Load("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(result, Default()) {
+			t.Fatal("Load() must return the default configuration")
+		}
+	})
+
+	files := map[string]string{
+		"config.json": `{"storage": {"folder": "data"}, "auth": {"token_lifetime": "1h", "bcrypt_cost": 12}}`,
+		"config.yaml": "storage:\n  folder: data\nauth:\n  token_lifetime: 1h\n  bcrypt_cost: 12\n",
+		"config.toml": "[storage]\nfolder = \"data\"\n[auth]\ntoken_lifetime = \"1h\"\nbcrypt_cost = 12\n",
+	}
+
+	for name, content := range files {
+		t.Run("Should load "+filepath.Ext(name)+" file", func(t *testing.T) {
+			path := writeConfig(t, name, content)
+
+			result, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Storage.Folder != "data" || result.Storage.Filename != "db.sqlite" {
+				t.Fatalf("Load() returns storage %+v, expects file values over defaults", result.Storage)
+			}
+
+			if result.Auth.TokenLifetime.Duration != time.Hour || result.Auth.BcryptCost != 12 {
+				t.Fatalf("Load() returns auth %+v, expects file values", result.Auth)
+			}
+		})
+	}
+
+	t.Run("Should override file values with environment variables", func(t *testing.T) {
+		path := writeConfig(t, "config.json", `{"auth": {"bcrypt_cost": 12}}`)
+		t.Setenv("MSIM_BCRYPT_COST", "5")
+		t.Setenv("MSIM_TOKEN_LIFETIME", "5m")
+		t.Setenv("MSIM_STORAGE_FILENAME", "other.sqlite")
+		t.Setenv("MSIM_CACHE_TTL", "5s")
+
+		result, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Auth.BcryptCost != 5 || result.Auth.TokenLifetime.Duration != 5*time.Minute {
+			t.Fatalf("Load() returns auth %+v, expects overridden values", result.Auth)
+		}
+
+		if result.Storage.Filename != "other.sqlite" {
+			t.Fatalf("Load() returns filename %s, expects other.sqlite", result.Storage.Filename)
+		}
+
+		if result.System.CacheTTL.Duration != 5*time.Second {
+			t.Fatalf("Load() returns cache ttl %s, expects 5s", result.System.CacheTTL)
+		}
+	})
+
+	t.Run("Should override the password policy with environment variables", func(t *testing.T) {
+		t.Setenv(ConfigVariable, "")
+		t.Setenv("MSIM_PASSWORD_MIN_LENGTH", "12")
+		t.Setenv("MSIM_PASSWORD_MAX_LENGTH", "64")
+		t.Setenv("MSIM_PASSWORD_REQUIRE", "upper, digit")
+		t.Setenv("MSIM_PASSWORD_REJECT_NAME", "false")
+		t.Setenv("MSIM_PASSWORD_COMMON_LIST", "common.txt")
+
+		result, err := Load("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := PasswordConfig{MinLength: 12, MaxLength: 64, Require: []string{"upper", "digit"}, RejectName: false, CommonList: "common.txt"}
+		if !reflect.DeepEqual(result.Auth.Password, expected) {
+			t.Fatalf("Load() returns password policy %+v, expects %+v", result.Auth.Password, expected)
+		}
+	})
+
+	t.Run("Should read file path from MSIM_CONFIG", func(t *testing.T) {
+		t.Setenv(ConfigVariable, writeConfig(t, "config.yaml", "server:\n  addr: \":9090\"\n"))
+
+		result, err := Load("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Server.Addr != ":9090" {
+			t.Fatalf("Load() returns addr %s, expects :9090", result.Server.Addr)
+		}
+	})
+
+	t.Run("Should return error on unsupported file format", func(t *testing.T) {
+		if _, err := Load(writeConfig(t, "config.ini", "")); err == nil {
+			t.Fatal("Load() expects error on unsupported format")
+		}
+	})
+
+	t.Run("Should return error on invalid values", func(t *testing.T) {
+		path := writeConfig(t, "config.json", `{"environment": "server", "auth": {"bcrypt_cost": 2}}`)
+
+		if _, err := Load(path); err == nil {
+			t.Fatal("Load() expects validation error")
+		}
+	})
+
+	t.Run("Should return error on malformed override", func(t *testing.T) {
+		t.Setenv("MSIM_TOKEN_LIFETIME", "twenty")
+
+		if _, err := Load(""); err == nil {
+			t.Fatal("Load() expects error on malformed duration")
+		}
+	})
+}
+
+// Test Validate
+func TestValidate(t *testing.T) {
+	t.Run("Should accept the default configuration", func(t *testing.T) {
+		if err := Default().Validate(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Should report every invalid field", func(t *testing.T) {
+		cfg := Default()
+		cfg.Environment = Server
+		cfg.Storage.Folder = ""
+		cfg.Auth.BcryptCost = 99
+
+		err := cfg.Validate()
+		if err == nil {
+			t.Fatal("Validate() expects error")
+		}
+
+		errs := err.(interface{ Unwrap() []error }).Unwrap()
+		if len(errs) != 3 {
+			t.Fatalf("Validate() reports %d errors, expects 3: %s", len(errs), err)
+		}
+	})
+
+	t.Run("Should require keys with jwt strategy", func(t *testing.T) {
+		cfg := Default()
+		cfg.Auth.Strategy = JWTStrategy
+
+		if err := cfg.Validate(); err == nil {
+			t.Fatal("Validate() expects error")
+		}
+
+		cfg.Auth.JWT = JWTConfig{KeysDir: "keys", SigningKey: "2026-10"}
+		if err := cfg.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Should reject invalid password policies", func(t *testing.T) {
+		cfg := Default()
+		cfg.Auth.Password.MinLength = 0
+		cfg.Auth.Password.MaxLength = 100
+		cfg.Auth.Password.Require = []string{"digit", "emoji"}
+
+		err := cfg.Validate()
+		if err == nil {
+			t.Fatal("Validate() expects error")
+		}
+
+		errs := err.(interface{ Unwrap() []error }).Unwrap()
+		if len(errs) != 3 {
+			t.Fatalf("Validate() reports %d errors, expects 3: %s", len(errs), err)
+		}
+	})
+
+	t.Run("Should require secrets keys folder and master key together", func(t *testing.T) {
+		cfg := Default()
+		cfg.System.Secrets.MasterKey = "2026-10"
+
+		if err := cfg.Validate(); err == nil {
+			t.Fatal("Validate() expects error")
+		}
+
+		cfg.System.Secrets.KeysDir = "keys"
+		if err := cfg.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// Test applyEnv covers every configuration field.
+func TestApplyEnv(t *testing.T) {
+	variables := map[string]string{
+		"environment":               EnvironmentVariable,
+		"storage.folder":            "MSIM_STORAGE_FOLDER",
+		"storage.filename":          "MSIM_STORAGE_FILENAME",
+		"database.url":              DatabaseVariable,
+		"auth.token_lifetime":       "MSIM_TOKEN_LIFETIME",
+		"auth.sliding_expiration":   "MSIM_SLIDING_EXPIRATION",
+		"auth.sweep_interval":       "MSIM_SWEEP_INTERVAL",
+		"auth.refresh_lifetime":     "MSIM_REFRESH_LIFETIME",
+		"auth.bcrypt_cost":          "MSIM_BCRYPT_COST",
+		"auth.strategy":             "MSIM_TOKEN_STRATEGY",
+		"auth.jwt.keys_dir":         "MSIM_JWT_KEYS_DIR",
+		"auth.jwt.signing_key":      "MSIM_JWT_SIGNING_KEY",
+		"auth.jwt.strict":           "MSIM_JWT_STRICT",
+		"auth.password.min_length":  "MSIM_PASSWORD_MIN_LENGTH",
+		"auth.password.max_length":  "MSIM_PASSWORD_MAX_LENGTH",
+		"auth.password.require":     "MSIM_PASSWORD_REQUIRE",
+		"auth.password.reject_name": "MSIM_PASSWORD_REJECT_NAME",
+		"auth.password.common_list": "MSIM_PASSWORD_COMMON_LIST",
+		"server.addr":               "MSIM_ADDR",
+		"server.import_limit":       "MSIM_IMPORT_LIMIT",
+		"system.cache_ttl":          "MSIM_CACHE_TTL",
+		"system.secrets.keys_dir":   "MSIM_SECRETS_KEYS_DIR",
+		"system.secrets.master_key": "MSIM_SECRETS_MASTER_KEY",
+	}
+
+	walkFields(reflect.ValueOf(Default()).Elem(), "", func(path string, field reflect.Value) {
+		t.Run("Should override "+path+" with an environment variable", func(t *testing.T) {
+			name, ok := variables[path]
+			if !ok {
+				t.Fatalf("%s has no MSIM_* environment variable", path)
+			}
+
+			t.Setenv(name, sampleValue(field))
+			cfg := Default()
+			if err := cfg.applyEnv(); err != nil {
+				t.Fatal(err)
+			}
+
+			if reflect.DeepEqual(fieldAt(reflect.ValueOf(cfg).Elem(), path).Interface(), field.Interface()) {
+				t.Fatalf("%s isn't overridden by %s", path, name)
+			}
+		})
+	})
+}
+
+// Call visit with the dotted path of every leaf field of value.
+func walkFields(value reflect.Value, prefix string, visit func(path string, field reflect.Value)) {
+	for i := 0; i < value.NumField(); i++ {
+		field, kind := value.Field(i), value.Type().Field(i)
+		path := prefix + strings.Split(kind.Tag.Get("json"), ",")[0]
+
+		if field.Kind() == reflect.Struct && kind.Type != reflect.TypeOf(Duration{}) {
+			walkFields(field, path+".", visit)
+			continue
+		}
+
+		visit(path, field)
+	}
+}
+
+// Get field of value at dotted path.
+func fieldAt(value reflect.Value, path string) reflect.Value {
+	for _, segment := range strings.Split(path, ".") {
+		for i := 0; i < value.NumField(); i++ {
+			if strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0] == segment {
+				value = value.Field(i)
+				break
+			}
+		}
+	}
+
+	return value
+}
+
+// Get environment variable value differing from field.
+func sampleValue(field reflect.Value) string {
+	if field.Type() == reflect.TypeOf(Duration{}) {
+		return "7s"
+	}
+
+	switch field.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(!field.Bool())
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(field.Int()+1, 10)
+	case reflect.Slice:
+		return "lower"
+	}
+
+	return "sample"
+}
+
+// Write config file in a temporary folder.
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
@@ -1,5 +1,10 @@
 package config
 
+import (
+	"fmt"
+	"os"
+)
+
 type Environment string
 
 const (
@@ -7,3 +12,29 @@ const (
 	Server Environment = "server"
 	Test   Environment = "test"
 )
+
+// Environment variables read by the application.
+const (
+	EnvironmentVariable = "MSIM_ENV"
+	DatabaseVariable    = "MSIM_DATABASE"
+)
+
+// Check if environment is one of the known environments.
+func (e Environment) Valid() bool {
+	return e == Local || e == Server || e == Test
+}
+
+// Get environment from MSIM_ENV, defaults to local.
+func Current() (Environment, error) {
+	value, ok := os.LookupEnv(EnvironmentVariable)
+	if !ok || value == "" {
+		return Local, nil
+	}
+
+	env := Environment(value)
+	if !env.Valid() {
+		return "", fmt.Errorf("%s must be one of %s, %s or %s, got %q", EnvironmentVariable, Local, Server, Test, value)
+	}
+
+	return env, nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import "testing"
+
+// Test Current
+func TestCurrent(t *testing.T) {
+	t.Run("Should default to local environment", func(t *testing.T) {
+		t.Setenv(EnvironmentVariable, "")
+
+		result, err := Current()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result != Local {
+			t.Fatalf("Current() returns %s, expects %s", result, Local)
+		}
+	})
+
+	t.Run("Should read environment from variable", func(t *testing.T) {
+		t.Setenv(EnvironmentVariable, "server")
+
+		result, err := Current()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result != Server {
+			t.Fatalf("Current() returns %s, expects %s", result, Server)
+		}
+	})
+
+	t.Run("Should return error on unknown environment", func(t *testing.T) {
+		t.Setenv(EnvironmentVariable, "production")
+
+		if _, err := Current(); err == nil {
+			t.Fatal("Current() expects error on unknown environment")
+		}
+	})
+}
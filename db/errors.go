@@ -0,0 +1,17 @@
+package db
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"msim/app/shared"
+)
+
+// Translate ORM error into an exception about field, keeping it as cause.
+func TranslateError(err error, field string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return shared.FormException(shared.NOT_FOUND_EX, field).Wrap(err)
+	}
+
+	return err
+}
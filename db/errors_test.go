@@ -0,0 +1,36 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+	"msim/app/shared"
+)
+
+// Test TranslateError
+func TestTranslateError(t *testing.T) {
+	t.Run("Should translate record not found into a not found exception", func(t *testing.T) {
+		err := TranslateError(gorm.ErrRecordNotFound, "user")
+
+		if !errors.Is(err, shared.ErrNotFound) {
+			t.Fatal("TranslateError() must return a not found exception")
+		}
+
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatal("TranslateError() must keep the original error as cause")
+		}
+	})
+
+	t.Run("Should keep other errors untouched", func(t *testing.T) {
+		cause := errors.New("disk I/O error")
+
+		if TranslateError(cause, "user") != cause {
+			t.Fatal("TranslateError() must return other errors as is")
+		}
+
+		if TranslateError(nil, "user") != nil {
+			t.Fatal("TranslateError() must return nil without error")
+		}
+	})
+}
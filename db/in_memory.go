@@ -7,7 +7,7 @@ import (
 
 // Get ORM instance for in-memory database
 func InMemoryDB() (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open("file::memory:?_foreign_keys=on"), &gorm.Config{})
 
 	return db, err
 }
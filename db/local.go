@@ -4,19 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-const storageFilename = "storage"
-const databaseFilename = "db.sqlite"
-
-// Get ORM instance for local database
-func LocalDB() (*gorm.DB, error) {
-	filePath := fmt.Sprintf("%s/%s", storageFilename, databaseFilename)
-	pathWithForeignKeyArgs := fmt.Sprintf("%s?_foreign_keys=on", filePath)
-	db, err := gorm.Open(sqlite.Open(pathWithForeignKeyArgs), &gorm.Config{})
+// Get ORM instance for local database in storage folder
+func LocalDB(folder, filename string) (*gorm.DB, error) {
+	filePath := filepath.Join(folder, filename)
+	db, err := SqliteDB(filePath)
 
 	if err != nil {
 		fmt.Println("Error openning local database")
@@ -25,10 +22,16 @@ func LocalDB() (*gorm.DB, error) {
 	return db, err
 }
 
-// Setup environment for sqlite database
-func LocalDBSetup() error {
-	if createStorageFolderIfDoesntExists(storageFilename) {
-		filePath := fmt.Sprintf("%s/%s", storageFilename, databaseFilename)
+// Get ORM instance for sqlite database file at path
+func SqliteDB(path string) (*gorm.DB, error) {
+	pathWithForeignKeyArgs := fmt.Sprintf("%s?_foreign_keys=on", path)
+	return gorm.Open(sqlite.Open(pathWithForeignKeyArgs), &gorm.Config{})
+}
+
+// Setup environment for sqlite database in storage folder
+func LocalDBSetup(folder, filename string) error {
+	if createStorageFolderIfDoesntExists(folder) {
+		filePath := filepath.Join(folder, filename)
 		createSqliteDatabase(filePath)
 
 		return nil
@@ -39,8 +42,8 @@ func LocalDBSetup() error {
 
 // Create storage folder if doesnt exists, return true if folder exists
 func createStorageFolderIfDoesntExists(path string) bool {
-	if _, err := os.Stat(storageFilename); os.IsNotExist(err) {
-		if err := os.Mkdir(storageFilename, os.ModePerm); err != nil {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.Mkdir(path, os.ModePerm); err != nil {
 			fmt.Println("Error creating storage folder", err)
 			return false
 		}
@@ -14,7 +14,7 @@ func TestLocalDB(t *testing.T) {
 	t.Run("Should return *gorm.DB instance when database exists", func(t *testing.T) {
 		setupLocal()
 
-		result, _ := LocalDB()
+		result, _ := LocalDB("storage", "db.sqlite")
 		resultType := reflect.TypeOf(result)
 		expectedType := reflect.TypeOf((*gorm.DB)(nil))
 
@@ -27,7 +27,7 @@ func TestLocalDB(t *testing.T) {
 	})
 
 	t.Run("Should return error when database doesnt exists", func(t *testing.T) {
-		_, err := LocalDB()
+		_, err := LocalDB("storage", "db.sqlite")
 
 		if err == nil {
 			t.Fatal("LocalDB() expects error when theres no database")
@@ -40,7 +40,7 @@ func TestLocalDB(t *testing.T) {
 // Test LocalDBSetup
 func TestLocalDBSetup(t *testing.T) {
 	t.Run("Should setup environment for local database", func(t *testing.T) {
-		result := LocalDBSetup()
+		result := LocalDBSetup("storage", "db.sqlite")
 
 		if result != nil {
 			t.Fatal("LocalDBSetup() must create database file without errors")
@@ -75,3 +75,23 @@ func setupLocal() {
 	}
 	defer newFile.Close()
 }
+
+// Test SqliteDB
+func TestSqliteDB(t *testing.T) {
+	t.Run("Should open database file at path", func(t *testing.T) {
+		path := t.TempDir() + "/server.sqlite"
+
+		result, err := SqliteDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := result.Exec("CREATE TABLE probe (id INTEGER)").Error; err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("SqliteDB() must create database file in %s", path)
+		}
+	})
+}
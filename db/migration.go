@@ -0,0 +1,228 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const migrationsTable = "schema_migrations"
+
+// Schema change applied with Up statements and reverted with Down ones.
+// Versions are ordered integers, by convention YYYYMMDDNN, unique across modules.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      []string
+	Down    []string
+	// Statements run before Up and Down on a dialect only, by dialector name
+	// like "sqlite" or "postgres".
+	DialectUp   map[string][]string
+	DialectDown map[string][]string
+}
+
+// Dialector names of the supported databases.
+const (
+	Sqlite   = "sqlite"
+	Postgres = "postgres"
+)
+
+type SchemaMigration struct {
+	Version   int64 `gorm:"primaryKey"`
+	Name      string
+	AppliedAt time.Time
+}
+
+type MigrationStatus struct {
+	Migration Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+	out        io.Writer
+}
+
+// Table name of SchemaMigration.
+func (SchemaMigration) TableName() string {
+	return migrationsTable
+}
+
+// Create a Migrator instance for migrations, sorted by version.
+func (migrator *Migrator) New(database *gorm.DB, migrations []Migration) *Migrator {
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	return &Migrator{db: database, migrations: sorted, out: os.Stdout}
+}
+
+// Apply pending migrations in version order, each one in a transaction.
+// On dry run the SQL is printed instead of executed.
+func (migrator *Migrator) Up(dryRun bool) ([]Migration, error) {
+	applied, err := migrator.prepare(dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range migrator.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		statements := append(append([]string{}, migration.DialectUp[migrator.dialect()]...), migration.Up...)
+		err := migrator.run(migration, statements, dryRun, func(tx *gorm.DB) error {
+			record := &SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+			return tx.Create(record).Error
+		})
+		if err != nil {
+			return done, err
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Revert the last steps applied migrations in reverse version order.
+// On dry run the SQL is printed instead of executed.
+func (migrator *Migrator) Down(steps int, dryRun bool) ([]Migration, error) {
+	applied, err := migrator.prepare(dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(migrator.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := migrator.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		statements := append(append([]string{}, migration.DialectDown[migrator.dialect()]...), migration.Down...)
+		err := migrator.run(migration, statements, dryRun, func(tx *gorm.DB) error {
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return done, err
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Get applied state of every migration.
+func (migrator *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := migrator.prepare(true)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range migrator.migrations {
+		record, ok := applied[migration.Version]
+		statuses = append(statuses, MigrationStatus{
+			Migration: migration,
+			Applied:   ok,
+			AppliedAt: record.AppliedAt,
+		})
+	}
+
+	return statuses, nil
+}
+
+// Get migrations not applied yet.
+func (migrator *Migrator) Pending() ([]Migration, error) {
+	statuses, err := migrator.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, status.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// PRIVATE:
+
+// Check versions, create migrations table and get applied migrations by version.
+// The table isn't created on dry run, an absent table means nothing is applied.
+func (migrator *Migrator) prepare(dryRun bool) (map[int64]SchemaMigration, error) {
+	for i := 1; i < len(migrator.migrations); i++ {
+		if migrator.migrations[i].Version == migrator.migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicated migration version %d", migrator.migrations[i].Version)
+		}
+	}
+
+	applied := map[int64]SchemaMigration{}
+	if !migrator.db.Migrator().HasTable(migrationsTable) {
+		if dryRun {
+			return applied, nil
+		}
+
+		err := migrator.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamp NOT NULL
+		)`).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var records []SchemaMigration
+	if err := migrator.db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+
+	return applied, nil
+}
+
+// Get dialector name of the migrated database.
+func (migrator *Migrator) dialect() string {
+	return migrator.db.Dialector.Name()
+}
+
+// Execute statements and record step of migration in one transaction.
+func (migrator *Migrator) run(migration Migration, statements []string, dryRun bool, record func(tx *gorm.DB) error) error {
+	if dryRun {
+		fmt.Fprintf(migrator.out, "-- %d %s\n", migration.Version, migration.Name)
+		for _, statement := range statements {
+			fmt.Fprintf(migrator.out, "%s;\n", statement)
+		}
+		return nil
+	}
+
+	err := migrator.db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		return record(tx)
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+	}
+
+	return nil
+}
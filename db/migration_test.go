@@ -0,0 +1,197 @@
+package db
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+var testMigrations = []Migration{
+	{
+		Version: 2,
+		Name:    "create_posts",
+		Up:      []string{"CREATE TABLE posts (id integer PRIMARY KEY, author_id integer)"},
+		Down:    []string{"DROP TABLE posts"},
+	},
+	{
+		Version: 1,
+		Name:    "create_authors",
+		Up:      []string{"CREATE TABLE authors (id integer PRIMARY KEY)"},
+		Down:    []string{"DROP TABLE authors"},
+	},
+}
+
+// Test Migrator.Up
+func TestMigratorUp(t *testing.T) {
+	t.Run("Should apply pending migrations in version order", func(t *testing.T) {
+		migrator, DB := CreateMigrator(t, testMigrations)
+
+		done, err := migrator.Up(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(done) != 2 || done[0].Version != 1 || done[1].Version != 2 {
+			t.Fatalf("Up() applies %v, expects versions 1 and 2 in order", done)
+		}
+
+		if !DB.Migrator().HasTable("authors") || !DB.Migrator().HasTable("posts") {
+			t.Fatal("Up() must create the migrated tables")
+		}
+
+		var count int64
+		DB.Model(&SchemaMigration{}).Count(&count)
+		if count != 2 {
+			t.Fatalf("Up() records %d migrations, expects 2", count)
+		}
+	})
+
+	t.Run("Should not apply migrations twice", func(t *testing.T) {
+		migrator, _ := CreateMigrator(t, testMigrations)
+		migrator.Up(false)
+
+		done, err := migrator.Up(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(done) != 0 {
+			t.Fatalf("Up() applies %d migrations, expects none", len(done))
+		}
+	})
+
+	t.Run("Should run statements of the database dialect first", func(t *testing.T) {
+		dialects := append([]Migration{}, testMigrations...)
+		dialects = append(dialects, Migration{
+			Version: 3,
+			Name:    "create_comments",
+			DialectUp: map[string][]string{
+				Sqlite:   {"CREATE TABLE comments (id integer)"},
+				Postgres: {"CREATE TABLE comments (id integer)"},
+				"other":  {"NOT SQL"},
+			},
+			Up: []string{"CREATE INDEX idx_comments_id ON comments (id)"},
+		})
+		migrator, DB := CreateMigrator(t, dialects)
+
+		if _, err := migrator.Up(false); err != nil {
+			t.Fatal(err)
+		}
+
+		if !DB.Migrator().HasIndex("comments", "idx_comments_id") {
+			t.Fatal("Up() must run dialect statements before the others")
+		}
+	})
+
+	t.Run("Should rollback a failing migration", func(t *testing.T) {
+		broken := append([]Migration{}, testMigrations...)
+		broken = append(broken, Migration{
+			Version: 3,
+			Name:    "broken",
+			Up:      []string{"CREATE TABLE comments (id integer)", "NOT SQL"},
+		})
+		migrator, DB := CreateMigrator(t, broken)
+
+		done, err := migrator.Up(false)
+		if err == nil {
+			t.Fatal("Up() expects error on invalid SQL")
+		}
+
+		if len(done) != 2 {
+			t.Fatalf("Up() applies %d migrations, expects 2", len(done))
+		}
+
+		if DB.Migrator().HasTable("comments") {
+			t.Fatal("Up() must rollback the failing migration")
+		}
+	})
+
+	t.Run("Should print SQL without executing on dry run", func(t *testing.T) {
+		migrator, DB := CreateMigrator(t, testMigrations)
+		var out bytes.Buffer
+		migrator.out = &out
+
+		if _, err := migrator.Up(true); err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(out.String(), "CREATE TABLE authors") {
+			t.Fatalf("Up() prints %q, expects the migration SQL", out.String())
+		}
+
+		if DB.Migrator().HasTable("authors") || DB.Migrator().HasTable(migrationsTable) {
+			t.Fatal("Up() must not change the database on dry run")
+		}
+	})
+
+	t.Run("Should return error on duplicated versions", func(t *testing.T) {
+		duplicated := append([]Migration{}, testMigrations...)
+		duplicated = append(duplicated, Migration{Version: 1, Name: "other"})
+		migrator, _ := CreateMigrator(t, duplicated)
+
+		if _, err := migrator.Up(false); err == nil {
+			t.Fatal("Up() expects error on duplicated versions")
+		}
+	})
+}
+
+// Test Migrator.Down
+func TestMigratorDown(t *testing.T) {
+	t.Run("Should revert the last applied migrations", func(t *testing.T) {
+		migrator, DB := CreateMigrator(t, testMigrations)
+		migrator.Up(false)
+
+		done, err := migrator.Down(1, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(done) != 1 || done[0].Version != 2 {
+			t.Fatalf("Down() reverts %v, expects version 2", done)
+		}
+
+		if DB.Migrator().HasTable("posts") || !DB.Migrator().HasTable("authors") {
+			t.Fatal("Down() must only drop the last migrated table")
+		}
+
+		pending, _ := migrator.Pending()
+		if len(pending) != 1 || pending[0].Version != 2 {
+			t.Fatal("Reverted migration should be pending")
+		}
+	})
+}
+
+// Test Migrator.Status
+func TestMigratorStatus(t *testing.T) {
+	t.Run("Should report applied and pending migrations", func(t *testing.T) {
+		migrator, _ := CreateMigrator(t, testMigrations[1:])
+		migrator.Up(false)
+
+		migrator = migrator.New(migrator.db, testMigrations)
+		statuses, err := migrator.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(statuses) != 2 || !statuses[0].Applied || statuses[1].Applied {
+			t.Fatalf("Status() returns %+v, expects version 1 applied and 2 pending", statuses)
+		}
+
+		if statuses[0].AppliedAt.IsZero() {
+			t.Fatal("Status() must report when a migration was applied")
+		}
+	})
+}
+
+// Create migrator and test database.
+func CreateMigrator(t *testing.T, migrations []Migration) (*Migrator, *gorm.DB) {
+	DB, cleanup, err := TestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
+
+	return (&Migrator{}).New(DB, migrations), DB
+}
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"msim/app/shared"
+)
+
+// Rows per page when unset, and at most.
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+// Orders of paginated queries.
+const (
+	Ascending  = "asc"
+	Descending = "desc"
+)
+
+// Query of a page of rows sorted on a column, ties broken by id so pages
+// stay stable while rows are inserted.
+type PageQuery struct {
+	// Rows of the page, DefaultPageLimit when 0.
+	Limit int
+	// Position the page starts after, from the previous page, empty for the
+	// first page.
+	Cursor string
+	// Column sorted on.
+	Sort string
+	// Ascending or Descending.
+	Order string
+	// Count every row matching the filters.
+	Total bool
+}
+
+// Rows of a page and cursor of the next one, empty on the last page.
+// Total is only counted when asked for.
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+	Total      *int64
+	cursors    []string
+}
+
+// Sort value and id of the last row of a page, with the sort and order
+// the position is only meaningful for.
+type cursor struct {
+	Sort  string     `json:"sort"`
+	Order string     `json:"order"`
+	At    *time.Time `json:"at,omitempty"`
+	Value string     `json:"value,omitempty"`
+	ID    uuid.UUID  `json:"id"`
+}
+
+// Check page against sortable columns, the first one being the default,
+// and set defaults. Returns an APPLICATION_EX exception on the invalid field.
+func (page *PageQuery) Validate(sorts ...string) *shared.Exception {
+	if page.Limit == 0 {
+		page.Limit = DefaultPageLimit
+	}
+
+	if page.Limit < 0 || page.Limit > MaxPageLimit {
+		ex := shared.FormException(shared.APPLICATION_EX, "limit")
+		ex.Reason = fmt.Sprintf("must be between 1 and %d", MaxPageLimit)
+		return ex
+	}
+
+	if page.Sort == "" {
+		page.Sort = sorts[0]
+	}
+
+	if !slices.Contains(sorts, page.Sort) {
+		return shared.FormException(shared.APPLICATION_EX, "sort")
+	}
+
+	if page.Order == "" {
+		page.Order = Ascending
+	}
+
+	if page.Order != Ascending && page.Order != Descending {
+		return shared.FormException(shared.APPLICATION_EX, "order")
+	}
+
+	if page.Cursor != "" {
+		position, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return shared.FormException(shared.APPLICATION_EX, "cursor").Wrap(err)
+		}
+
+		if position.Sort != page.Sort || position.Order != page.Order {
+			ex := shared.FormException(shared.APPLICATION_EX, "cursor")
+			ex.Reason = fmt.Sprintf("made for sort %s in order %s", position.Sort, position.Order)
+			return ex
+		}
+	}
+
+	return nil
+}
+
+// Apply cursor, order and limit of a validated page to query. One row more
+// than the limit is fetched to tell whether a next page exists, see Cut.
+func Paginate(query *gorm.DB, page *PageQuery) (*gorm.DB, error) {
+	direction, comparison := "ASC", ">"
+	if page.Order == Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if page.Cursor != "" {
+		position, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return nil, shared.FormException(shared.APPLICATION_EX, "cursor").Wrap(err)
+		}
+
+		var value any = position.Value
+		if position.At != nil {
+			value = *position.At
+		}
+
+		condition := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", page.Sort, comparison)
+		query = query.Where(condition, value, value, position.ID)
+	}
+
+	return query.Order(page.Sort + " " + direction).Order("id " + direction).Limit(page.Limit + 1), nil
+}
+
+// Build page of rows fetched with Paginate, position returning the sort
+// value, a time or a string, and the id of a row.
+func Cut[T any](rows []T, page *PageQuery, position func(T) (any, uuid.UUID)) *Page[T] {
+	result := &Page[T]{Items: []T{}}
+
+	for i, row := range rows {
+		if i == page.Limit {
+			result.NextCursor = result.cursors[i-1]
+			break
+		}
+
+		value, id := position(row)
+		result.Items = append(result.Items, row)
+		result.cursors = append(result.cursors, encodeCursor(page, value, id))
+	}
+
+	return result
+}
+
+// Map items of page with f, keeping cursors.
+func MapPage[T, U any](page *Page[T], f func(T) U) *Page[U] {
+	result := &Page[U]{Items: []U{}, NextCursor: page.NextCursor, Total: page.Total, cursors: page.cursors}
+	for _, item := range page.Items {
+		result.Items = append(result.Items, f(item))
+	}
+
+	return result
+}
+
+// Get cursor of the page starting after item i.
+func (page *Page[T]) CursorAt(i int) string {
+	return page.cursors[i]
+}
+
+// PRIVATE:
+
+// Encode sort value and id of a row of page as an opaque cursor.
+func encodeCursor(page *PageQuery, value any, id uuid.UUID) string {
+	position := cursor{Sort: page.Sort, Order: page.Order, ID: id}
+	switch value := value.(type) {
+	case time.Time:
+		position.At = &value
+	default:
+		position.Value = fmt.Sprint(value)
+	}
+
+	data, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode cursor made by encodeCursor.
+func decodeCursor(encoded string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var position cursor
+	if err := json.Unmarshal(data, &position); err != nil {
+		return nil, err
+	}
+
+	return &position, nil
+}
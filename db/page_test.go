@@ -0,0 +1,173 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"msim/app/shared"
+)
+
+type pageRow struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Name      string
+	CreatedAt time.Time
+}
+
+// Test PageQuery.Validate
+func TestPageQueryValidate(t *testing.T) {
+	t.Run("Should set defaults", func(t *testing.T) {
+		page := PageQuery{}
+		if ex := page.Validate("created_at", "name"); ex != nil {
+			t.Fatal(ex)
+		}
+
+		if page.Limit != DefaultPageLimit || page.Sort != "created_at" || page.Order != Ascending {
+			t.Fatalf("Validate() sets %+v, expects defaults", page)
+		}
+	})
+
+	t.Run("Should reject invalid fields", func(t *testing.T) {
+		cases := map[string]PageQuery{
+			"limit":  {Limit: MaxPageLimit + 1},
+			"sort":   {Sort: "password"},
+			"order":  {Order: "up"},
+			"cursor": {Cursor: "not a cursor"},
+		}
+
+		for field, page := range cases {
+			ex := page.Validate("created_at", "name")
+			if !errors.Is(ex, shared.ErrApplication) || ex.Field != field {
+				t.Fatalf("Validate() returns %v, expects an application exception on %s", ex, field)
+			}
+		}
+	})
+
+	t.Run("Should reject cursors of another sort or order", func(t *testing.T) {
+		DB := CreatePageRows(t, 3)
+		first := FetchPage(t, DB, &PageQuery{Limit: 1, Sort: "name", Order: Ascending})
+
+		for _, page := range []PageQuery{
+			{Cursor: first.NextCursor, Sort: "created_at", Order: Ascending},
+			{Cursor: first.NextCursor, Sort: "name", Order: Descending},
+		} {
+			ex := page.Validate("created_at", "name")
+			if !errors.Is(ex, shared.ErrApplication) || ex.Field != "cursor" {
+				t.Fatalf("Validate() returns %v, expects an application exception on cursor", ex)
+			}
+		}
+
+		page := PageQuery{Cursor: first.NextCursor, Sort: "name", Order: Ascending}
+		if ex := page.Validate("created_at", "name"); ex != nil {
+			t.Fatal(ex)
+		}
+	})
+}
+
+// Test Paginate and Cut
+func TestPaginate(t *testing.T) {
+	t.Run("Should walk every row once in order", func(t *testing.T) {
+		DB := CreatePageRows(t, 5)
+
+		for _, order := range []string{Ascending, Descending} {
+			page := PageQuery{Limit: 2, Sort: "name", Order: order}
+			var names []string
+			for {
+				result := FetchPage(t, DB, &page)
+				for _, row := range result.Items {
+					names = append(names, row.Name)
+				}
+
+				if result.NextCursor == "" {
+					break
+				}
+				page.Cursor = result.NextCursor
+			}
+
+			expected := "[row0 row1 row2 row3 row4]"
+			if order == Descending {
+				expected = "[row4 row3 row2 row1 row0]"
+			}
+			if fmt.Sprint(names) != expected {
+				t.Fatalf("%s pages return %v, expects %s", order, names, expected)
+			}
+		}
+	})
+
+	t.Run("Should break ties on created_at by id", func(t *testing.T) {
+		DB := CreatePageRows(t, 0)
+		at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+		for i := 0; i < 3; i++ {
+			DB.Create(&pageRow{ID: uuid.New(), Name: fmt.Sprint(i), CreatedAt: at})
+		}
+
+		page := PageQuery{Limit: 1, Sort: "created_at", Order: Ascending}
+		seen := map[uuid.UUID]bool{}
+		for {
+			result := FetchPage(t, DB, &page)
+			for _, row := range result.Items {
+				seen[row.ID] = true
+			}
+
+			if result.NextCursor == "" {
+				break
+			}
+			page.Cursor = result.NextCursor
+		}
+
+		if len(seen) != 3 {
+			t.Fatalf("pages return %d rows, expects 3", len(seen))
+		}
+	})
+
+	t.Run("Should not return a cursor on the last page", func(t *testing.T) {
+		DB := CreatePageRows(t, 2)
+
+		result := FetchPage(t, DB, &PageQuery{Limit: 2, Sort: "name", Order: Ascending})
+		if len(result.Items) != 2 || result.NextCursor != "" {
+			t.Fatalf("page returns %d rows and cursor %q, expects 2 and none", len(result.Items), result.NextCursor)
+		}
+	})
+}
+
+// Create test database with count rows named row0, row1...
+func CreatePageRows(t *testing.T, count int) *gorm.DB {
+	DB, cleanup, err := TestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
+
+	DB.Migrator().DropTable(&pageRow{})
+	DB.AutoMigrate(&pageRow{})
+	for i := 0; i < count; i++ {
+		DB.Create(&pageRow{ID: uuid.New(), Name: fmt.Sprintf("row%d", i), CreatedAt: time.Now().Add(time.Duration(i) * time.Second)})
+	}
+
+	return DB
+}
+
+// Fetch a page of rows.
+func FetchPage(t *testing.T, DB *gorm.DB, page *PageQuery) *Page[pageRow] {
+	t.Helper()
+
+	query, err := Paginate(DB.Model(&pageRow{}), page)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []pageRow
+	if err := query.Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return Cut(rows, page, func(row pageRow) (any, uuid.UUID) {
+		if page.Sort == "name" {
+			return row.Name, row.ID
+		}
+		return row.CreatedAt, row.ID
+	})
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Get ORM instance for PostgreSQL database,
+// dsn is either a postgres:// URL or a "key=value" connection string
+func PostgresDB(dsn string) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+
+	if err != nil {
+		fmt.Println("Error openning postgres database")
+	}
+
+	return db, err
+}
+
+// Get ORM instance for server database, PostgreSQL for postgres URLs
+// and sqlite file at path otherwise
+func ServerDB(dsn string) (*gorm.DB, error) {
+	if IsPostgres(dsn) {
+		return PostgresDB(dsn)
+	}
+
+	return SqliteDB(dsn)
+}
+
+// Check if dsn points to a PostgreSQL database
+func IsPostgres(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") ||
+		strings.HasPrefix(dsn, "postgresql://") ||
+		strings.Contains(dsn, "host=")
+}
+
+// Set the schema search path of dsn
+func withSearchPath(dsn, schema string) string {
+	parsed, err := url.Parse(dsn)
+	if err != nil || parsed.Scheme == "" {
+		return fmt.Sprintf("%s search_path=%s", dsn, schema)
+	}
+
+	query := parsed.Query()
+	query.Set("search_path", schema)
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String()
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Variable holding the PostgreSQL URL tests run against instead of sqlite.
+const TestDatabaseVariable = "MSIM_TEST_DATABASE"
+
+// Get ORM instance for an empty test database: in-memory sqlite by default,
+// or a fresh schema of the PostgreSQL database in MSIM_TEST_DATABASE.
+// Cleanup drops the schema and closes the connections once the test is done.
+func TestDB() (database *gorm.DB, cleanup func(), err error) {
+	dsn := os.Getenv(TestDatabaseVariable)
+	if dsn == "" {
+		database, err = InMemoryDB()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return database, func() { closeDB(database) }, nil
+	}
+
+	admin, err := PostgresDB(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if err := admin.Exec(fmt.Sprintf("CREATE SCHEMA %s", schema)).Error; err != nil {
+		closeDB(admin)
+		return nil, nil, err
+	}
+
+	cleanup = func() {
+		if database != nil {
+			closeDB(database)
+		}
+
+		if err := admin.Exec(fmt.Sprintf("DROP SCHEMA %s CASCADE", schema)).Error; err != nil {
+			fmt.Println("Error dropping test schema", schema, err)
+		}
+		closeDB(admin)
+	}
+
+	database, err = PostgresDB(withSearchPath(dsn, schema))
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return database, cleanup, nil
+}
+
+// PRIVATE:
+
+// Close connections of database.
+func closeDB(database *gorm.DB) {
+	if sqlDB, err := database.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
@@ -1,7 +1,254 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"msim/app/bootstrap"
+	"msim/app/server"
+	"msim/app/system"
+	"msim/app/user"
+	"msim/config"
+	"msim/db"
+)
 
 func main() {
-	fmt.Println("first commit")
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "serve":
+		if err := serve(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case "migrate":
+		if err := migrate(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case "role":
+		if err := role(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case "keygen":
+		if err := keygen(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case "secrets":
+		if err := secrets(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// Print command line usage.
+func usage() {
+	fmt.Println("usage: msim <command> [flags]")
+	fmt.Println()
+	fmt.Println("commands:")
+	fmt.Println("  serve                     start the HTTP server")
+	fmt.Println("  migrate up|down|status    apply, revert or list schema migrations")
+	fmt.Println("  role <name> <role>        set the role of an user (admin, operator or reader)")
+	fmt.Println("  keygen                    generate a JWT signing key")
+	fmt.Println("  secrets keygen|rotate     generate a master key or re-encrypt secrets with the current one")
+}
+
+// Boot the HTTP server on the environment database.
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := flags.String("config", "", "configuration file (defaults to $MSIM_CONFIG)")
+	addr := flags.String("addr", "", "address to listen on (overrides server.addr)")
+	flags.Parse(args)
+
+	app, err := bootstrap.Boot(*configPath)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	if *addr == "" {
+		*addr = app.Config.Server.Addr
+	}
+
+	if interval := app.Config.Auth.SweepInterval.Duration; interval > 0 {
+		go app.UserService.SweepExpired(context.Background(), interval)
+	}
+
+	fmt.Printf("Listening on %s (%s)\n", *addr, app.Config.Environment)
+	return (&server.Server{}).New(app.UserService, app.SystemService, app.Config.Server.ImportLimit).ListenAndServe(*addr)
+}
+
+// Apply, revert or list schema migrations of the configured database.
+func migrate(args []string) error {
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configPath := flags.String("config", "", "configuration file (defaults to $MSIM_CONFIG)")
+	dryRun := flags.Bool("dry-run", false, "print the SQL instead of executing it")
+	steps := flags.Int("steps", 1, "number of migrations to revert on down")
+	flags.Parse(args[1:])
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return err
+	}
+
+	DB, closeDB, err := bootstrap.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	migrator := bootstrap.Migrator(DB)
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(*dryRun)
+		printMigrations("Applied", done, *dryRun)
+		return err
+	case "down":
+		done, err := migrator.Down(*steps, *dryRun)
+		printMigrations("Reverted", done, *dryRun)
+		return err
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%d %-24s %s\n", status.Migration.Version, status.Migration.Name, state)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown migrate command %q, expects up, down or status", args[0])
+}
+
+// Set the role of an user, used to grant the first admin.
+func role(args []string) error {
+	flags := flag.NewFlagSet("role", flag.ExitOnError)
+	configPath := flags.String("config", "", "configuration file (defaults to $MSIM_CONFIG)")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	app, err := bootstrap.Boot(*configPath)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	dto := &user.UserRoleDTO{Name: flags.Arg(0), Role: user.Role(flags.Arg(1))}
+	result, ex := app.UserService.AssignRole(dto)
+	if ex != nil {
+		return ex
+	}
+
+	fmt.Printf("%s is now %s\n", result.Name, result.Role)
+	return nil
+}
+
+// Generate a JWT signing key file.
+func keygen(args []string) error {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	dir := flags.String("dir", "keys", "keys folder")
+	kid := flags.String("kid", time.Now().Format("2006-01"), "key id, the file name without extension")
+	algorithm := flags.String("alg", user.EdDSA, "signing algorithm, HS256 or EdDSA")
+	flags.Parse(args)
+
+	if err := os.MkdirAll(*dir, 0o700); err != nil {
+		return err
+	}
+
+	path, err := user.GenerateKey(*dir, *kid, *algorithm)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Generated %s\n", path)
+	return nil
+}
+
+// Generate a master key of secret variables, or seal every secret again
+// with the configured master key.
+func secrets(args []string) error {
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("secrets", flag.ExitOnError)
+	configPath := flags.String("config", "", "configuration file (defaults to $MSIM_CONFIG)")
+	dir := flags.String("dir", "keys", "keys folder of keygen")
+	kid := flags.String("kid", time.Now().Format("2006-01"), "key id of keygen, the file name without extension")
+	flags.Parse(args[1:])
+
+	switch args[0] {
+	case "keygen":
+		if err := os.MkdirAll(*dir, 0o700); err != nil {
+			return err
+		}
+
+		path, err := system.GenerateMasterKey(*dir, *kid)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Generated %s\n", path)
+		return nil
+	case "rotate":
+		app, err := bootstrap.Boot(*configPath)
+		if err != nil {
+			return err
+		}
+		defer app.Close()
+
+		count, ex := app.SystemService.RotateSecrets()
+		if ex != nil {
+			return ex
+		}
+
+		fmt.Printf("Sealed %d secret values with %s\n", count, app.Config.System.Secrets.MasterKey)
+		return nil
+	}
+
+	return fmt.Errorf("unknown secrets command %q, expects keygen or rotate", args[0])
+}
+
+// Print migrations applied or reverted.
+func printMigrations(action string, migrations []db.Migration, dryRun bool) {
+	if dryRun {
+		return
+	}
+
+	for _, migration := range migrations {
+		fmt.Printf("%s %d %s\n", action, migration.Version, migration.Name)
+	}
+
+	if len(migrations) == 0 {
+		fmt.Println("Nothing to migrate")
+	}
 }